@@ -0,0 +1,42 @@
+package main
+
+import (
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// check-config 子命令：部署前检查配置文件，发现错误时返回非 0
+func checkConfigCmd(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	skipSerial := fs.Bool("skip-serial", false, "不检查串口设备是否可用（在非目标设备上检查时使用）")
+	fs.Parse(args)
+
+	cfg, issues, err := initialize.LoadConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !*skipSerial {
+		if err := config.CheckSerial(cfg.Modbus.Port); err != nil {
+			issues = append(issues, config.Issue{Key: "modbus.port", Msg: fmt.Sprintf("串口不可用: %v", err)})
+		}
+	}
+
+	errCount := 0
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if !issue.Warning {
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		fmt.Printf("%s: 发现 %d 个错误, %d 个警告\n", *configPath, errCount, len(issues)-errCount)
+		return 1
+	}
+	fmt.Printf("%s: 配置检查通过 (%d 个警告)\n", *configPath, len(issues))
+	return 0
+}
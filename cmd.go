@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+const defaultConfigPath = "./configs/conf.yml"
+
+// 子命令，例如 data_collect check-config -config ./configs/conf.yml
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"check-config": {"检查配置文件", checkConfigCmd},
+	"read":         {"读取寄存器", readCmd},
+	"write":        {"写入寄存器", writeCmd},
+	"scan":         {"扫描从站地址", scanCmd},
+	"monitor":      {"实时显示寄存器表的解析结果", monitorCmd},
+	"profiles":     {"列出内置的设备型号", profilesCmd},
+}
+
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知的子命令 %q\n", name)
+		printUsage()
+		return 2
+	}
+	return cmd.run(args)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法: data_collect [-config path]          运行采集程序")
+	fmt.Fprintln(os.Stderr, "      data_collect <子命令> [参数]          子命令参数见 data_collect <子命令> -h")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"dataCollect/initialize"
+	modbus "dataCollect/internal/Modbus"
+	"dataCollect/internal/config"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	gomodbus "github.com/goburrow/modbus"
+	"github.com/spf13/viper"
+)
+
+// 诊断命令与采集程序共用串口，运行前请先停止 data_collect 服务，避免两边同时访问总线
+
+// 各诊断命令共用的串口参数，未指定时使用配置文件中的值
+type serialFlags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	port       *string
+	baud       *int
+	parity     *string
+	stopBits   *int
+	slave      *int
+	timeout    *time.Duration
+}
+
+func addSerialFlags(fs *flag.FlagSet) *serialFlags {
+	return &serialFlags{
+		fs:         fs,
+		configPath: fs.String("config", defaultConfigPath, "Path to config file"),
+		port:       fs.String("port", "", "串口设备，默认使用配置文件中的 modbus.port"),
+		baud:       fs.Int("baud", 0, "波特率"),
+		parity:     fs.String("parity", "", "校验位 N E O"),
+		stopBits:   fs.Int("stopbits", 0, "停止位 1 2"),
+		slave:      fs.Int("slave", 0, "从站地址"),
+		timeout:    fs.Duration("timeout", 0, "单次读写超时"),
+	}
+}
+
+// modbusConfig 读取配置文件中的 modbus 配置，再用命令行参数覆盖
+func (f *serialFlags) modbusConfig() *config.Modbus {
+	cfg, issues, err := initialize.LoadConfigFile(*f.configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v，使用默认串口参数\n", err)
+		cfg, issues = config.Load(viper.New())
+	}
+	if config.HasError(issues) {
+		fmt.Fprintf(os.Stderr, "配置文件存在错误，可执行 data_collect check-config 查看详情\n")
+	}
+	conf := cfg.Modbus
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "port":
+			conf.Port = *f.port
+		case "baud":
+			conf.BaudRate = *f.baud
+		case "parity":
+			conf.Parity = strings.ToUpper(*f.parity)
+		case "stopbits":
+			conf.StopBits = *f.stopBits
+		case "slave":
+			conf.SlaveID = *f.slave
+		case "timeout":
+			conf.Timeout = *f.timeout
+		}
+	})
+	return &conf
+}
+
+func (f *serialFlags) connect() (*modbus.Connection, *config.Modbus, error) {
+	conf := f.modbusConfig()
+	handler := modbus.NewRTUHandler(conf)
+	if err := handler.Connect(); err != nil {
+		return nil, nil, fmt.Errorf("打开串口 %s 失败: %v", conf.Port, err)
+	}
+	return &modbus.Connection{Handler: handler, Client: gomodbus.NewClient(handler)}, conf, nil
+}
+
+// read 子命令：按功能码读取任意寄存器范围并按数据类型解析
+func readCmd(args []string) int {
+	fs := flag.NewFlagSet("read", flag.ExitOnError)
+	sf := addSerialFlags(fs)
+	function := fs.Int("fc", 3, "功能码 1 线圈 2 离散输入 3 保持寄存器 4 输入寄存器")
+	address := fs.Uint("addr", 0, "起始地址")
+	count := fs.Uint("count", 1, "读取的数据个数")
+	dataType := fs.String("type", "int16", "数据类型 int16 uint16 int32 uint32 float32")
+	scale := fs.Float64("scale", 1, "缩放系数")
+	fs.Parse(args)
+
+	conn, conf, err := sf.connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Handler.Close()
+
+	quantity := uint16(*count)
+	if *function == modbus.FuncReadHoldingRegisters || *function == modbus.FuncReadInputRegisters {
+		size, ok := config.TypeLength[*dataType]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "不支持的数据类型 %q\n", *dataType)
+			return 2
+		}
+		quantity = uint16(*count) * size
+	}
+	results, err := modbus.ReadFunction(conn.Client, *function, uint16(*address), quantity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "从站 %d 读取失败: %v\n", conf.SlaveID, err)
+		return 1
+	}
+
+	fmt.Printf("从站 %d 功能码 %d 地址 %d 数量 %d\n", conf.SlaveID, *function, *address, quantity)
+	if *function == modbus.FuncReadCoils || *function == modbus.FuncReadDiscreteInputs {
+		for i, bit := range modbus.DecodeBits(results, quantity) {
+			fmt.Printf("  %5d  %v\n", int(*address)+i, bit)
+		}
+		return 0
+	}
+	values, err := modbus.DecodeAll(*dataType, *scale, results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	size := int(config.TypeLength[*dataType])
+	for i, v := range values {
+		raw := results[i*size*2 : (i+1)*size*2]
+		fmt.Printf("  %5d  % X  %s: %v\n", int(*address)+i*size, raw, *dataType, v)
+	}
+	return 0
+}
+
+// write 子命令：写单个或多个保持寄存器，也可以写线圈
+func writeCmd(args []string) int {
+	fs := flag.NewFlagSet("write", flag.ExitOnError)
+	sf := addSerialFlags(fs)
+	function := fs.Int("fc", 6, "功能码 5 写单个线圈 6 写单个寄存器 16 写多个寄存器")
+	address := fs.Uint("addr", 0, "寄存器地址")
+	value := fs.String("value", "", "写入的值，支持 0x 前缀，写多个寄存器时用逗号分隔")
+	fs.Parse(args)
+
+	values, err := parseWords(*value)
+	if err != nil || len(values) == 0 {
+		fmt.Fprintf(os.Stderr, "写入的值 %q 无效: %v\n", *value, err)
+		return 2
+	}
+	if len(values) > 1 && *function != 16 {
+		fmt.Fprintln(os.Stderr, "写多个寄存器请使用 -fc 16")
+		return 2
+	}
+
+	conn, conf, err := sf.connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Handler.Close()
+
+	switch *function {
+	case 5:
+		// 线圈写入 0xFF00 表示 ON，0x0000 表示 OFF
+		coil := uint16(0x0000)
+		if values[0] != 0 {
+			coil = 0xFF00
+		}
+		_, err = conn.Client.WriteSingleCoil(uint16(*address), coil)
+	case 6:
+		_, err = conn.Client.WriteSingleRegister(uint16(*address), values[0])
+	case 16:
+		data := make([]byte, 0, len(values)*2)
+		for _, v := range values {
+			data = append(data, byte(v>>8), byte(v))
+		}
+		_, err = conn.Client.WriteMultipleRegisters(uint16(*address), uint16(len(values)), data)
+	default:
+		fmt.Fprintf(os.Stderr, "不支持的功能码 %d\n", *function)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "从站 %d 写入失败: %v\n", conf.SlaveID, err)
+		return 1
+	}
+	fmt.Printf("从站 %d 地址 %d 写入 %v 成功\n", conf.SlaveID, *address, values)
+	return 0
+}
+
+// 解析逗号分隔的寄存器值，负数按 int16 补码写入
+func parseWords(s string) ([]uint16, error) {
+	var words []uint16
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(part, 0, 32)
+		if err != nil {
+			return nil, err
+		}
+		if v < -32768 || v > 65535 {
+			return nil, fmt.Errorf("%d 超出 16 位寄存器范围", v)
+		}
+		words = append(words, uint16(v))
+	}
+	return words, nil
+}
+
+// scan 子命令：逐个探测从站地址，收到正常响应或异常响应都说明该地址有设备
+func scanCmd(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	sf := addSerialFlags(fs)
+	from := fs.Int("from", 1, "起始从站地址")
+	to := fs.Int("to", 247, "结束从站地址")
+	function := fs.Int("fc", 3, "探测使用的功能码")
+	address := fs.Int("addr", -1, "探测的寄存器地址，默认使用配置中第一个寄存器")
+	fs.Parse(args)
+	if *from < 1 || *to > 247 || *from > *to {
+		fmt.Fprintln(os.Stderr, "从站地址范围必须在 1-247 之间")
+		return 2
+	}
+
+	// 探测时默认使用较短的超时，否则扫描全部地址耗时太长
+	timeoutSet := false
+	fs.Visit(func(fl *flag.Flag) { timeoutSet = timeoutSet || fl.Name == "timeout" })
+	if !timeoutSet {
+		fs.Set("timeout", "300ms")
+	}
+	conn, conf, err := sf.connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Handler.Close()
+	probe := uint16(0)
+	if *address >= 0 {
+		probe = uint16(*address)
+	} else if len(conf.Registers) > 0 {
+		probe = conf.Registers[0].Address
+	}
+
+	fmt.Printf("扫描 %s %d %d%s%d 从站 %d-%d，探测地址 %d\n", conf.Port, conf.BaudRate,
+		conf.DataBits, conf.Parity, conf.StopBits, *from, *to, probe)
+	var found []int
+	for id := *from; id <= *to; id++ {
+		conn.Handler.SlaveId = byte(id)
+		_, err := modbus.ReadFunction(conn.Client, *function, probe, 1)
+		var mbErr *gomodbus.ModbusError
+		switch {
+		case err == nil:
+			fmt.Printf("\r  从站 %3d: 响应正常\n", id)
+			found = append(found, id)
+		case errors.As(err, &mbErr):
+			fmt.Printf("\r  从站 %3d: 异常响应 %v\n", id, mbErr)
+			found = append(found, id)
+		default:
+			fmt.Printf("\r  从站 %3d ...", id)
+		}
+	}
+	fmt.Printf("\r扫描完成，发现 %d 个从站: %v\n", len(found), found)
+	return 0
+}
+
+// monitor 子命令：按配置的寄存器表循环读取并实时显示解析结果
+func monitorCmd(args []string) int {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	sf := addSerialFlags(fs)
+	interval := fs.Duration("interval", 0, "刷新周期，默认使用配置中的 modbus.poll_interval")
+	profile := fs.String("profile", "", "使用内置型号的寄存器表，默认使用配置中的寄存器表")
+	fs.Parse(args)
+	p, ok := config.LookupProfile(*profile)
+	if *profile != "" && !ok {
+		fmt.Fprintf(os.Stderr, "未知的型号 %q，可选 %v\n", *profile, config.ProfileNames())
+		return 2
+	}
+
+	conn, conf, err := sf.connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Handler.Close()
+	if *interval <= 0 {
+		*interval = conf.PollInterval
+	}
+	registers := conf.Registers
+	if ok {
+		registers = p.Registers
+	}
+	regs := modbus.BuildRegisters(registers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		values, errs := modbus.ReadValues(ctx, conn.Client, regs)
+		// 清屏后从左上角重新输出
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("%s  从站 %d  %s  每 %v 刷新，Ctrl+C 退出\n\n", time.Now().Format("2006-01-02 15:04:05"),
+			conf.SlaveID, conf.Port, *interval)
+		fmt.Printf("%-10s %-16s %3s %6s  %s\n", "名称", "字段", "FC", "地址", "值")
+		for _, reg := range regs {
+			val := fmt.Sprint(values[reg.Key])
+			if err, ok := errs[reg.Key]; ok {
+				val = "错误: " + err.Error()
+			}
+			fmt.Printf("%-10s %-16s %3d %6d  %s\n", reg.Name, reg.Key, reg.Function, reg.Address, val)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 0
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"dataCollect/internal/config"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// profiles 子命令：列出内置的设备型号，指定 -name 时显示该型号的寄存器表和写命令
+func profilesCmd(args []string) int {
+	fs := flag.NewFlagSet("profiles", flag.ExitOnError)
+	name := fs.String("name", "", "显示指定型号的详细信息")
+	fs.Parse(args)
+
+	if *name == "" {
+		for _, n := range config.ProfileNames() {
+			p, _ := config.LookupProfile(n)
+			fmt.Printf("%-18s %s\n", n, p.Description)
+		}
+		return 0
+	}
+	p, ok := config.LookupProfile(*name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知的型号 %q，可选 %v\n", *name, config.ProfileNames())
+		return 1
+	}
+	cfgID := p.CfgID
+	if cfgID == "" {
+		cfgID = "(无，需要在配置中填写 cfg_id)"
+	}
+	fmt.Printf("%s  %s\n模板 ID: %s\n\n", p.Name, p.Description, cfgID)
+	fmt.Printf("%-10s %-16s %3s %6s %-8s %-5s %-6s %s\n", "名称", "字段", "FC", "地址", "类型", "字序", "缩放", "单位")
+	for _, r := range p.Registers {
+		fmt.Printf("%-10s %-16s %3d %6d %-8s %-5s %-6g %s\n", r.Name, r.Key, r.Function, r.Address, r.Type, r.WordOrder, r.Scale, r.Unit)
+	}
+	if len(p.Commands) > 0 {
+		fmt.Println("\n写命令:")
+		names := make([]string, 0, len(p.Commands))
+		for n := range p.Commands {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		for _, n := range names {
+			c := p.Commands[n]
+			fmt.Printf("  %-16s 功能码 %d 地址 %d 写入 %v\n", n, c.Function, c.Address, c.Values)
+		}
+	}
+	return 0
+}
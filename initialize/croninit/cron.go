@@ -2,19 +2,18 @@
 package croninit
 
 import (
+	"dataCollect/initialize"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/robfig/cron"
-	"github.com/sirupsen/logrus"
 )
 
 var (
-	c = cron.New()
+	c   = cron.New()
+	log = initialize.Logger("cron")
 )
 
 const (
@@ -34,13 +33,21 @@ func CronInit() {
 		}
 	})
 
+	// 每小时清理一次超过 log.maxdays 天的日志文件
 	c.AddFunc("0 */60 * * * *", func() {
-		logrus.Debug("Log File Clean:")
-		CleanupLogs()
+		log.Debug("Log File Clean:")
+		if err := initialize.CleanupLogs(); err != nil {
+			log.Error(err)
+		}
 	})
 	c.Start()
 }
 
+// 程序退出时停止定时任务
+func CronStop() {
+	c.Stop()
+}
+
 func sendHeartbeat() error {
 	// 确保目录存在
 	dir := filepath.Dir(heartbeatFile)
@@ -51,7 +58,7 @@ func sendHeartbeat() error {
 	// 创建或更新心跳文件
 	file, err := os.OpenFile(heartbeatFile, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		logrus.Errorf("打开心跳文件失败: %v", err)
+		log.Errorf("打开心跳文件失败: %v", err)
 		return err
 	}
 	defer file.Close()
@@ -59,52 +66,8 @@ func sendHeartbeat() error {
 	// 更新文件时间戳
 	now := time.Now()
 	if err := os.Chtimes(heartbeatFile, now, now); err != nil {
-		logrus.Errorf("更新心跳文件时间戳失败: %v", err)
+		log.Errorf("更新心跳文件时间戳失败: %v", err)
 		return err
 	}
 	return nil
 }
-
-func CleanupLogs() error {
-	logDir := "/mnt/data_collect/logs"
-	cutoffTime := time.Now().AddDate(0, 0, -3) // 3天前的时间
-
-	files, err := ioutil.ReadDir(logDir)
-	if err != nil {
-		return fmt.Errorf("读取目录失败: %w", err)
-	}
-
-	for _, file := range files {
-		if file.IsDir() {
-			continue // 跳过子目录
-		}
-
-		filename := file.Name()
-		// 检查文件扩展名
-		if filepath.Ext(filename) != ".log" {
-			continue
-		}
-
-		// 提取文件名中的时间部分（不含扩展名）
-		timePart := strings.TrimSuffix(filename, ".log")
-		if len(timePart) < 14 { // 确保至少包含日期和时间部分
-			continue
-		}
-
-		// 解析文件名中的时间
-		fileTime, err := time.Parse("2006-01-02-1504", timePart)
-		if err != nil {
-			continue // 跳过格式不匹配的文件
-		}
-
-		// 检查文件时间是否超过3天
-		if fileTime.Before(cutoffTime) {
-			filePath := filepath.Join(logDir, filename)
-			err := os.Remove(filePath)
-			if err != nil {
-				logrus.Errorf("CleanupLogs %s failed.", filePath)
-			}
-		}
-	}
-	return nil
-}
@@ -0,0 +1,159 @@
+package initialize
+
+import (
+	"bytes"
+	"dataCollect/internal/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 日志文件名为创建时间，同一秒内切分出多个文件时追加序号
+const logFileLayout = "2006-01-02-150405"
+
+// 切分时新文件创建失败(如存储写满)后继续写原来的文件，间隔该时间再重试
+const rotateRetryInterval = 10 * time.Second
+
+// 单条日志超过文件大小上限时截断，并在末尾追加该标记
+const truncatedMark = "...(日志过长，已截断)\n"
+
+// rotateFile 按行数和大小切分的日志文件，当前文件写满 log.maxlines 行或超过 log.maxsize 后新建一个文件
+type rotateFile struct {
+	mu       sync.Mutex
+	dir      string
+	maxLines int
+	maxSize  int64
+	file     *os.File
+	lines    int
+	size     int64
+	retryAt  time.Time
+}
+
+func newRotateFile(dir string, maxLines int, maxSize int64) (*rotateFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	r := &rotateFile{dir: dir, maxLines: maxLines, maxSize: maxSize}
+	f, err := r.create()
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	return r, nil
+}
+
+func (r *rotateFile) create() (*os.File, error) {
+	// 日志目录可能被手动删除
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	base := time.Now().Format(logFileLayout)
+	path := filepath.Join(r.dir, base+".log")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(r.dir, fmt.Sprintf("%s-%d.log", base, i))
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("创建日志文件失败: %v", err)
+	}
+	return f, nil
+}
+
+func (r *rotateFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	full := r.size >= r.maxSize
+	if (full || r.lines >= r.maxLines) && !time.Now().Before(r.retryAt) {
+		// 新文件创建成功后才关闭原来的文件，失败时继续写原来的文件
+		if f, err := r.create(); err != nil {
+			r.retryAt = time.Now().Add(rotateRetryInterval)
+			if full {
+				fmt.Fprintf(os.Stderr, "切分日志文件失败，%s 已超过大小上限，丢弃日志: %v\n", r.file.Name(), err)
+			} else {
+				fmt.Fprintf(os.Stderr, "切分日志文件失败，继续写入 %s: %v\n", r.file.Name(), err)
+			}
+		} else {
+			r.file.Close()
+			r.file, r.lines, r.size = f, 0, 0
+		}
+	}
+	// 超过大小上限又无法切分时丢弃，避免写满存储
+	if r.size >= r.maxSize {
+		return len(p), nil
+	}
+	buf := p
+	if int64(len(buf)) > r.maxSize {
+		buf = append(p[:r.maxSize:r.maxSize], truncatedMark...)
+	}
+	n, err := r.file.Write(buf)
+	r.size += int64(n)
+	r.lines += bytes.Count(buf[:n], []byte{'\n'})
+	if err != nil {
+		return min(n, len(p)), err
+	}
+	return len(p), nil
+}
+
+// 当前正在写的文件，清理旧日志时跳过
+func (r *rotateFile) current() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return ""
+	}
+	return r.file.Name()
+}
+
+func (r *rotateFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// CleanupLogs 删除日志目录中超过 log.maxdays 天没有修改过的日志文件
+func CleanupLogs() error {
+	conf := config.Get().Log
+	cutoff := time.Now().AddDate(0, 0, -conf.MaxDays)
+	var current string
+	logOutputMu.Lock()
+	if logFile != nil {
+		current = logFile.current()
+	}
+	logOutputMu.Unlock()
+
+	entries, err := os.ReadDir(conf.Path)
+	if err != nil {
+		return fmt.Errorf("读取日志目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".log" {
+			continue
+		}
+		path := filepath.Join(conf.Path, entry.Name())
+		info, err := entry.Info()
+		if err != nil || path == current || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			logrus.Errorf("CleanupLogs %s failed: %v", path, err)
+			continue
+		}
+		logrus.Debugf("删除过期日志 %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package initialize
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 切分时新文件创建失败后继续写原来的文件，之后重试切分
+func TestRotateFileCreateFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	r, err := newRotateFile(dir, 2, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	first := r.current()
+	for i := 0; i < 2; i++ {
+		if _, err := r.Write([]byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 日志目录被替换为普通文件，无法创建新文件
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("line\n")); err != nil {
+		t.Fatalf("创建新文件失败后写入: %v", err)
+	}
+	if r.current() != first || r.retryAt.IsZero() {
+		t.Fatalf("current %s retryAt %v", r.current(), r.retryAt)
+	}
+
+	// 恢复后到了重试时间切分到新文件
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	r.retryAt = time.Time{}
+	if _, err := r.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	// 原来的文件已经随目录删除，同一秒内新文件可能与它同名，按内容判断
+	data, err := os.ReadFile(r.current())
+	if err != nil || string(data) != "line\n" {
+		t.Fatalf("新文件内容 %q %v", data, err)
+	}
+}
+
+// 超过大小上限时切分，单条过长的日志截断，无法切分时丢弃
+func TestRotateFileSize(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	r, err := newRotateFile(dir, 10000, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	first := r.current()
+	line := []byte(strings.Repeat("a", 59) + "\n")
+	for i := 0; i < 2; i++ {
+		if n, err := r.Write(line); err != nil || n != len(line) {
+			t.Fatalf("write %d %v", n, err)
+		}
+	}
+	if r.current() != first {
+		t.Fatalf("未超过大小上限时切分了文件")
+	}
+
+	long := []byte(strings.Repeat("b", 300) + "\n")
+	if n, err := r.Write(long); err != nil || n != len(long) {
+		t.Fatalf("write %d %v", n, err)
+	}
+	second := r.current()
+	if second == first {
+		t.Fatalf("超过大小上限后没有切分")
+	}
+	data, err := os.ReadFile(second)
+	if err != nil || string(data) != strings.Repeat("b", 100)+truncatedMark {
+		t.Fatalf("截断后的内容 %q %v", data, err)
+	}
+
+	// 日志目录被替换为普通文件，无法创建新文件
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Write(line); err != nil || n != len(line) {
+		t.Fatalf("write %d %v", n, err)
+	}
+	if r.current() != second || r.size != int64(len(data)) {
+		t.Fatalf("current %s size %d", r.current(), r.size)
+	}
+}
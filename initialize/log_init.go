@@ -1,13 +1,16 @@
 package initialize
 
 import (
+	"dataCollect/internal/config"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
-	"time"
+	"runtime"
+	"sort"
+	"sync"
 
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type customFormatter struct {
@@ -39,57 +42,191 @@ func (*customFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	}
 
 	// 组装格式化字符串
-	msg := fmt.Sprintf("%s [%s] [%s] %s\n",
+	msg := fmt.Sprintf("%s [%s] [%s] %s",
 		levelText, // 日志级别，带颜色
 		entry.Time.Format("2006-01-02 15:04:05.9999"), // 时间戳，下划线加颜色
 		fileAndLine,   // 文件名:行号，带颜色
 		entry.Message, // 日志消息
 	)
-	return []byte(msg), nil
+	// 结构化字段按 key 排序追加在消息后面
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		msg += fmt.Sprintf(" %s=%v", k, entry.Data[k])
+	}
+	return []byte(msg + "\n"), nil
+}
+
+// json 格式的日志，文件名只保留最后一级目录，和文本格式一致
+func newJSONFormatter() *logrus.JSONFormatter {
+	return &logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02 15:04:05.9999",
+		CallerPrettyfier: func(f *runtime.Frame) (string, string) {
+			dir := filepath.Dir(f.File)
+			return "", fmt.Sprintf("%s/%s:%d", filepath.Base(dir), filepath.Base(f.File), f.Line)
+		},
+	}
+}
+
+// 每个模块使用独立的 logger，输出和格式与全局 logger 相同，只有日志级别可以单独设置
+var moduleLoggers = func() map[string]*logrus.Logger {
+	loggers := make(map[string]*logrus.Logger)
+	for _, m := range config.LogModules {
+		loggers[m] = logrus.New()
+	}
+	return loggers
+}()
+
+// Logger 返回模块专用的日志入口，每条日志都带 module 字段，
+// 日志级别由 log.modules.<module> 设置，未设置时跟随 log.level
+func Logger(module string) *logrus.Entry {
+	l, ok := moduleLoggers[module]
+	if !ok {
+		return logrus.WithField("module", module)
+	}
+	return l.WithField("module", module)
+}
+
+// 全局 logger 和所有模块 logger
+func allLoggers() []*logrus.Logger {
+	loggers := []*logrus.Logger{logrus.StandardLogger()}
+	for _, m := range config.LogModules {
+		loggers = append(loggers, moduleLoggers[m])
+	}
+	return loggers
+}
+
+var logLevels = map[string]logrus.Level{
+	"panic": logrus.PanicLevel,
+	"fatal": logrus.FatalLevel,
+	"error": logrus.ErrorLevel,
+	"warn":  logrus.WarnLevel,
+	"info":  logrus.InfoLevel,
+	"debug": logrus.DebugLevel,
+	"trace": logrus.TraceLevel,
 }
+
 func LogInIt() {
 
-	// 初始化 Logrus,不创建logrus实例，直接使用包级别的函数，这样可以在项目的任何地方使用logrus，目前不考虑多日志模块的情况
-	logrus.SetReportCaller(true)
-	logrus.SetFormatter(&customFormatter{logrus.TextFormatter{
+	// 初始化 Logrus,不创建logrus实例，直接使用包级别的函数，这样可以在项目的任何地方使用logrus。
+	// modbus、mqtt、redis、cron 模块通过 Logger 获取各自的 logger，以便单独设置日志级别
+	for _, l := range allLoggers() {
+		l.SetReportCaller(true)
+	}
+	setLogFormat()
+	setLogLevel()
+	setLogOutput()
+	if err := CleanupLogs(); err != nil {
+		logrus.Debug(err)
+	}
+
+	RegisterReloader(Reloader{
+		Name:  "log",
+		Keys:  []string{"log"},
+		Apply: reloadLog,
+	})
+	logrus.Debug("*************************** dataCollect Init Finsh**********************")
+}
+
+func setLogFormat() {
+	var formatter logrus.Formatter = &customFormatter{logrus.TextFormatter{
 		//ForceColors:   true,
 		FullTimestamp: true,
-	}})
-
-	var logLevels = map[string]logrus.Level{
-		"panic": logrus.PanicLevel,
-		"fatal": logrus.FatalLevel,
-		"error": logrus.ErrorLevel,
-		"warn":  logrus.WarnLevel,
-		"info":  logrus.InfoLevel,
-		"debug": logrus.DebugLevel,
-		"trace": logrus.TraceLevel,
-	}
-
-	levelStr := viper.GetString("log.level")
-	if level, ok := logLevels[levelStr]; ok {
-		logrus.SetLevel(level)
-	} else {
+	}}
+	if config.Get().Log.Format == "json" {
+		formatter = newJSONFormatter()
+	}
+	for _, l := range allLoggers() {
+		l.SetFormatter(formatter)
+	}
+}
+
+// setLogLevel 按配置设置日志级别，通过命令临时修改的级别优先于配置
+func setLogLevel() {
+	conf := config.Get().Log
+	level, ok := logLevels[conf.Level]
+	if !ok {
 		logrus.Error("Invalid log level in config, setting to default level")
-		logrus.SetLevel(logrus.InfoLevel) // 设置默认级别
-	}
-	// 设置日志输出到文件
-	currentTime := time.Now().Format("2006-01-02-1504") // 格式化为年月日时分
-	path := viper.GetString("log.path")
-	var logPath string
-	if path == "" {
-		logPath = filepath.Join("logs", currentTime+".log")
-	} else {
-		logPath = filepath.Join(path, currentTime+".log")
-	}
-
-	logrus.SetOutput(&lumberjack.Logger{
-		Filename:   logPath, // 日志文件路径
-		MaxSize:    20,      // 每个日志文件的最大大小，单位为MB
-		MaxBackups: 5,       // 保留旧日志文件的最大数量
-		MaxAge:     30,      // 保留旧日志文件的最大天数
-		Compress:   true,    // 是否压缩旧日志文件
-	})
+		level = logrus.InfoLevel // 设置默认级别
+	}
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	global, hasGlobal := overrides[""]
+	if hasGlobal {
+		level = global.level
+	}
+	logrus.SetLevel(level)
+	for _, m := range config.LogModules {
+		moduleLevel := level
+		if l, ok := logLevels[conf.Modules[m]]; ok && !hasGlobal {
+			moduleLevel = l
+		}
+		if o, ok := overrides[m]; ok {
+			moduleLevel = o.level
+		}
+		moduleLoggers[m].SetLevel(moduleLevel)
+	}
+}
 
-	logrus.Debug("*************************** dataCollect Init Finsh**********************")
+// 当前的日志文件，修改输出方式或日志目录后关闭旧文件
+var (
+	logOutputMu sync.Mutex
+	logFile     *rotateFile
+)
+
+// setLogOutput 按 log.adapter_type 设置输出：0 控制台，1 文件，2 文件和控制台。
+// 日志文件打不开时退回到控制台输出
+func setLogOutput() {
+	conf := config.Get().Log
+	var file *rotateFile
+	var fileErr error
+	if conf.AdapterType != 0 {
+		file, fileErr = newRotateFile(conf.Path, conf.MaxLines, int64(conf.MaxSize)<<20)
+	}
+	var out io.Writer = os.Stdout
+	switch {
+	case file == nil:
+	case conf.AdapterType == 2:
+		out = io.MultiWriter(os.Stdout, file)
+	default:
+		out = file
+	}
+	for _, l := range allLoggers() {
+		l.SetOutput(out)
+	}
+
+	logOutputMu.Lock()
+	old := logFile
+	logFile = file
+	logOutputMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	if fileErr != nil {
+		logrus.Errorf("日志改为输出到控制台: %v", fileErr)
+	}
+}
+
+// CloseLog 程序退出时关闭日志文件
+func CloseLog() {
+	logOutputMu.Lock()
+	defer logOutputMu.Unlock()
+	if logFile != nil {
+		logFile.Close()
+	}
+}
+
+func reloadLog(changed []string) error {
+	for _, k := range changed {
+		if k == "log.path" || k == "log.adapter_type" || k == "log.maxlines" || k == "log.maxsize" {
+			setLogOutput()
+			break
+		}
+	}
+	setLogFormat()
+	setLogLevel()
+	return nil
 }
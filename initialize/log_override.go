@@ -0,0 +1,121 @@
+package initialize
+
+import (
+	"dataCollect/internal/config"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 临时修改的日志级别，到期后恢复为配置文件中的级别，不自动恢复时 timer 为 nil
+type levelOverride struct {
+	level   logrus.Level
+	expires time.Time
+	timer   *time.Timer
+}
+
+var (
+	overrideMu sync.Mutex
+	// key 为模块名，空字符串表示全局级别
+	overrides = make(map[string]*levelOverride)
+)
+
+// MaxLogOverride 临时修改日志级别的最长时间，避免忘记恢复导致 debug 日志写满存储
+const MaxLogOverride = 24 * time.Hour
+
+// OverrideLogLevel 修改日志级别，d 大于 0 时 d 之后自动恢复，为 0 时一直有效直到 ResetLogLevel。
+// module 为空时修改全局级别，同时覆盖 log.modules 中单独设置的级别
+func OverrideLogLevel(module, level string, d time.Duration) error {
+	if module == "global" {
+		module = ""
+	}
+	l, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("无效的日志级别 %q", level)
+	}
+	if module != "" && !slices.Contains(config.LogModules, module) {
+		return fmt.Errorf("未知的模块 %q，可选 %v", module, config.LogModules)
+	}
+	if d < 0 || d > MaxLogOverride {
+		return fmt.Errorf("持续时间不能小于 0 或超过 %v", MaxLogOverride)
+	}
+
+	overrideMu.Lock()
+	if old, ok := overrides[module]; ok {
+		old.stop()
+	}
+	o := &levelOverride{level: l}
+	if d > 0 {
+		o.expires = time.Now().Add(d)
+		o.timer = time.AfterFunc(d, func() { revertLogLevel(module, o) })
+	}
+	overrides[module] = o
+	overrideMu.Unlock()
+
+	setLogLevel()
+	if d > 0 {
+		logrus.Infof("日志级别临时修改为 %s (模块 %q)，%v 后恢复", level, module, d)
+	} else {
+		logrus.Infof("日志级别修改为 %s (模块 %q)，不自动恢复", level, module)
+	}
+	return nil
+}
+
+// ResetLogLevel 取消临时修改，立即恢复配置文件中的级别
+func ResetLogLevel(module string) {
+	if module == "global" {
+		module = ""
+	}
+	overrideMu.Lock()
+	if o, ok := overrides[module]; ok {
+		o.stop()
+		delete(overrides, module)
+	}
+	overrideMu.Unlock()
+	setLogLevel()
+}
+
+func (o *levelOverride) stop() {
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+}
+
+func revertLogLevel(module string, o *levelOverride) {
+	overrideMu.Lock()
+	// 期间又被修改过时由新的定时器负责恢复
+	if overrides[module] != o {
+		overrideMu.Unlock()
+		return
+	}
+	delete(overrides, module)
+	overrideMu.Unlock()
+	setLogLevel()
+	logrus.Infof("模块 %q 的日志级别已恢复为配置文件中的级别", module)
+}
+
+// LogLevelStatus 当前各模块生效的日志级别以及临时修改的到期时间，全局级别的 key 为 global，
+// 不自动恢复的到期时间为 never
+func LogLevelStatus() map[string]interface{} {
+	status := map[string]interface{}{"global": logrus.GetLevel().String()}
+	for _, m := range config.LogModules {
+		status[m] = moduleLoggers[m].GetLevel().String()
+	}
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	expires := make(map[string]string)
+	for m, o := range overrides {
+		if m == "" {
+			m = "global"
+		}
+		if o.timer == nil {
+			expires[m] = "never"
+			continue
+		}
+		expires[m] = o.expires.Format(time.RFC3339)
+	}
+	return map[string]interface{}{"levels": status, "expires": expires}
+}
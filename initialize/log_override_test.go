@@ -0,0 +1,52 @@
+package initialize
+
+import (
+	"dataCollect/internal/config"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestOverrideLogLevel(t *testing.T) {
+	config.Set(&config.Config{Log: config.Log{Level: "info", Modules: map[string]string{"modbus": "warn"}}})
+	defer ResetLogLevel("global")
+	defer ResetLogLevel("mqtt")
+
+	// 不填持续时间时一直有效
+	if err := OverrideLogLevel("mqtt", "debug", 0); err != nil {
+		t.Fatal(err)
+	}
+	if l := moduleLoggers["mqtt"].GetLevel(); l != logrus.DebugLevel {
+		t.Errorf("mqtt 级别 %v", l)
+	}
+	if e := LogLevelStatus()["expires"].(map[string]string)["mqtt"]; e != "never" {
+		t.Errorf("expires %q", e)
+	}
+
+	// 到期后恢复，全局修改同时覆盖模块单独设置的级别
+	if err := OverrideLogLevel("global", "trace", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if logrus.GetLevel() != logrus.TraceLevel || moduleLoggers["modbus"].GetLevel() != logrus.TraceLevel {
+		t.Errorf("全局修改后 %v %v", logrus.GetLevel(), moduleLoggers["modbus"].GetLevel())
+	}
+	time.Sleep(200 * time.Millisecond)
+	if logrus.GetLevel() != logrus.InfoLevel || moduleLoggers["modbus"].GetLevel() != logrus.WarnLevel {
+		t.Errorf("到期后 %v %v", logrus.GetLevel(), moduleLoggers["modbus"].GetLevel())
+	}
+	if l := moduleLoggers["mqtt"].GetLevel(); l != logrus.DebugLevel {
+		t.Errorf("全局恢复后 mqtt 级别 %v", l)
+	}
+
+	ResetLogLevel("mqtt")
+	if l := moduleLoggers["mqtt"].GetLevel(); l != logrus.InfoLevel {
+		t.Errorf("reset 后 mqtt 级别 %v", l)
+	}
+
+	for _, d := range []time.Duration{-time.Minute, MaxLogOverride + time.Minute} {
+		if err := OverrideLogLevel("mqtt", "debug", d); err == nil {
+			t.Errorf("持续时间 %v 应当返回错误", d)
+		}
+	}
+}
@@ -2,36 +2,46 @@ package initialize
 
 import (
 	"context"
-	"fmt"
+	"dataCollect/internal/config"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
-	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
-type RedisConfig struct {
-	Addr     string
-	Password string
-	DB       int
-}
+// redis 是可选依赖：启动时连不上不影响采集，后台按 db.redis.check_interval 检查连接，
+// 断开和恢复时各记录一次日志
+var (
+	redisMu     sync.RWMutex
+	redisClient *redis.Client
+	redisUp     bool
+	// 当前客户端是否已经检查过，第一次检查失败时也要记录一次日志
+	redisChecked bool
+	// 替换客户端时通知检查协程重新检查
+	redisChanged = make(chan struct{}, 1)
+)
 
-var Redis *redis.Client
+var redisLog = Logger("redis")
 
-func RedisInit() error {
-	conf, err := loadConfig()
-	if err != nil {
-		return fmt.Errorf("加载redis配置失败:%v", err)
-	}
-	client := connectRedis(conf)
-	if checkRedisClient(client) != nil {
-		return fmt.Errorf("连接redis失败:%v", err)
-	}
+// 单次检查的超时，redis 在本机，超过这个时间基本可以认为不可用
+const redisPingTimeout = 2 * time.Second
 
-	Redis = client
-	return nil
+func RedisInit(ctx context.Context) {
+	conf := config.Get().DB.Redis
+	redisMu.Lock()
+	redisClient = connectRedis(&conf)
+	redisMu.Unlock()
+	checkRedisClient(ctx)
+
+	RegisterReloader(Reloader{
+		Name:  "redis",
+		Keys:  []string{"db.redis"},
+		Apply: reloadRedis,
+	})
+	go watchRedis(ctx)
 }
 
-func connectRedis(conf *RedisConfig) *redis.Client {
+func connectRedis(conf *config.Redis) *redis.Client {
 
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     conf.Addr,
@@ -42,26 +52,86 @@ func connectRedis(conf *RedisConfig) *redis.Client {
 
 	return redisClient
 }
-func checkRedisClient(redisClient *redis.Client) error {
-	// 通过 cient.Ping() 来检查是否成功连接到了 redis 服务器
-	_, err := redisClient.Ping(context.Background()).Result()
-	if err != nil {
-		return err
-	} else {
-		logrus.Debug("连接redis成完成...")
-		return nil
+
+// checkRedisClient 通过 Ping 检查 redis 是否可用，状态变化时记录日志
+func checkRedisClient(ctx context.Context) bool {
+	redisMu.RLock()
+	client := redisClient
+	wasUp, checked := redisUp, redisChecked
+	redisMu.RUnlock()
+
+	pctx, cancel := context.WithTimeout(ctx, redisPingTimeout)
+	defer cancel()
+	err := client.Ping(pctx).Err()
+	if ctx.Err() != nil {
+		return wasUp
 	}
+	up := err == nil
+
+	redisMu.Lock()
+	// 检查期间客户端被替换时以下一次检查为准
+	if client == redisClient {
+		redisUp = up
+		redisChecked = true
+	}
+	redisMu.Unlock()
+	switch {
+	case up && !wasUp:
+		redisLog.WithField("addr", client.Options().Addr).Info("连接redis成功")
+	case !up && (wasUp || !checked):
+		redisLog.WithField("addr", client.Options().Addr).WithError(err).Error("redis 不可用，后台继续重连")
+	case !up:
+		redisLog.WithField("addr", client.Options().Addr).WithError(err).Debug("redis 仍不可用")
+	}
+	return up
 }
 
-func loadConfig() (*RedisConfig, error) {
-	redisConfig := &RedisConfig{
-		Addr:     viper.GetString("db.redis.addr"),
-		Password: viper.GetString("db.redis.password"),
-		DB:       viper.GetInt("db.redis.db"),
+func watchRedis(ctx context.Context) {
+	ticker := time.NewTicker(config.Get().DB.Redis.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-redisChanged:
+			ticker.Reset(config.Get().DB.Redis.CheckInterval)
+		case <-ctx.Done():
+			return
+		}
+		checkRedisClient(ctx)
 	}
+}
+
+// RedisClient 返回 redis 客户端以及 redis 当前是否可用，不可用时调用方应直接跳过读取，
+// 否则每次都要等到连接超时
+func RedisClient() (*redis.Client, bool) {
+	redisMu.RLock()
+	defer redisMu.RUnlock()
+	return redisClient, redisUp
+}
+
+// 配置热加载：地址、密码或库号变化后更换客户端
+func reloadRedis(changed []string) error {
+	conf := config.Get().DB.Redis
+	redisMu.Lock()
+	old := redisClient
+	redisClient = connectRedis(&conf)
+	// 新客户端需要重新检查，在此之前按已断开处理
+	redisUp = false
+	redisChecked = false
+	redisMu.Unlock()
+	old.Close()
+	select {
+	case redisChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
 
-	if redisConfig.Addr == "" {
-		redisConfig.Addr = "localhost:6379"
+// RedisClose 程序退出时关闭 redis 连接
+func RedisClose() {
+	redisMu.Lock()
+	defer redisMu.Unlock()
+	if redisClient != nil {
+		redisClient.Close()
 	}
-	return redisConfig, nil
 }
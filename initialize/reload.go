@@ -0,0 +1,229 @@
+package initialize
+
+import (
+	"bytes"
+	"dataCollect/internal/config"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Reloader 描述一个支持热加载的子模块
+type Reloader struct {
+	Name string
+	// 关注的配置前缀(如 "mqtt")，只有这些配置发生变化时才会调用 Apply
+	Keys []string
+	// 新配置已通过校验并生效后调用，changed 为该模块下发生变化的 key
+	Apply func(changed []string) error
+}
+
+var (
+	reloadMu  sync.Mutex
+	reloaders []Reloader
+)
+
+// 文件变化后等待一段时间再加载，编辑器保存时往往会连续触发多次写事件
+const reloadDebounce = 500 * time.Millisecond
+
+// 注意: 配置中的这些 key 不会明文打印到日志
+var secretKeys = []string{"pass", "password"}
+
+func RegisterReloader(r Reloader) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloaders = append(reloaders, r)
+}
+
+// WatchConfig 监听配置文件变化以及 SIGHUP 信号，触发配置热加载
+func WatchConfig(path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logrus.Info("收到 SIGHUP，重新加载配置")
+			if err := ReloadConfig(path); err != nil {
+				logrus.Errorf("配置重载失败: %v", err)
+			}
+		}
+	}()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.Errorf("创建配置文件监听失败: %v", err)
+		return
+	}
+	// 监听目录而不是文件，很多编辑器保存时会先删除再重建文件
+	absPath, _ := filepath.Abs(path)
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		logrus.Errorf("监听配置目录失败: %v", err)
+		watcher.Close()
+		return
+	}
+	go func() {
+		defer watcher.Close()
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != absPath {
+					continue
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDebounce, func() {
+					logrus.Infof("配置文件 %s 已变化，重新加载配置", path)
+					if err := ReloadConfig(path); err != nil {
+						logrus.Errorf("配置重载失败: %v", err)
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("配置文件监听错误: %v", err)
+			}
+		}
+	}()
+}
+
+// ReloadConfig 读取并校验新配置，校验通过后替换全局配置，并通知配置发生变化的模块
+func ReloadConfig(path string) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, content, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, issues := config.Load(next)
+	for _, issue := range issues {
+		if issue.Warning {
+			logrus.Warn(issue)
+		} else {
+			logrus.Error(issue)
+		}
+	}
+	if config.HasError(issues) {
+		return fmt.Errorf("新配置校验失败，继续使用旧配置")
+	}
+
+	oldSettings := flattenSettings("", viper.AllSettings())
+	newSettings := flattenSettings("", next.AllSettings())
+	changed := diffSettings(oldSettings, newSettings)
+	if len(changed) == 0 {
+		logrus.Info("配置没有变化")
+		return nil
+	}
+	logConfigDiff(changed, oldSettings, newSettings)
+
+	if err := viper.ReadConfig(bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("应用配置失败: %w", err)
+	}
+	config.Set(cfg)
+	for _, r := range reloaders {
+		keys := matchKeys(changed, r.Keys)
+		if len(keys) == 0 || r.Apply == nil {
+			continue
+		}
+		if err := r.Apply(keys); err != nil {
+			logrus.Errorf("%s 应用新配置失败: %v", r.Name, err)
+			continue
+		}
+		logrus.Infof("%s 已应用新配置", r.Name)
+	}
+	return nil
+}
+
+// 把嵌套的配置展开为 a.b.c 形式的 key
+func flattenSettings(prefix string, settings map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range settings {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			for sk, sv := range flattenSettings(key, sub) {
+				out[sk] = sv
+			}
+			continue
+		}
+		out[key] = v
+	}
+	return out
+}
+
+func diffSettings(oldSettings, newSettings map[string]interface{}) []string {
+	var changed []string
+	for k, v := range newSettings {
+		if ov, ok := oldSettings[k]; !ok || !reflect.DeepEqual(ov, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range oldSettings {
+		if _, ok := newSettings[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func logConfigDiff(changed []string, oldSettings, newSettings map[string]interface{}) {
+	for _, k := range changed {
+		ov, hasOld := oldSettings[k]
+		nv, hasNew := newSettings[k]
+		if isSecretKey(k) {
+			ov, nv = "******", "******"
+		}
+		switch {
+		case !hasOld:
+			logrus.Infof("配置新增 %s = %v", k, nv)
+		case !hasNew:
+			logrus.Infof("配置删除 %s (原值 %v)", k, ov)
+		default:
+			logrus.Infof("配置修改 %s: %v -> %v", k, ov, nv)
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	last := key[strings.LastIndex(key, ".")+1:]
+	for _, s := range secretKeys {
+		if last == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchKeys(changed []string, prefixes []string) []string {
+	var keys []string
+	for _, k := range changed {
+		for _, p := range prefixes {
+			if k == p || strings.HasPrefix(k, p+".") {
+				keys = append(keys, k)
+				break
+			}
+		}
+	}
+	return keys
+}
@@ -1,17 +1,18 @@
 package initialize
 
 import (
+	"bytes"
+	"dataCollect/internal/config"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
 func ViperInit(path string) {
-	viper.SetEnvPrefix("GOTP")
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	bindEnv(viper.GetViper())
 
 	if path != "" {
 		viper.SetConfigFile(path)
@@ -25,5 +26,45 @@ func ViperInit(path string) {
 	if err != nil {
 		panic(fmt.Errorf("failed to read configuration file: %s", err))
 	}
+	cfg, issues := config.Load(viper.GetViper())
+	for _, issue := range issues {
+		log.Println(issue)
+	}
+	if config.HasError(issues) {
+		panic(fmt.Errorf("配置文件校验失败，可执行 data_collect check-config -config %s 查看详情", path))
+	}
+	config.Set(cfg)
 	log.Println("viper加载conf.yml配置文件完成...")
 }
+
+// LoadConfigFile 读取并校验指定的配置文件，不影响当前生效的配置
+func LoadConfigFile(path string) (*config.Config, []config.Issue, error) {
+	v, _, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, issues := config.Load(v)
+	return cfg, issues, nil
+}
+
+// 读取配置文件到独立的 viper 实例，同时返回文件内容
+func readConfigFile(path string) (*viper.Viper, []byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	v := viper.New()
+	bindEnv(v)
+	v.SetConfigType("yml")
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	return v, content, nil
+}
+
+// 环境变量 GOTP_XXX_YYY 可以覆盖配置文件中的 xxx.yyy
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix("GOTP")
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+}
@@ -3,13 +3,22 @@ package modbus
 import (
 	"context"
 	"dataCollect/initialize"
+	"dataCollect/internal/alarm"
+	"dataCollect/internal/calibration"
+	"dataCollect/internal/config"
+	"dataCollect/internal/derived"
+	"dataCollect/internal/et0"
+	"dataCollect/internal/history"
+	"dataCollect/internal/solar"
+	"dataCollect/mqtt/command"
 	"dataCollect/mqtt/publish"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
-	"os"
-	"os/signal"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/goburrow/modbus"
@@ -18,148 +27,265 @@ import (
 
 // 寄存器信息结构体
 type Register struct {
-	Name    string                            // 寄存器名称
-	Address uint16                            // 起始地址
-	Length  uint16                            // 读取的寄存器数量
-	Handler func([]byte) (interface{}, error) // 处理读取数据的函数
+	Name     string                            // 寄存器名称
+	Key      string                            // 上报 json 中的字段名
+	Function int                               // 读功能码 3 保持寄存器 4 输入寄存器
+	Address  uint16                            // 起始地址
+	Length   uint16                            // 读取的寄存器数量
+	Unit     string                            // 实际值的单位
+	Handler  func([]byte) (interface{}, error) // 处理读取数据的函数
 }
 
-// 定义气象站设备监控的字段
-type WeatherSt struct {
-	WindSpeed      float32 `json:"wind_speed"`
-	WindDirection  int     `json:"wind_direction"`
-	Humidity       float32 `json:"humidity"`
-	Temperature    float32 `json:"temperature"`
-	Rainfall       float32 `json:"rainfall"`
-	SolarRadiation float32 `json:"solarRadiation"`
-}
-
-type AtributeSt struct {
-	Latitude     string `json:"latitude"`
-	Longitude    string `json:"longitude"`
-	Signal       string `json:"signal"`
-	ModelVersion string `json:"modelVersion"`
-	Network      string `json:"network"`
-}
-
-var modbusClient modbus.Client
+var bus *Bus
 
-// 定义要读取的寄存器列表
-var registers = []Register{
-	{"风速", 500, 1, handlerWindSpeed}, // 读取地址 0x0000 开始的 2 个寄存器
-	{"风向", 503, 1, handlerWindDirection},
-	{"湿度", 504, 1, handlerHumidity},
-	{"温度", 505, 1, handlerTemperature},
-	{"雨量", 513, 1, handlerRainfall},
-	{"太阳辐射", 515, 1, handlerSolarRadiation},
-}
+var log = initialize.Logger("modbus")
 
 var MacAddr = "0F0F0F0F0F0F"                       // 气象监控站的设备ID针对每个路由器都是唯一的
-var cfgID = "964d6220-ecbf-a043-1960-85b1a2758cea" // 气象监控站的模板ID
+var cfgID = "964d6220-ecbf-a043-1960-85b1a2758cea" // 平台模板ID，启动时按 modbus.cfg_id 或型号中的模板确定
 
-func ModbusInit() error {
-	// 创建 Modbus RTU 客户端
-	handler := modbus.NewRTUClientHandler("/dev/ttyS1")
-	handler.BaudRate = 4800
-	handler.DataBits = 8
-	handler.Parity = "N"
-	handler.StopBits = 1
+// 采集循环和属性上报循环，退出时等待它们结束
+var loopsWg sync.WaitGroup
 
-	handler.SlaveId = 1
-	handler.Timeout = time.Second * 1
+func ModbusInit(ctx context.Context) error {
+	conf := config.Get().Modbus
+	gateway = config.Get().Gateway
+	cfgID = conf.CfgID
+	currentCfg = loadCollectConfig(&conf)
+	initialize.RegisterReloader(initialize.Reloader{
+		Name:  "modbus",
+		Keys:  []string{"modbus"},
+		Apply: reloadModbus,
+	})
 
-	// 连接 Modbus
-	err := handler.Connect()
-	if err != nil {
-		logrus.Errorf("Modbus 连接失败: %v", err)
-		return err
+	// 开启自动探测时先使用上次探测的结果，采集循环开始时再探测，不阻塞设备注册和命令订阅
+	params := paramsFromConfig(&conf)
+	if conf.AutoDetect.Enabled {
+		if saved, err := loadSavedParams(conf.AutoDetect.StateFile); err == nil {
+			params = *saved
+		}
+	}
+	setActiveParams(params)
+
+	// 创建 Modbus RTU 客户端，串口打开失败时采集循环会按退避时间自动重试
+	bus = NewBus(params.apply(conf), publishBusEvent)
+	var err error
+	if conf.AutoDetect.Enabled {
+		bus.Suspend()
+	} else if err = bus.Open(ctx); err != nil {
+		log.Errorf("Modbus 连接失败: %v", err)
 	}
-	defer handler.Close()
 
-	modbusClient = modbus.NewClient(handler)
 	// 创建气象站设备，可以重复发送，因为服务器端有去重判断
-	RegisterDev()
+	RegisterDev(ctx)
+	publishStatus(ctx, true)
+	// 订阅平台下发的命令
+	registerCommands()
+	if err := command.Start(ctx, genCommandTopic(), genCommandResponseTopic()); err != nil {
+		log.Errorf("订阅命令主题失败: %v", err)
+	}
 
 	// 进入数据读取循环
-	go ModbusLoop()
-	go attributesLoop()
-	return nil
+	loopsWg.Add(2)
+	go func() {
+		defer loopsWg.Done()
+		ModbusLoop(ctx)
+	}()
+	go func() {
+		defer loopsWg.Done()
+		attributesLoop(ctx)
+	}()
+	return err
 }
-func attributesLoop() {
-	ticker := time.NewTicker(1 * time.Minute)
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	for {
-		select {
-		case <-ticker.C:
-			ReportAttributes()
-		case <-quit:
-			ticker.Stop()
-			return
-		}
+
+// Wait 等待采集循环退出，需先取消 ModbusInit 传入的 ctx
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		loopsWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
-func ReportAttributes() {
-	var reportSt AtributeSt
-	// 1. 获取GPS
-	dataGps, err := initialize.Redis.HGetAll(context.Background(), "gps_data").Result()
-	if err != nil {
-		logrus.Error("gps_data err:%v", err)
+
+// Close 关闭串口
+func Close() {
+	if bus != nil {
+		bus.Close()
+	}
+}
+
+// PublishOffline 程序退出前上报离线状态，不经过发布队列
+func PublishOffline(ctx context.Context) error {
+	return publishStatus(ctx, false)
+}
+
+// 上报设备在线状态，1 在线 0 离线，网关模式下同时上报各子设备的状态
+func publishStatus(ctx context.Context, online bool) error {
+	payload := []byte("0")
+	if online {
+		payload = []byte("1")
 	}
-	if val, ok := dataGps["latitude"]; ok {
-		reportSt.Latitude = val
+	if gatewayMode() {
+		payload = gatewayStatus(online)
 	}
-	if val, ok := dataGps["longitude"]; ok {
-		reportSt.Longitude = val
+	if online {
+		return publish.PublishMessage(ctx, genStatusTopic(), payload)
+	}
+	return publish.PublishSync(ctx, genStatusTopic(), payload)
+}
+
+type eventSt struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// 上报总线断开/恢复事件
+func publishBusEvent(ctx context.Context, up bool, failures int, err error) {
+	ev := eventSt{Method: "bus_up", Params: map[string]interface{}{
+		"port": config.Get().Modbus.Port,
+	}}
+	if !up {
+		ev.Method = "bus_down"
+		ev.Params["failures"] = failures
+		ev.Params["error"] = err.Error()
 	}
-	// 2. 获取4G
-	dataModem, err := initialize.Redis.HGetAll(context.Background(), "modem_data").Result()
+	payload, err := json.Marshal(ev)
 	if err != nil {
-		logrus.Error("modem_data err:%v", err)
+		log.WithError(err).Errorf("序列化 %s 事件失败", ev.Method)
+		return
 	}
-	if val, ok := dataModem["signal"]; ok {
-		reportSt.Signal = val
+	publish.PublishMessage(ctx, genEventTopic(), payload)
+}
+
+// publishAlarms 按告警规则检查本次采集的数据，告警产生和解除时上报到 alarm 主题
+func publishAlarms(ctx context.Context, dev *device, ts time.Time, values map[string]interface{}) {
+	id := ""
+	if gatewayMode() {
+		id = dev.ID
 	}
-	if val, ok := dataModem["modelVersion"]; ok {
-		reportSt.ModelVersion = val
+	for _, ev := range alarm.Evaluate(ctx, id, ts, values) {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			log.WithError(err).Error("序列化告警事件失败")
+			continue
+		}
+		publish.PublishMessage(ctx, genAlarmTopic(), payload)
 	}
-	if val, ok := dataModem["network"]; ok {
-		reportSt.Network = val
+}
+
+// writeCommand 执行设备型号中定义的写命令
+func writeCommand(ctx context.Context, dev *device, name string) error {
+	cmd, ok := dev.Commands[name]
+	if !ok {
+		return fmt.Errorf("%s 的型号中没有定义命令 %q", dev.Name, name)
 	}
-	payload, err := json.Marshal(reportSt)
+	err := bus.DoSlave(ctx, dev.SlaveID, func(client modbus.Client) error {
+		var err error
+		switch cmd.Function {
+		case 5:
+			value := uint16(0x0000)
+			if cmd.Values[0] != 0 {
+				value = 0xFF00
+			}
+			_, err = client.WriteSingleCoil(cmd.Address, value)
+		case 6:
+			_, err = client.WriteSingleRegister(cmd.Address, cmd.Values[0])
+		case 16:
+			data := make([]byte, 2*len(cmd.Values))
+			for i, v := range cmd.Values {
+				binary.BigEndian.PutUint16(data[2*i:], v)
+			}
+			_, err = client.WriteMultipleRegisters(cmd.Address, uint16(len(cmd.Values)), data)
+		default:
+			err = fmt.Errorf("不支持的功能码 %d", cmd.Function)
+		}
+		return err
+	})
 	if err != nil {
-		logrus.Debugf("json Marshal err:%v\n", err)
-		return
+		return err
 	}
-	publish.PublishMessage(genAttributesTopic(), payload)
-}
-func resetRainfall() error {
-	// 使用功能码 0x06 (写单个寄存器)
-	// 地址 6002H (24578 十进制)
-	// 写入值 0x5A (10 十进制)
-	modbusClient.WriteSingleRegister(24578, 90)
-	logrus.Debug("resetRainfall Send Succeed.")
+	log.WithField("device", dev.slaveID()).Debugf("%s Send Succeed.", name)
 	return nil
 }
-func ModbusLoop() {
-	ticker := time.NewTicker(10 * time.Second)
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	count := 0
+
+// ModbusLoop 按采集分组的周期轮流采集，分组配置变化时重新调度
+func ModbusLoop(ctx context.Context) {
+	if config.Get().Modbus.AutoDetect.Enabled {
+		detectSerial(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	sched := newScheduler(getConfig(), nil)
+	timer := time.NewTimer(0)
+	//定时30min 发送雨量清0
+	rainTicker := time.NewTicker(30 * time.Minute)
+	defer timer.Stop()
+	defer rainTicker.Stop()
+	failures := 0
+	var failedSince time.Time
 	for {
 		select {
-		case <-ticker.C:
-			readData()
-			count++
-			//定时30min 发送雨量清0
-			if count == 180 { // 10 * 180 = 1800s = 30min
-				if err := resetRainfall(); err != nil {
-					logrus.Error("雨量清零失败: ", err)
+		case <-timer.C:
+			if g := sched.pick(time.Now()); g != nil {
+				ok := readGroup(ctx, g)
+				if ctx.Err() != nil {
+					return
+				}
+				sched.finish(ctx, g, time.Now())
+				if ok {
+					failures = 0
+				} else {
+					if failures == 0 {
+						failedSince = time.Now()
+					}
+					failures++
+				}
+				// 连续读不到数据时可能是更换了传感器，重新探测串口参数。
+				// 有短周期的分组时按 retry_after 个 poll_interval 的时长判断
+				ad := config.Get().Modbus.AutoDetect
+				if ad.Enabled && ad.RetryAfter > 0 && failures >= ad.RetryAfter &&
+					time.Since(failedSince) >= time.Duration(ad.RetryAfter-1)*getConfig().PollInterval {
+					log.Warnf("连续读取失败，重新探测串口参数")
+					detectSerial(ctx)
+					failures = 0
+				}
+			}
+			timer.Reset(sched.wait(time.Now()))
+		case <-rainTicker.C:
+			for _, dev := range getConfig().Devices {
+				cmd, ok := dev.Commands["reset_rainfall"]
+				if !ok {
+					continue
+				}
+				if err := writeCommand(ctx, dev, "reset_rainfall"); err != nil {
+					log.WithFields(logrus.Fields{
+						"device":     dev.slaveID(),
+						"register":   cmd.Address,
+						"error_code": ErrorCode(err),
+					}).Error("雨量清零失败: ", err)
+				}
+			}
+		case <-intervalChanged:
+			sched = newScheduler(getConfig(), sched)
+			resetLatest()
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
 				}
-				count = 0 // 重置计数器
 			}
-		case <-quit:
-			ticker.Stop()
+			timer.Reset(sched.wait(time.Now()))
+		case <-devicesChanged:
+			if gatewayMode() {
+				RegisterDev(ctx)
+			}
+		case <-ctx.Done():
 			return
 		}
 	}
@@ -169,146 +295,235 @@ type RegisterSt struct {
 	CfgID string `json:"cfgID"`
 	Mac   string `json:"mac"`
 	Name  string `json:"name"`
+	// 网关模式下的子设备
+	SubDevices []subDeviceSt `json:"sub_devices,omitempty"`
+}
+
+type subDeviceSt struct {
+	ID      string `json:"id"`
+	CfgID   string `json:"cfgID"`
+	Name    string `json:"name"`
+	SlaveID int    `json:"slaveId"`
 }
 
-func RegisterDev() {
+func RegisterDev(ctx context.Context) {
 	topic := "devices/register"
 	var dev RegisterSt
 	dev.CfgID = cfgID
 	addr, err := getMACAddress("eth0")
 	if err != nil {
-		logrus.Errorf("getMACAddresserr:%v ", err)
+		log.Errorf("getMACAddresserr:%v ", err)
 	}
 	if addr != "" {
 		MacAddr = addr
 	}
 	dev.Mac = MacAddr
 	dev.Name = "气象监控站"
+	// 网关模式下注册网关本身，总线上的设备作为子设备
+	if gatewayMode() {
+		dev.CfgID = gateway.CfgID
+		dev.Name = gateway.Name
+		for _, d := range getConfig().Devices {
+			dev.SubDevices = append(dev.SubDevices, subDeviceSt{ID: d.ID, CfgID: d.CfgID, Name: d.Name, SlaveID: d.slaveID()})
+		}
+	}
 	payload, err := json.Marshal(dev)
 	if err != nil {
-		logrus.Printf("json Marshal err:%v\n", err)
-
+		log.WithError(err).Error("序列化注册信息失败")
+		return
 	}
-	publish.PublishMessage(topic, payload)
+	publish.PublishMessage(ctx, topic, payload)
 }
-func readData() {
-	fileVale := make(map[string]interface{})
-	// 读取每个寄存器并输出结果
-	for _, reg := range registers {
-		//logrus.Printf("读取 %s (地址: 0x%04X, 长度: %d)...\n", reg.Name, reg.Address, reg.Length)
-		results, err := modbusClient.ReadHoldingRegisters(reg.Address, reg.Length)
-		if err != nil {
-			logrus.Errorf("读取 %s 失败: %v", reg.Name, err)
-			continue
-		}
 
-		// 解析结果
-		for i := 0; i < len(results); i += 2 {
-			value, err := reg.Handler(results)
-			if err != nil {
-				logrus.Warnf("解析 %s 失败: %v", reg.Name, err)
-				continue
-			}
-			fileVale[reg.Name] = value
-			logrus.Debugf("  %s: %v", reg.Name, value)
+// 探测串口参数，探测期间暂停总线上的其他读写。探测到新的组合后保存并重新打开串口，
+// 失败时继续使用当前的参数
+func detectSerial(ctx context.Context) {
+	conf := config.Get().Modbus
+	bus.Suspend()
+	params, err := DetectSerial(ctx, &conf)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Errorf("自动探测串口参数失败，继续使用 %s: %v", ActiveSerialParams(), err)
 		}
-	}
-	if len(fileVale) == 0 {
-		logrus.Warn("can not read any data from modbus")
+		bus.Resume()
 		return
 	}
-	var WeatherData WeatherSt
-	for name, value := range fileVale {
-		switch name {
-		case "风速":
-			WeatherData.WindSpeed, _ = value.(float32)
-		case "风向":
-			WeatherData.WindDirection, _ = value.(int)
-		case "湿度":
-			WeatherData.Humidity, _ = value.(float32)
-		case "温度":
-			WeatherData.Temperature, _ = value.(float32)
-		case "雨量":
-			WeatherData.Rainfall, _ = value.(float32)
-		case "太阳辐射":
-			WeatherData.SolarRadiation, _ = value.(float32)
-		}
+	if err := saveParams(conf.AutoDetect.StateFile, params); err != nil {
+		log.Errorf("保存串口参数失败: %v", err)
 	}
-	payload, err := json.Marshal(WeatherData)
-	if err != nil {
-		logrus.Debugf("json Marshal err:%v\n", err)
-		return
+	setActiveParams(*params)
+	if err := bus.Reconfigure(ctx, params.apply(conf)); err != nil {
+		log.Errorf("使用新的串口参数打开串口失败: %v", err)
 	}
-	publish.PublishMessage(genTopic(), payload)
 }
 
-// 处理雨量
-func handlerRainfall(data []byte) (interface{}, error) {
-	// 假设读取的是 16 位有符号整数，转换为温度值
-	if len(data) < 2 {
-		return nil, fmt.Errorf("数据长度不足")
-	}
-	value := int16(data[0])<<8 | int16(data[1])
-	return float32(value) / 10, nil // 雨量值放大了 10 倍，需要除以 10
-}
-
-// 处理太阳辐射
-func handlerSolarRadiation(data []byte) (interface{}, error) {
-	// 假设读取的是 16 位有符号整数，转换为温度值
-	if len(data) < 2 {
-		return nil, fmt.Errorf("数据长度不足")
+// readGroup 依次读取并上报总线上所有设备在一个分组中的寄存器，一个设备都没有读到时返回 false。
+// 主分组同时用各分组最近一次的数据计算衍生量、ET0 和太阳辐射累计，随主分组的数据上报
+func readGroup(ctx context.Context, g *pollGroup) bool {
+	ts := time.Now()
+	ok, statusChanged, empty := false, false, true
+	// 网关模式下所有子设备的数据合并为一条消息
+	readings := make(map[string]interface{})
+	for _, dev := range getConfig().Devices {
+		regs := g.registers(dev)
+		if len(regs) == 0 && !g.main {
+			continue
+		}
+		var values map[string]interface{}
+		var err error
+		if len(regs) > 0 {
+			empty = false
+			values, err = readDevice(ctx, dev, regs)
+			if ctx.Err() != nil {
+				return false
+			}
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		// 合理性检查可能删除不合理的值，设备是否在线按检查前的结果判断
+		read := len(values) > 0
+		faults := checkValues(ctx, dev, ts, values)
+		filterValues(dev, values)
+		// 加上其他分组最近读到的数据，计算需要多个字段的数据和检查告警
+		snapshot := mergeLatest(dev, g, ts, values)
+		// 本次没有读到数据时不能用其他分组的旧数据继续累计和检查告警，只在 redis 中标记数据质量
+		failed := len(regs) > 0 && !read
+		if !failed {
+			if g.main {
+				computed := maps.Clone(snapshot)
+				src := dev.sourceUnits()
+				derived.Apply(&dev.Derived, computed, src)
+				et0.Update(ctx, dev.ID, ts, computed, src)
+				solar.Update(dev.ID, ts, computed)
+				for key, value := range computed {
+					if _, ok := snapshot[key]; !ok {
+						values[key] = value
+					}
+				}
+				snapshot = computed
+			}
+			publishAlarms(ctx, dev, ts, snapshot)
+		}
+		writeRedis(ctx, dev, regs, values, faults, ts)
+		if !failed {
+			appendHistory(ts, dev, values)
+		}
+		if len(regs) > 0 && setOnline(dev, groupOnline(dev, g, read)) {
+			statusChanged = true
+		}
+		if err == ErrBusDown {
+			continue
+		}
+		for key, value := range values {
+			log.Debugf("  %s: %v", key, value)
+		}
+		if len(regs) > 0 && !read {
+			log.WithField("device", dev.slaveID()).WithField("group", g.name).Warn("can not read any data from modbus")
+			continue
+		}
+		ok = ok || read
+		if len(values) == 0 {
+			continue
+		}
+		out := convertUnits(values, dev.sourceUnits(), dev.Units.Targets())
+		// 检查不通过的字段及原因
+		if len(faults) > 0 {
+			out["quality"] = faults
+		}
+		if gatewayMode() {
+			readings[dev.ID] = out
+			continue
+		}
+		payload, err := json.Marshal(out)
+		if err != nil {
+			log.WithField("device", dev.slaveID()).WithError(err).Error("序列化遥测数据失败")
+			continue
+		}
+		publish.PublishMessage(ctx, genTopic(), payload)
 	}
-	value := int16(data[0])<<8 | int16(data[1])
-	return float32(value), nil // 太阳辐射返回的就是实际值
-}
-
-// 处理温度
-func handlerTemperature(data []byte) (interface{}, error) {
-	// 假设读取的是 16 位有符号整数，转换为温度值
-	if len(data) < 2 {
-		return nil, fmt.Errorf("数据长度不足")
+	if gatewayMode() {
+		if len(readings) > 0 {
+			publishGateway(ctx, genTopic(), gatewayMessage{SubDeviceData: readings})
+		}
+		if statusChanged {
+			publishStatus(ctx, true)
+		}
 	}
-	value := int16(data[0])<<8 | int16(data[1])
-	return float32(value) / 10, nil // 温度值放大了 10 倍，需要除以 10
+	// 分组在所有设备上都没有寄存器时不算读取失败
+	return ok || empty
 }
 
-// 处理湿度
-func handlerHumidity(data []byte) (interface{}, error) {
-	// 假设读取的是 16 位有符号整数，转换为温度值
-	if len(data) < 2 {
-		return nil, fmt.Errorf("数据长度不足")
-	}
-	value := int16(data[0])<<8 | int16(data[1])
-	return float32(value) / 10, nil // 温度值放大了 10 倍，需要除以 10
+// readDevice 读取一个设备的 regs，一个都没读到时计为总线的一次失败，读到的值按校准表修正
+func readDevice(ctx context.Context, dev *device, regs []Register) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	err := bus.DoSlave(ctx, dev.SlaveID, func(client modbus.Client) error {
+		var errs map[string]error
+		values, errs = ReadValues(ctx, client, regs)
+		var lastErr error
+		for key, err := range errs {
+			log.WithFields(logrus.Fields{
+				"device":     dev.slaveID(),
+				"register":   key,
+				"error_code": ErrorCode(err),
+			}).Error(err)
+			lastErr = err
+		}
+		if len(values) == 0 {
+			return lastErr
+		}
+		return nil
+	})
+	calibration.Apply(dev.ID, dev.Calibration, values)
+	return values, err
 }
 
-// 处理风向
-func handlerWindDirection(data []byte) (interface{}, error) {
-	// 假设读取的是 16 位有符号整数，转换为温度值
-	if len(data) < 2 {
-		return nil, fmt.Errorf("数据长度不足")
+// 网关模式下历史数据的字段名为 <子设备编号>.<字段名>
+func appendHistory(ts time.Time, dev *device, values map[string]interface{}) {
+	if !gatewayMode() {
+		history.Append(ts, values)
+		return
 	}
-	value := int16(data[0])<<8 | int16(data[1])
-	return int(value), nil // 温度值放大了 10 倍，需要除以 10
-}
-
-// 处理风速
-func handlerWindSpeed(data []byte) (interface{}, error) {
-	// 假设读取的是 16 位有符号整数，转换为温度值
-	if len(data) < 2 {
-		return nil, fmt.Errorf("数据长度不足")
+	prefixed := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		prefixed[dev.ID+"."+k] = v
 	}
-	value := int16(data[0])<<8 | int16(data[1])
-	return float32(value) / 10, nil // 风速放大了 10 倍，需要除以 10
+	history.Append(ts, prefixed)
 }
 
+// 直连模式的主题为 devices/<类型>/{cfgID}/{mac}，网关模式为 <gateway_publish_topic>/<类型>/{网关cfgID}/{mac}
 func genTopic() string {
-	topic := "devices/telemetry"
-	return fmt.Sprintf("%s/%s/%s", topic, cfgID, MacAddr)
+	return deviceTopic("telemetry")
+}
+func genStatusTopic() string {
+	return deviceTopic("status")
+}
+func genEventTopic() string {
+	return deviceTopic("event")
+}
+func genAlarmTopic() string {
+	return deviceTopic("alarm")
 }
 func genAttributesTopic() string {
-	topic := "devices/attributes"
-	return fmt.Sprintf("%s/%s/%s", topic, cfgID, MacAddr)
+	return deviceTopic("attributes")
+}
+func genCommandTopic() string {
+	if gatewayMode() {
+		return fmt.Sprintf("%s/%s/%s", config.Get().Mqtt.Telemetry.GatewaySubscribeTopic, gateway.CfgID, MacAddr)
+	}
+	return deviceTopic("command")
+}
+func genCommandResponseTopic() string {
+	if gatewayMode() {
+		return fmt.Sprintf("%s/response/%s/%s", config.Get().Mqtt.Telemetry.GatewaySubscribeTopic, gateway.CfgID, MacAddr)
+	}
+	return deviceTopic("command/response")
+}
+func deviceTopic(kind string) string {
+	if gatewayMode() {
+		return fmt.Sprintf("%s/%s/%s/%s", config.Get().Mqtt.Telemetry.GatewayPublishTopic, kind, gateway.CfgID, MacAddr)
+	}
+	return fmt.Sprintf("devices/%s/%s/%s", kind, cfgID, MacAddr)
 }
 func getMACAddress(interfaceName string) (string, error) {
 	//return "1C:40:E8:11:69:54", nil
@@ -0,0 +1,109 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/attributes"
+	"dataCollect/internal/calibration"
+	"dataCollect/internal/config"
+	"dataCollect/mqtt/publish"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// attributesLoop 属性变化后才上报：按 attributes.interval 检查，订阅了 redis 通知时 key 变化后立即检查。
+// 两次上报至少间隔 min_interval，每隔 full_refresh 无论是否变化都上报一次
+func attributesLoop(ctx context.Context) {
+	conf := config.Get().Attributes
+	poll := time.NewTicker(conf.Interval)
+	defer poll.Stop()
+	refresh := time.NewTicker(conf.FullRefresh)
+	defer refresh.Stop()
+	changes := attributes.Watch(ctx)
+
+	var last map[string]interface{}
+	var lastTime time.Time
+	// 距离上次上报不足 min_interval 时推迟检查
+	var pending <-chan time.Time
+	check := func(force bool) {
+		minInterval := config.Get().Attributes.MinInterval
+		if wait := minInterval - time.Since(lastTime); !force && wait > 0 {
+			if pending == nil {
+				pending = time.After(wait)
+			}
+			return
+		}
+		values := collectAttributes(ctx)
+		if !force && reflect.DeepEqual(values, last) {
+			return
+		}
+		publishAttributes(ctx, values)
+		last, lastTime = values, time.Now()
+	}
+
+	// 启动时先上报一次
+	check(true)
+	for {
+		select {
+		case <-poll.C:
+			check(false)
+		case <-changes:
+			check(false)
+		case <-pending:
+			pending = nil
+			check(false)
+		case <-refresh.C:
+			check(true)
+		case <-ctx.Done():
+			return
+		}
+		// 热加载修改了检查周期
+		if next := config.Get().Attributes; next.Interval != conf.Interval || next.FullRefresh != conf.FullRefresh {
+			poll.Reset(next.Interval)
+			refresh.Reset(next.FullRefresh)
+			conf = next
+		}
+	}
+}
+
+// ReportAttributes 立即上报 attributes.items 中配置的属性以及当前使用的串口参数
+func ReportAttributes(ctx context.Context) {
+	publishAttributes(ctx, collectAttributes(ctx))
+}
+
+// 网关模式下 attributes.items 和串口参数作为网关的属性，子设备上报名称和从站地址
+func collectAttributes(ctx context.Context) map[string]interface{} {
+	values := attributes.Collect(ctx, config.Get().Attributes.Items)
+	params := ActiveSerialParams()
+	values["serialParams"] = fmt.Sprintf("%d %d%s%d", params.BaudRate, params.DataBits, params.Parity, params.StopBits)
+	values["serialDetected"] = params.Detected
+	if !gatewayMode() {
+		values["slaveId"] = params.SlaveID
+		if devices := getConfig().Devices; len(devices) > 0 {
+			values["units"] = outputUnits(devices[0])
+			if cal := calibration.Table(devices[0].ID, devices[0].Calibration); len(cal) > 0 {
+				values["calibration"] = cal
+			}
+		}
+		return values
+	}
+	subs := make(map[string]interface{})
+	for _, dev := range getConfig().Devices {
+		sub := map[string]interface{}{"name": dev.Name, "slaveId": dev.slaveID(), "units": outputUnits(dev)}
+		if cal := calibration.Table(dev.ID, dev.Calibration); len(cal) > 0 {
+			sub["calibration"] = cal
+		}
+		subs[dev.ID] = sub
+	}
+	return map[string]interface{}{"gateway_data": values, "sub_device_data": subs}
+}
+
+func publishAttributes(ctx context.Context, values map[string]interface{}) {
+	payload, err := json.Marshal(values)
+	if err != nil {
+		log.WithError(err).Error("序列化设备属性失败")
+		return
+	}
+	publish.PublishMessage(ctx, genAttributesTopic(), payload)
+}
@@ -0,0 +1,175 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"dataCollect/internal/fileutil"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/sirupsen/logrus"
+)
+
+// SerialParams 当前使用的串口参数和从站地址
+type SerialParams struct {
+	BaudRate   int       `json:"baud_rate"`
+	DataBits   int       `json:"data_bits"`
+	Parity     string    `json:"parity"`
+	StopBits   int       `json:"stop_bits"`
+	SlaveID    int       `json:"slave_id"`
+	Detected   bool      `json:"detected"` // 是否由自动探测得到
+	DetectedAt time.Time `json:"detected_at,omitempty"`
+}
+
+func (p SerialParams) String() string {
+	return fmt.Sprintf("%d %d%s%d 从站 %d", p.BaudRate, p.DataBits, p.Parity, p.StopBits, p.SlaveID)
+}
+
+func (p SerialParams) sameAs(o SerialParams) bool {
+	return p.BaudRate == o.BaudRate && p.DataBits == o.DataBits && p.Parity == o.Parity &&
+		p.StopBits == o.StopBits && p.SlaveID == o.SlaveID
+}
+
+// 用探测到的参数覆盖配置中的串口参数
+func (p SerialParams) apply(conf config.Modbus) config.Modbus {
+	conf.BaudRate = p.BaudRate
+	conf.DataBits = p.DataBits
+	conf.Parity = p.Parity
+	conf.StopBits = p.StopBits
+	conf.SlaveID = p.SlaveID
+	return conf
+}
+
+func paramsFromConfig(conf *config.Modbus) SerialParams {
+	return SerialParams{
+		BaudRate: conf.BaudRate,
+		DataBits: conf.DataBits,
+		Parity:   conf.Parity,
+		StopBits: conf.StopBits,
+		SlaveID:  conf.SlaveID,
+	}
+}
+
+var (
+	paramsMu     sync.RWMutex
+	activeParams SerialParams
+)
+
+// ActiveSerialParams 返回当前使用的串口参数，用于属性上报
+func ActiveSerialParams() SerialParams {
+	paramsMu.RLock()
+	defer paramsMu.RUnlock()
+	return activeParams
+}
+
+func setActiveParams(p SerialParams) {
+	paramsMu.Lock()
+	activeParams = p
+	paramsMu.Unlock()
+}
+
+// DetectSerial 依次尝试候选的波特率、校验位和从站地址，返回第一个有响应的组合。
+// 收到异常响应也说明串口参数和从站地址是对的，只是探测寄存器不存在。
+// 整个探测不超过 autodetect.timeout，超时后返回错误
+func DetectSerial(ctx context.Context, conf *config.Modbus) (*SerialParams, error) {
+	ad := conf.AutoDetect
+	candidates := detectCandidates(conf)
+	log.Infof("开始自动探测串口参数，共 %d 种组合，最长 %v", len(candidates), ad.Timeout)
+	deadline, cancel := context.WithTimeout(ctx, ad.Timeout)
+	defer cancel()
+
+	var handler *modbus.RTUClientHandler
+	defer func() {
+		if handler != nil {
+			handler.Close()
+		}
+	}()
+	var lastErr error
+	for i, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if deadline.Err() != nil {
+			return nil, fmt.Errorf("超过 %v，尝试了 %d 种组合均无响应: %v", ad.Timeout, i, lastErr)
+		}
+		// 波特率和校验位不变时复用已打开的串口，只切换从站地址
+		if handler == nil || handler.BaudRate != c.BaudRate || handler.Parity != c.Parity || handler.StopBits != c.StopBits {
+			if handler != nil {
+				handler.Close()
+			}
+			probeConf := c.apply(*conf)
+			probeConf.Timeout = ad.ProbeTimeout
+			handler = NewRTUHandler(&probeConf)
+			if err := handler.Connect(); err != nil {
+				handler = nil
+				return nil, fmt.Errorf("打开串口 %s 失败: %v", conf.Port, err)
+			}
+		}
+		handler.SlaveId = byte(c.SlaveID)
+		_, err := ReadFunction(modbus.NewClient(handler), ad.ProbeFunction, uint16(ad.ProbeAddress), 1)
+		var mbErr *modbus.ModbusError
+		if err == nil || errors.As(err, &mbErr) {
+			c.Detected = true
+			c.DetectedAt = time.Now()
+			log.Infof("自动探测成功: %s", c)
+			return &c, nil
+		}
+		lastErr = err
+		log.WithFields(logrus.Fields{"device": c.SlaveID, "error_code": ErrorCode(err)}).Debugf("探测 %s 无响应: %v", c, err)
+	}
+	return nil, fmt.Errorf("尝试了 %d 种组合均无响应: %v", len(candidates), lastErr)
+}
+
+// 候选顺序：上次保存的结果、配置文件中的参数、再按波特率/校验位/从站地址穷举
+func detectCandidates(conf *config.Modbus) []SerialParams {
+	var candidates []SerialParams
+	add := func(p SerialParams) {
+		for _, c := range candidates {
+			if c.sameAs(p) {
+				return
+			}
+		}
+		candidates = append(candidates, p)
+	}
+	if saved, err := loadSavedParams(conf.AutoDetect.StateFile); err == nil {
+		add(*saved)
+	}
+	add(paramsFromConfig(conf))
+	for _, baud := range conf.AutoDetect.BaudRates {
+		for _, parity := range conf.AutoDetect.Parities {
+			stopBits := 1
+			if parity == "N" {
+				stopBits = conf.StopBits
+			}
+			for _, id := range conf.AutoDetect.SlaveIDs {
+				add(SerialParams{BaudRate: baud, DataBits: conf.DataBits, Parity: parity, StopBits: stopBits, SlaveID: id})
+			}
+		}
+	}
+	return candidates
+}
+
+func loadSavedParams(path string) (*SerialParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p SerialParams
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func saveParams(path string, p *SerialParams) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.AtomicWrite(path, data)
+}
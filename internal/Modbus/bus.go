@@ -0,0 +1,203 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrBusDown 总线处于断开状态且还没到重连时间
+var ErrBusDown = errors.New("modbus 总线已断开，等待重连")
+
+// ErrBusSuspended 正在自动探测串口参数，串口由探测独占
+var ErrBusSuspended = errors.New("正在自动探测串口参数")
+
+// Bus 管理串口连接的健康状态：连续失败达到阈值后关闭串口，按指数退避重新打开。
+// USB 转 RS485 适配器复位后原来的文件句柄会一直报错，只有关闭后重新打开才能恢复
+type Bus struct {
+	mu        sync.Mutex
+	conf      config.Modbus
+	handler   *modbus.RTUClientHandler
+	client    modbus.Client
+	open      bool
+	up        bool
+	failures  int
+	backoff   time.Duration
+	nextRetry time.Time
+	suspended bool
+	// 总线状态变化时回调，up 为 false 表示总线断开
+	onChange func(ctx context.Context, up bool, failures int, err error)
+}
+
+func NewBus(conf config.Modbus, onChange func(ctx context.Context, up bool, failures int, err error)) *Bus {
+	b := &Bus{conf: conf, up: true, onChange: onChange}
+	b.handler = NewRTUHandler(&b.conf)
+	b.client = modbus.NewClient(b.handler)
+	return b
+}
+
+// Open 打开串口，失败时进入断开状态，后续由 Do 按退避时间重试
+func (b *Bus) Open(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.connect(); err != nil {
+		b.failures++
+		b.markDown(ctx, err)
+		return err
+	}
+	return nil
+}
+
+func (b *Bus) connect() error {
+	if err := b.handler.Connect(); err != nil {
+		return fmt.Errorf("打开串口 %s 失败: %v", b.conf.Port, err)
+	}
+	b.open = true
+	return nil
+}
+
+func (b *Bus) close() {
+	if b.open {
+		b.handler.Close()
+		b.open = false
+	}
+}
+
+// Close 关闭串口
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+}
+
+// Suspend 关闭串口，Resume 或 Reconfigure 之前其他事务直接返回 ErrBusSuspended
+func (b *Bus) Suspend() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+	b.suspended = true
+}
+
+// Resume 结束 Suspend，下一次事务时重新打开串口
+func (b *Bus) Resume() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.suspended = false
+}
+
+// Reconfigure 使用新的串口参数重新打开串口，用于自动探测到新参数之后
+func (b *Bus) Reconfigure(ctx context.Context, conf config.Modbus) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+	b.suspended = false
+	b.conf = conf
+	b.handler = NewRTUHandler(&b.conf)
+	b.client = modbus.NewClient(b.handler)
+	b.failures = 0
+	b.nextRetry = time.Time{}
+	if err := b.connect(); err != nil {
+		b.markDown(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// Do 在总线上执行一次完整的读写事务，同一时刻只有一个事务占用总线。
+// fn 返回错误计为一次失败，设备返回的异常响应说明总线是通的，不计为失败
+func (b *Bus) Do(ctx context.Context, fn func(client modbus.Client) error) error {
+	return b.DoSlave(ctx, 0, fn)
+}
+
+// DoSlave 与 Do 相同，事务发给指定的从站地址，用于同一条总线上的多个设备，slaveID 为 0 时使用串口配置中的地址
+func (b *Bus) DoSlave(ctx context.Context, slaveID int, fn func(client modbus.Client) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if b.suspended {
+		return ErrBusSuspended
+	}
+	if slaveID == 0 {
+		slaveID = b.conf.SlaveID
+	}
+	b.handler.SlaveId = byte(slaveID)
+
+	if !b.up || !b.open {
+		if time.Now().Before(b.nextRetry) {
+			return ErrBusDown
+		}
+		b.close()
+		if err := b.connect(); err != nil {
+			b.fail(ctx, err)
+			return err
+		}
+		log.WithField("port", b.conf.Port).Infof("重新打开串口 %s", b.conf.Port)
+	}
+
+	err := fn(b.client)
+	var mbErr *modbus.ModbusError
+	// 退出过程中被中断的事务不计为失败
+	if err != nil && ctx.Err() == nil && !errors.As(err, &mbErr) {
+		b.fail(ctx, err)
+		return err
+	}
+	b.failures = 0
+	b.backoff = 0
+	if !b.up {
+		b.up = true
+		log.WithFields(b.fields(nil)).Infof("modbus 总线恢复: %s", b.conf.Port)
+		if b.onChange != nil {
+			b.onChange(ctx, true, 0, nil)
+		}
+	}
+	return err
+}
+
+func (b *Bus) fail(ctx context.Context, err error) {
+	b.failures++
+	rc := b.conf.Reconnect
+	if b.up && b.failures < rc.MaxFailures {
+		return
+	}
+	b.markDown(ctx, err)
+}
+
+// markDown 关闭串口并计算下一次重连时间
+func (b *Bus) markDown(ctx context.Context, err error) {
+	rc := b.conf.Reconnect
+	b.close()
+	if b.backoff == 0 {
+		b.backoff = rc.BackoffMin
+	} else {
+		b.backoff *= 2
+		if b.backoff > rc.BackoffMax {
+			b.backoff = rc.BackoffMax
+		}
+	}
+	b.nextRetry = time.Now().Add(b.backoff)
+	if b.up {
+		b.up = false
+		log.WithFields(b.fields(err)).Errorf("modbus 总线断开: %s 连续失败 %d 次: %v", b.conf.Port, b.failures, err)
+		if b.onChange != nil {
+			b.onChange(ctx, false, b.failures, err)
+		}
+	}
+	log.WithField("port", b.conf.Port).Warnf("%v 后重新打开串口 %s", b.backoff, b.conf.Port)
+}
+
+// 总线状态变化日志的结构化字段
+func (b *Bus) fields(err error) logrus.Fields {
+	f := logrus.Fields{"port": b.conf.Port, "device": b.conf.SlaveID, "failures": b.failures}
+	if err != nil {
+		f["error_code"] = ErrorCode(err)
+	}
+	return f
+}
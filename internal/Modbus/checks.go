@@ -0,0 +1,140 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"dataCollect/mqtt/publish"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// 数据合理性检查不通过的原因
+const (
+	faultRange = "range" // 超出物理量程
+	faultRate  = "rate"  // 变化过快
+	faultStuck = "stuck" // 长时间不变
+)
+
+// 一个字段的检查状态
+type checkState struct {
+	last  float64
+	lastT time.Time
+	// 与 last 相同的连续次数(含 last 本身)以及第一次出现的时间
+	same      int
+	sameSince time.Time
+	fault     string
+	detail    string
+}
+
+var (
+	checkMu sync.Mutex
+	// 设备编号 -> 字段 -> 检查状态
+	checkStates = make(map[string]map[string]*checkState)
+)
+
+// checkValues 按设备的 checks 检查本次读到的数据，返回检查不通过的字段及原因。
+// 配置了 suppress 的字段从 values 中删除；故障出现、变化或恢复时上报事件
+func checkValues(ctx context.Context, dev *device, ts time.Time, values map[string]interface{}) map[string]string {
+	if len(dev.Checks) == 0 {
+		return nil
+	}
+	checkMu.Lock()
+	states, ok := checkStates[dev.ID]
+	if !ok {
+		states = make(map[string]*checkState)
+		checkStates[dev.ID] = states
+	}
+	faults := make(map[string]string)
+	var events []eventSt
+	for i := range dev.Checks {
+		c := &dev.Checks[i]
+		v, ok := values[c.Key].(float64)
+		// 读取失败的字段不参与检查，保持之前的状态
+		if !ok {
+			continue
+		}
+		st, ok := states[c.Key]
+		if !ok {
+			st = &checkState{}
+			states[c.Key] = st
+		}
+		fault, detail := st.update(c, ts, v)
+		if fault != "" {
+			faults[c.Key] = fault
+			if c.Suppress {
+				delete(values, c.Key)
+			}
+		}
+		if fault != st.fault {
+			events = append(events, faultEvent(dev, c.Key, v, fault, detail, st))
+			st.fault, st.detail = fault, detail
+		}
+	}
+	checkMu.Unlock()
+
+	for _, ev := range events {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			log.WithError(err).Errorf("序列化 %s 事件失败", ev.Method)
+			continue
+		}
+		publish.PublishMessage(ctx, genEventTopic(), payload)
+	}
+	return faults
+}
+
+// update 用本次的值更新状态，返回检查结果
+func (st *checkState) update(c *config.Check, ts time.Time, v float64) (string, string) {
+	prev, prevT, first := st.last, st.lastT, st.lastT.IsZero()
+	if !first && v == prev {
+		st.same++
+	} else {
+		st.same, st.sameSince = 1, ts
+	}
+	st.last, st.lastT = v, ts
+
+	switch {
+	case c.Min != nil && v < *c.Min:
+		return faultRange, fmt.Sprintf("%v 小于下限 %v", v, *c.Min)
+	case c.Max != nil && v > *c.Max:
+		return faultRange, fmt.Sprintf("%v 大于上限 %v", v, *c.Max)
+	case c.StuckCount > 0 && st.same >= c.StuckCount:
+		return faultStuck, fmt.Sprintf("连续 %d 次为 %v", st.same, v)
+	case c.StuckDuration > 0 && st.same > 1 && ts.Sub(st.sameSince) >= c.StuckDuration:
+		return faultStuck, fmt.Sprintf("%v 内一直为 %v", ts.Sub(st.sameSince).Round(time.Second), v)
+	}
+	if c.MaxRate > 0 && !first {
+		if minutes := ts.Sub(prevT).Minutes(); minutes > 0 {
+			if rate := math.Abs(v-prev) / minutes; rate > c.MaxRate {
+				return faultRate, fmt.Sprintf("从 %v 变为 %v，每分钟变化 %.2f 超过 %v", prev, v, rate, c.MaxRate)
+			}
+		}
+	}
+	return "", ""
+}
+
+// faultEvent 故障出现或变化时为 sensor_fault，恢复时为 sensor_recovered
+func faultEvent(dev *device, key string, v float64, fault, detail string, st *checkState) eventSt {
+	ev := eventSt{Method: "sensor_fault", Params: map[string]interface{}{
+		"field":  key,
+		"value":  v,
+		"reason": fault,
+		"detail": detail,
+	}}
+	entry := log.WithField("device", dev.slaveID()).WithField("register", key)
+	if fault == "" {
+		ev.Method = "sensor_recovered"
+		ev.Params["reason"] = st.fault
+		delete(ev.Params, "detail")
+		entry.Infof("数据恢复正常: %v", v)
+	} else {
+		entry.Warnf("数据不合理(%s): %s", fault, detail)
+	}
+	if gatewayMode() {
+		ev.Params["sub_device"] = dev.ID
+	}
+	return ev
+}
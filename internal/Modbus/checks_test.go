@@ -0,0 +1,104 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"testing"
+	"time"
+)
+
+func limit(v float64) *float64 { return &v }
+
+func TestCheckUpdate(t *testing.T) {
+	type sample struct {
+		at    time.Duration // 距离第一次采集的时间
+		v     float64
+		fault string
+	}
+	tests := []struct {
+		name    string
+		check   config.Check
+		samples []sample
+	}{
+		{"range", config.Check{Min: limit(-40), Max: limit(80)}, []sample{
+			{0, 20, ""},
+			{time.Minute, -50, faultRange},
+			{2 * time.Minute, 85, faultRange},
+			{3 * time.Minute, 80, ""},
+		}},
+		// 每分钟变化量，与上一次的值比较
+		{"max rate", config.Check{MaxRate: 5}, []sample{
+			{0, 20, ""},
+			{time.Minute, 24, ""},
+			{2 * time.Minute, 30, faultRate},
+			{3 * time.Minute, 31, ""},
+			{5 * time.Minute, 40, ""},
+		}},
+		{"max rate first", config.Check{MaxRate: 5}, []sample{
+			{0, 100, ""},
+		}},
+		{"stuck count", config.Check{StuckCount: 3}, []sample{
+			{0, 10, ""},
+			{time.Minute, 10, ""},
+			{2 * time.Minute, 10, faultStuck},
+			{3 * time.Minute, 10, faultStuck},
+			{4 * time.Minute, 11, ""},
+		}},
+		{"stuck duration", config.Check{StuckDuration: 10 * time.Minute}, []sample{
+			{0, 10, ""},
+			{5 * time.Minute, 10, ""},
+			{10 * time.Minute, 10, faultStuck},
+			{11 * time.Minute, 12, ""},
+			{21 * time.Minute, 12, faultStuck},
+		}},
+		// 量程优先于其他检查
+		{"range before stuck", config.Check{Max: limit(50), StuckCount: 2}, []sample{
+			{0, 60, faultRange},
+			{time.Minute, 60, faultRange},
+		}},
+	}
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &checkState{}
+			for i, s := range tt.samples {
+				if fault, detail := st.update(&tt.check, start.Add(s.at), s.v); fault != s.fault {
+					t.Errorf("sample %d: fault %q (%s), want %q", i, fault, detail, s.fault)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckValues(t *testing.T) {
+	config.Set(&config.Config{})
+	dev := &device{ID: "check-test", SlaveID: 1, Checks: []config.Check{
+		{Key: "temperature", Min: limit(-40), Max: limit(80), Suppress: true},
+		{Key: "humidity", Max: limit(100)},
+	}}
+	defer delete(checkStates, dev.ID)
+	ts := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	values := map[string]interface{}{"temperature": 120.0, "humidity": 105.0, "wind_speed": 3.0}
+	faults := checkValues(ctx, dev, ts, values)
+	if faults["temperature"] != faultRange || faults["humidity"] != faultRange || len(faults) != 2 {
+		t.Errorf("faults %v", faults)
+	}
+	// suppress 的字段不上报，其他字段保留并标记
+	if _, ok := values["temperature"]; ok || values["humidity"] != 105.0 || values["wind_speed"] != 3.0 {
+		t.Errorf("values %v", values)
+	}
+	if st := checkStates[dev.ID]["temperature"]; st.fault != faultRange || st.detail == "" {
+		t.Errorf("state %+v", st)
+	}
+
+	// 读取失败的字段保持之前的状态
+	values = map[string]interface{}{"humidity": 60.0}
+	if faults := checkValues(ctx, dev, ts.Add(time.Minute), values); len(faults) != 0 {
+		t.Errorf("恢复后 faults %v", faults)
+	}
+	if checkStates[dev.ID]["temperature"].fault != faultRange || checkStates[dev.ID]["humidity"].fault != "" {
+		t.Errorf("读取失败后 temperature %q humidity %q", checkStates[dev.ID]["temperature"].fault, checkStates[dev.ID]["humidity"].fault)
+	}
+}
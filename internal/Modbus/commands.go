@@ -0,0 +1,105 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/calibration"
+	"dataCollect/internal/config"
+	"dataCollect/mqtt/command"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 需要访问设备的命令，网关模式下按命令中的 sub_device 找到对应的子设备
+func registerCommands() {
+	// read_data: 立即读取一次设备数据并在响应中返回，不上报
+	command.Register("read_data", func(ctx context.Context, req *command.Request) (interface{}, error) {
+		dev, err := findDevice(req.SubDevice)
+		if err != nil {
+			return nil, err
+		}
+		values, err := readDevice(ctx, dev, dev.Registers)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("读取 %s 失败: %v", dev.Name, err)
+		}
+		return values, nil
+	})
+	// write_command: {"name":"reset_rainfall"} 执行设备型号中定义的写命令
+	command.Register("write_command", func(ctx context.Context, req *command.Request) (interface{}, error) {
+		var params struct {
+			Name string `json:"name"`
+		}
+		if err := command.ParseParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		dev, err := findDevice(req.SubDevice)
+		if err != nil {
+			return nil, err
+		}
+		return nil, writeCommand(ctx, dev, params.Name)
+	})
+	// reset_rainfall: 立即把雨量清零，等同于 write_command reset_rainfall
+	command.Register("reset_rainfall", func(ctx context.Context, req *command.Request) (interface{}, error) {
+		dev, err := findDevice(req.SubDevice)
+		if err != nil {
+			return nil, err
+		}
+		return nil, writeCommand(ctx, dev, "reset_rainfall")
+	})
+	// set_calibration: {"key":"temperature","offset":-0.8,"date":"2026-10-19","operator":"张三"}
+	// 或 {"key":"temperature","points":[[0,0.3],[40,39.6]]} 设置一个字段的校准并保存，返回设备当前的校准表
+	command.Register("set_calibration", func(ctx context.Context, req *command.Request) (interface{}, error) {
+		var c config.Calibration
+		if err := command.ParseParams(req.Params, &c); err != nil {
+			return nil, err
+		}
+		dev, err := findDevice(req.SubDevice)
+		if err != nil {
+			return nil, err
+		}
+		// 没有 gain 时为 1，与配置文件相同
+		if c.Gain == 0 {
+			c.Gain = 1
+		}
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(dev.Registers, func(r Register) bool { return r.Key == c.Key }) {
+			return nil, fmt.Errorf("%s 没有寄存器 %s", dev.Name, c.Key)
+		}
+		if c.Date == "" {
+			c.Date = time.Now().Format(time.DateOnly)
+		}
+		if err := calibration.Set(dev.ID, c); err != nil {
+			return nil, err
+		}
+		ReportAttributes(ctx)
+		return calibration.Table(dev.ID, dev.Calibration), nil
+	})
+	// clear_calibration: {"key":"temperature"} 删除命令设置的校准，恢复使用配置文件中的校准，key 为空时删除全部
+	command.Register("clear_calibration", func(ctx context.Context, req *command.Request) (interface{}, error) {
+		var params struct {
+			Key string `json:"key"`
+		}
+		if err := command.ParseParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		dev, err := findDevice(req.SubDevice)
+		if err != nil {
+			return nil, err
+		}
+		if err := calibration.Clear(dev.ID, params.Key); err != nil {
+			return nil, err
+		}
+		ReportAttributes(ctx)
+		return calibration.Table(dev.ID, dev.Calibration), nil
+	})
+	// get_calibration: 返回设备当前的校准表，source 为 config(配置文件) 或 remote(命令设置)
+	command.Register("get_calibration", func(ctx context.Context, req *command.Request) (interface{}, error) {
+		dev, err := findDevice(req.SubDevice)
+		if err != nil {
+			return nil, err
+		}
+		return calibration.Table(dev.ID, dev.Calibration), nil
+	})
+}
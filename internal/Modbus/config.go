@@ -0,0 +1,189 @@
+package modbus
+
+import (
+	"dataCollect/internal/calibration"
+	"dataCollect/internal/config"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type collectConfig struct {
+	PollInterval time.Duration
+	Groups       []config.PollGroup
+	Devices      []*device
+}
+
+// device 总线上的一个采集设备
+type device struct {
+	ID    string
+	Name  string
+	CfgID string
+	// 0 表示使用当前串口参数中的从站地址，自动探测到新地址后随之变化
+	SlaveID   int
+	Registers []Register
+	// 型号中的写命令，如 reset_rainfall
+	Commands map[string]config.WriteCommand
+	Derived  config.Derived
+	// 上报 MQTT 的单位
+	Units   config.Units
+	Checks  []config.Check
+	Filters []config.Filter
+	// 配置文件中的校准，MQTT 命令设置的校准由 calibration 包保存
+	Calibration []config.Calibration
+}
+
+// slaveID 返回设备实际使用的从站地址
+func (d *device) slaveID() int {
+	if d.SlaveID == 0 {
+		return ActiveSerialParams().SlaveID
+	}
+	return d.SlaveID
+}
+
+var (
+	configMu   sync.RWMutex
+	currentCfg *collectConfig
+	// 采集周期或分组变化时通知 ModbusLoop 重新调度
+	intervalChanged = make(chan struct{}, 1)
+	// 网关模式下子设备增减时通知 ModbusLoop 重新注册
+	devicesChanged = make(chan struct{}, 1)
+)
+
+func getConfig() *collectConfig {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return currentCfg
+}
+
+// 配置在加载时已经完成校验，这里只负责把寄存器配置转换为带解析函数的寄存器表
+func loadCollectConfig(m *config.Modbus) *collectConfig {
+	cfg := &collectConfig{PollInterval: m.PollInterval, Groups: m.Groups}
+	// 未配置 devices 时只有一个设备，从站地址可能由自动探测得到
+	if len(m.Devices) == 0 {
+		cfg.Devices = []*device{{
+			ID:          fmt.Sprint(m.SlaveID),
+			Name:        "气象监控站",
+			CfgID:       m.CfgID,
+			Registers:   BuildRegisters(m.Registers),
+			Commands:    m.Commands,
+			Derived:     m.Derived,
+			Units:       m.Units,
+			Checks:      m.Checks,
+			Filters:     m.Filters,
+			Calibration: m.Calibration,
+		}}
+		return cfg
+	}
+	for _, d := range m.Devices {
+		cfg.Devices = append(cfg.Devices, &device{
+			ID:          d.ID,
+			Name:        d.Name,
+			CfgID:       d.CfgID,
+			SlaveID:     d.SlaveID,
+			Registers:   BuildRegisters(d.Registers),
+			Commands:    d.Commands,
+			Derived:     d.Derived,
+			Units:       d.Units,
+			Checks:      d.Checks,
+			Filters:     d.Filters,
+			Calibration: d.Calibration,
+		})
+	}
+	return cfg
+}
+
+// findDevice 按编号查找设备，id 为空且只有一个设备时返回该设备
+func findDevice(id string) (*device, error) {
+	devices := getConfig().Devices
+	if id == "" {
+		if len(devices) == 1 {
+			return devices[0], nil
+		}
+		return nil, fmt.Errorf("有 %d 个子设备，需要指定 sub_device", len(devices))
+	}
+	for _, dev := range devices {
+		if dev.ID == id {
+			return dev, nil
+		}
+	}
+	return nil, fmt.Errorf("子设备 %q 不存在", id)
+}
+
+// BuildRegisters 把寄存器配置转换为带解析函数的寄存器表
+func BuildRegisters(cfgs []config.Register) []Register {
+	regs := make([]Register, 0, len(cfgs))
+	for _, rc := range cfgs {
+		regs = append(regs, Register{
+			Name:     rc.Name,
+			Key:      rc.Key,
+			Address:  rc.Address,
+			Length:   rc.Length,
+			Function: rc.Function,
+			Unit:     rc.Unit,
+			Handler:  wordOrder(rc.WordOrder, NewDecoder(rc.Type, rc.Scale)),
+		})
+	}
+	return regs
+}
+
+// 热加载后立即生效的配置，其他 modbus 配置需要重启。
+// profile 和 cfg_id 变化后寄存器表和写命令立即生效，平台模板 ID 用在注册信息和主题中，需要重启
+var liveModbusKeys = []string{
+	"modbus.poll_interval", "modbus.registers", "modbus.commands", "modbus.profile", "modbus.cfg_id",
+	"modbus.devices", "modbus.derived", "modbus.units", "modbus.checks", "modbus.filters",
+	"modbus.calibration", "modbus.calibration_file", "modbus.groups",
+}
+
+// 配置热加载：原地替换寄存器表和采集周期，不中断采集循环
+func reloadModbus(changed []string) error {
+	for _, k := range changed {
+		live := slices.ContainsFunc(liveModbusKeys, func(prefix string) bool {
+			return k == prefix || strings.HasPrefix(k, prefix+".")
+		})
+		if !live {
+			log.Warnf("%s 修改后需要重启程序才能生效", k)
+		}
+	}
+	if slices.Contains(changed, "modbus.calibration_file") {
+		calibration.Reload()
+	}
+	m := &config.Get().Modbus
+	if !gatewayMode() && m.CfgID != cfgID {
+		log.Warnf("平台模板 ID 变为 %s，寄存器表和写命令已生效，注册信息和主题中的模板 ID 需要重启程序才能生效，当前仍为 %s", m.CfgID, cfgID)
+	}
+	cfg := loadCollectConfig(m)
+	old := getConfig()
+	configMu.Lock()
+	currentCfg = cfg
+	configMu.Unlock()
+	if old == nil || old.PollInterval != cfg.PollInterval || !sameGroups(old.Groups, cfg.Groups) {
+		select {
+		case intervalChanged <- struct{}{}:
+		default:
+		}
+	}
+	if old == nil || !sameDevices(old.Devices, cfg.Devices) {
+		select {
+		case devicesChanged <- struct{}{}:
+		default:
+		}
+	}
+	log.Infof("modbus 配置已更新: 采集周期 %v, 分组 %d 个, 设备 %d 个", cfg.PollInterval, len(cfg.Groups), len(cfg.Devices))
+	return nil
+}
+
+// 判断设备列表是否需要重新注册，只比较注册信息，不比较寄存器表
+func sameDevices(a, b []*device) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Name != b[i].Name || a[i].CfgID != b[i].CfgID || a[i].SlaveID != b[i].SlaveID {
+			return false
+		}
+	}
+	return true
+}
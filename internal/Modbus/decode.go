@@ -0,0 +1,81 @@
+package modbus
+
+import (
+	"dataCollect/internal/config"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// NewDecoder 按数据类型解析寄存器原始数据（大端），并乘以缩放系数
+func NewDecoder(dataType string, scale float64) func([]byte) (interface{}, error) {
+	// 整数类型按缩放系数保留小数位，避免 23*0.1=2.3000000000000003 这类浮点误差
+	decimals := 0
+	if scale < 1 {
+		decimals = int(math.Ceil(-math.Log10(scale)))
+	}
+	pow := math.Pow(10, float64(decimals))
+	return func(data []byte) (interface{}, error) {
+		size := int(config.TypeLength[dataType]) * 2
+		if len(data) < size {
+			return nil, fmt.Errorf("数据长度不足")
+		}
+		var raw float64
+		switch dataType {
+		case "int16":
+			raw = float64(int16(binary.BigEndian.Uint16(data)))
+		case "uint16":
+			raw = float64(binary.BigEndian.Uint16(data))
+		case "int32":
+			raw = float64(int32(binary.BigEndian.Uint32(data)))
+		case "uint32":
+			raw = float64(binary.BigEndian.Uint32(data))
+		case "float32":
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(data))) * scale, nil
+		default:
+			return nil, fmt.Errorf("不支持的数据类型 %s", dataType)
+		}
+		return math.Round(raw*scale*pow) / pow, nil
+	}
+}
+
+// wordOrder 字序为 CDAB 时先交换 32 位数据的高低字再解析，16 位数据不受影响
+func wordOrder(order string, decode func([]byte) (interface{}, error)) func([]byte) (interface{}, error) {
+	if order != "CDAB" {
+		return decode
+	}
+	return func(data []byte) (interface{}, error) {
+		if len(data) < 4 {
+			return decode(data)
+		}
+		swapped := append(append([]byte(nil), data[2:4]...), data[0:2]...)
+		return decode(swapped)
+	}
+}
+
+// DecodeAll 把连续读取的寄存器数据按数据类型逐个解析
+func DecodeAll(dataType string, scale float64, data []byte) ([]interface{}, error) {
+	size := int(config.TypeLength[dataType]) * 2
+	if size == 0 {
+		return nil, fmt.Errorf("不支持的数据类型 %s", dataType)
+	}
+	decode := NewDecoder(dataType, scale)
+	var values []interface{}
+	for i := 0; i+size <= len(data); i += size {
+		v, err := decode(data[i : i+size])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// DecodeBits 解析线圈/离散输入的位数据，低位在前
+func DecodeBits(data []byte, quantity uint16) []bool {
+	bits := make([]bool, 0, quantity)
+	for i := 0; i < int(quantity) && i/8 < len(data); i++ {
+		bits = append(bits, data[i/8]&(1<<(uint(i)%8)) != 0)
+	}
+	return bits
+}
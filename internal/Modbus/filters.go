@@ -0,0 +1,103 @@
+package modbus
+
+import (
+	"dataCollect/internal/config"
+	"dataCollect/internal/units"
+	"slices"
+	"sync"
+)
+
+// 一个滤波器的状态
+type filterState struct {
+	conf   config.Filter // 热加载修改了参数时重新开始
+	window []float64     // 最近 window 次采集的值
+	ema    float64
+	hasEMA bool
+}
+
+var (
+	filterMu sync.Mutex
+	// 设备编号 -> 按 filters 顺序的滤波器状态
+	filterStates = make(map[string][]*filterState)
+)
+
+// filterValues 按设备的 filters 对本次读到的数据滤波，结果写入 output，
+// 配置了 raw_key 时滤波前的值同时写入 raw_key。读取失败(或被 checks 删除)的字段不参与滤波
+func filterValues(dev *device, values map[string]interface{}) {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	if len(dev.Filters) == 0 {
+		delete(filterStates, dev.ID)
+		return
+	}
+	states := filterStates[dev.ID]
+	if len(states) != len(dev.Filters) {
+		states = make([]*filterState, len(dev.Filters))
+		filterStates[dev.ID] = states
+	}
+	for i, f := range dev.Filters {
+		if states[i] == nil || states[i].conf != f {
+			states[i] = &filterState{conf: f}
+		}
+		v, ok := values[f.Key].(float64)
+		if !ok {
+			continue
+		}
+		if f.RawKey != "" {
+			values[f.RawKey] = v
+		}
+		out := states[i].update(v)
+		if out != v {
+			log.WithField("device", dev.slaveID()).WithField("register", f.Key).Tracef("%s 滤波 %v -> %v", f.Type, v, out)
+		}
+		values[f.Output] = out
+	}
+}
+
+// update 加入本次的值，返回滤波结果
+func (st *filterState) update(v float64) float64 {
+	f := &st.conf
+	prev := st.window
+	st.window = append(st.window, v)
+	if len(st.window) > f.Window {
+		st.window = st.window[len(st.window)-f.Window:]
+	}
+	switch f.Type {
+	case "median":
+		return units.Round(median(st.window))
+	case "average":
+		sum := 0.0
+		for _, x := range st.window {
+			sum += x
+		}
+		return units.Round(sum / float64(len(st.window)))
+	case "ema":
+		if st.hasEMA {
+			st.ema = f.Alpha*v + (1-f.Alpha)*st.ema
+		} else {
+			st.ema, st.hasEMA = v, true
+		}
+		return units.Round(st.ema)
+	case "spike":
+		// 与之前的值比较，数据太少时不判断
+		if len(prev) < 3 {
+			return v
+		}
+		m := median(prev)
+		if v-m > f.Threshold || m-v > f.Threshold {
+			log.WithField("register", f.Key).Debugf("尖峰 %v 与中位数 %v 相差超过 %v，替换为中位数", v, m, f.Threshold)
+			return m
+		}
+	}
+	return v
+}
+
+func median(s []float64) float64 {
+	sorted := slices.Clone(s)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
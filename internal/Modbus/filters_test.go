@@ -0,0 +1,88 @@
+package modbus
+
+import (
+	"dataCollect/internal/config"
+	"slices"
+	"testing"
+)
+
+func TestFilterUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.Filter
+		in   []float64
+		want []float64
+	}{
+		// 超过 window 的旧值不参与计算，100 离开窗口后不再影响结果
+		{"median", config.Filter{Type: "median", Window: 3}, []float64{10, 30, 20, 100, 21, 22}, []float64{10, 20, 20, 30, 21, 22}},
+		{"median even", config.Filter{Type: "median", Window: 4}, []float64{1, 4, 2, 3}, []float64{1, 2.5, 2, 2.5}},
+		{"average", config.Filter{Type: "average", Window: 3}, []float64{1, 2, 3, 4, 8}, []float64{1, 1.5, 2, 3, 5}},
+		{"ema", config.Filter{Type: "ema", Alpha: 0.5}, []float64{10, 20, 20}, []float64{10, 15, 17.5}},
+		// 第一个值为 0 时同样作为初值
+		{"ema zero start", config.Filter{Type: "ema", Alpha: 0.5}, []float64{0, 10}, []float64{0, 5}},
+		// 前 3 次不判断；50 与之前的中位数 20 相差超过 5，替换为中位数，
+		// 尖峰仍然留在窗口中，之后与 [20 21 20 50] 的中位数 20.5 比较
+		{"spike", config.Filter{Type: "spike", Window: 5, Threshold: 5}, []float64{20, 21, 20, 50, 21, 22}, []float64{20, 21, 20, 20, 21, 22}},
+		{"spike early", config.Filter{Type: "spike", Window: 5, Threshold: 5}, []float64{20, 50, 80}, []float64{20, 50, 80}},
+		{"spike below", config.Filter{Type: "spike", Window: 3, Threshold: 5}, []float64{20, 20, 20, 10}, []float64{20, 20, 20, 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &filterState{conf: tt.conf}
+			var got []float64
+			for _, v := range tt.in {
+				got = append(got, st.update(v))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	dev := &device{ID: "filter-test", SlaveID: 1, Filters: []config.Filter{
+		{Key: "temperature", Type: "median", Window: 3, Output: "temperature", RawKey: "temperature_raw"},
+		{Key: "wind", Type: "average", Window: 2, Output: "wind_avg"},
+	}}
+	defer delete(filterStates, dev.ID)
+
+	steps := []struct {
+		in   map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			map[string]interface{}{"temperature": 20.0, "wind": 2.0},
+			map[string]interface{}{"temperature": 20.0, "temperature_raw": 20.0, "wind": 2.0, "wind_avg": 2.0},
+		},
+		{
+			// 读取失败的字段不滤波，也不进入窗口
+			map[string]interface{}{"wind": 4.0},
+			map[string]interface{}{"wind": 4.0, "wind_avg": 3.0},
+		},
+		{
+			map[string]interface{}{"temperature": 40.0, "wind": 6.0},
+			map[string]interface{}{"temperature": 30.0, "temperature_raw": 40.0, "wind": 6.0, "wind_avg": 5.0},
+		},
+	}
+	for i, s := range steps {
+		filterValues(dev, s.in)
+		if len(s.in) != len(s.want) {
+			t.Errorf("step %d: got %v, want %v", i, s.in, s.want)
+			continue
+		}
+		for key, want := range s.want {
+			if s.in[key] != want {
+				t.Errorf("step %d: %s = %v, want %v", i, key, s.in[key], want)
+			}
+		}
+	}
+
+	// 参数变化后重新开始
+	dev.Filters[1].Window = 3
+	values := map[string]interface{}{"wind": 10.0}
+	filterValues(dev, values)
+	if values["wind_avg"] != 10.0 {
+		t.Errorf("参数变化后 wind_avg = %v, want 10", values["wind_avg"])
+	}
+}
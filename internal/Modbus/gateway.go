@@ -0,0 +1,66 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"dataCollect/mqtt/publish"
+	"encoding/json"
+	"sync"
+)
+
+// 网关模式在启动时确定，修改后需要重启
+var gateway config.Gateway
+
+func gatewayMode() bool {
+	return gateway.Enabled
+}
+
+// gatewayMessage 网关格式的消息，gateway_data 为网关本身的数据，sub_device_data 以子设备编号为 key
+type gatewayMessage struct {
+	GatewayData   interface{}            `json:"gateway_data,omitempty"`
+	SubDeviceData map[string]interface{} `json:"sub_device_data,omitempty"`
+}
+
+func publishGateway(ctx context.Context, topic string, msg gatewayMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.WithField("topic", topic).WithError(err).Error("序列化网关消息失败")
+		return
+	}
+	publish.PublishMessage(ctx, topic, payload)
+}
+
+var (
+	onlineMu sync.Mutex
+	// 子设备最近一次采集是否读到数据，还没有采集过的设备不在其中
+	deviceOnline = make(map[string]bool)
+)
+
+// setOnline 记录子设备的在线状态，状态变化时返回 true
+func setOnline(dev *device, online bool) bool {
+	onlineMu.Lock()
+	defer onlineMu.Unlock()
+	prev, ok := deviceOnline[dev.ID]
+	deviceOnline[dev.ID] = online
+	return !ok || prev != online
+}
+
+// gatewayStatus 网关格式的状态消息，网关离线时所有子设备都按离线上报
+func gatewayStatus(online bool) []byte {
+	status := func(up bool) int {
+		if up && online {
+			return 1
+		}
+		return 0
+	}
+	msg := gatewayMessage{GatewayData: status(true), SubDeviceData: make(map[string]interface{})}
+	onlineMu.Lock()
+	for _, dev := range getConfig().Devices {
+		if up, ok := deviceOnline[dev.ID]; ok || !online {
+			msg.SubDeviceData[dev.ID] = status(up)
+		}
+	}
+	onlineMu.Unlock()
+	payload, _ := json.Marshal(msg)
+	return payload
+}
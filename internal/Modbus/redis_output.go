@@ -0,0 +1,99 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"dataCollect/internal/units"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 数据质量，写入 redis 的 <key>:quality 字段
+const (
+	QualityGood    = "good"
+	QualityBad     = "bad"     // 本次没有读到，值为上一次读到的数据
+	QualitySuspect = "suspect" // 合理性检查不通过，原因写入 <key>:fault，配置了 suppress 时值为上一次的数据
+)
+
+// writeRedis 把一次采集的结果写回 redis：hash 中本次读取的每个寄存器对应 <key>、<key>:ts、<key>:quality、<key>:fault 以及有单位时的 <key>:unit 字段，
+// 读取失败的寄存器只更新 quality，保留上一次的值和时间。redis 不可用时直接跳过
+func writeRedis(ctx context.Context, dev *device, regs []Register, values map[string]interface{}, faults map[string]string, ts time.Time) {
+	conf := config.Get().RedisOutput
+	if !conf.Enabled || len(regs) == 0 {
+		return
+	}
+	client, ok := initialize.RedisClient()
+	if !ok {
+		return
+	}
+
+	targets := conf.Units.Targets()
+	if conf.Units == (config.Units{}) {
+		targets = dev.Units.Targets()
+	}
+	fields := map[string]interface{}{"updated_at": ts.UnixMilli()}
+	entry := map[string]interface{}{"ts": ts.UnixMilli()}
+	var bad []string
+	for _, reg := range regs {
+		v, ok := values[reg.Key]
+		fault, suspect := faults[reg.Key]
+		switch {
+		case suspect:
+			fields[reg.Key+":quality"] = QualitySuspect
+			entry[reg.Key+":fault"] = fault
+		case ok:
+			fields[reg.Key+":quality"] = QualityGood
+		default:
+			fields[reg.Key+":quality"] = QualityBad
+			bad = append(bad, reg.Key)
+		}
+		// 配置了检查的字段恢复正常后清空原因
+		if suspect || slices.ContainsFunc(dev.Checks, func(c config.Check) bool { return c.Key == reg.Key }) {
+			fields[reg.Key+":fault"] = fault
+		}
+		if !ok {
+			continue
+		}
+		v = convertValue(v, reg.Unit, targets)
+		fields[reg.Key] = v
+		if unit := units.Target(reg.Unit, targets); unit != "" {
+			fields[reg.Key+":unit"] = unit
+		}
+		fields[reg.Key+":ts"] = ts.UnixMilli()
+		entry[reg.Key] = v
+	}
+	if len(bad) > 0 {
+		entry["bad"] = strings.Join(bad, ",")
+	}
+
+	pipe := client.Pipeline()
+	pipe.HSet(ctx, deviceKey(conf.Hash, dev), fields)
+	if conf.Stream != "" {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: deviceKey(conf.Stream, dev),
+			MaxLen: conf.MaxLen,
+			Approx: true,
+			Values: entry,
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && ctx.Err() == nil {
+		log.WithField("key", deviceKey(conf.Hash, dev)).WithError(err).Error("写入 redis 失败")
+	}
+}
+
+// 替换 key 中的 {device} 占位符，直连模式为设备 MAC，网关模式为子设备编号。
+// 有多个设备而 key 中没有占位符时在末尾加上 :{device}，避免互相覆盖
+func deviceKey(key string, dev *device) string {
+	id := MacAddr
+	if gatewayMode() {
+		id = dev.ID
+	}
+	if len(getConfig().Devices) > 1 && !strings.Contains(key, "{device}") {
+		key += ":{device}"
+	}
+	return strings.ReplaceAll(key, "{device}", id)
+}
@@ -0,0 +1,224 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"dataCollect/mqtt/publish"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 分组超时在该时间内汇总为一次事件上报
+const overrunReportInterval = time.Minute
+
+// pollGroup 一个采集分组的调度状态
+type pollGroup struct {
+	name     string
+	interval time.Duration
+	priority int
+	// 主分组(default)采集不属于其他分组的寄存器，并计算衍生量、ET0 等需要多个字段的数据
+	main bool
+	keys map[string]bool
+	// 下一次应当采集的时间
+	next time.Time
+	// 上次上报之后的超时次数和最大延迟
+	overruns   int
+	maxDelay   time.Duration
+	lastReport time.Time
+}
+
+// registers 返回分组在设备上要读取的寄存器
+func (g *pollGroup) registers(dev *device) []Register {
+	var regs []Register
+	for _, reg := range dev.Registers {
+		if g.keys[reg.Key] != g.main {
+			regs = append(regs, reg)
+		}
+	}
+	return regs
+}
+
+// scheduler 在同一条总线上轮流采集各分组，每次只采集一个到期的分组
+type scheduler struct {
+	groups []*pollGroup
+}
+
+// newScheduler 按配置创建分组，热加载时名称和周期都没有变化的分组保留原来的采集时间
+func newScheduler(cfg *collectConfig, prev *scheduler) *scheduler {
+	now := time.Now()
+	s := &scheduler{}
+	main := &pollGroup{name: "default", interval: cfg.PollInterval, main: true, keys: make(map[string]bool)}
+	s.groups = append(s.groups, main)
+	for _, gc := range cfg.Groups {
+		g := &pollGroup{name: gc.Name, interval: gc.Interval, priority: gc.Priority, keys: make(map[string]bool)}
+		for _, key := range gc.Registers {
+			g.keys[key] = true
+			main.keys[key] = true
+		}
+		s.groups = append(s.groups, g)
+	}
+	for _, g := range s.groups {
+		g.next = now
+		if prev == nil {
+			continue
+		}
+		for _, p := range prev.groups {
+			if p.name == g.name && p.interval == g.interval {
+				g.next, g.overruns, g.maxDelay, g.lastReport = p.next, p.overruns, p.maxDelay, p.lastReport
+			}
+		}
+	}
+	return s
+}
+
+// pick 返回下一个要采集的分组，没有到期的分组时返回 nil。
+// 已经错过一个周期的分组最先采集(等待最久的优先)，其余按优先级，优先级相同时先到期的优先
+func (s *scheduler) pick(now time.Time) *pollGroup {
+	var best *pollGroup
+	bestStarved := false
+	for _, g := range s.groups {
+		if g.next.After(now) {
+			continue
+		}
+		starved := now.Sub(g.next) >= g.interval
+		switch {
+		case best == nil:
+		case starved != bestStarved:
+			if !starved {
+				continue
+			}
+		case !starved && g.priority != best.priority:
+			if g.priority < best.priority {
+				continue
+			}
+		case !g.next.Before(best.next):
+			continue
+		}
+		best, bestStarved = g, starved
+	}
+	return best
+}
+
+// wait 返回距离最早到期的分组的时间
+func (s *scheduler) wait(now time.Time) time.Duration {
+	next := s.groups[0].next
+	for _, g := range s.groups[1:] {
+		if g.next.Before(next) {
+			next = g.next
+		}
+	}
+	return max(next.Sub(now), 0)
+}
+
+// finish 分组采集完成后计算下一次采集的时间。从到期到采集完成超过一个周期时记为超时，
+// 跳过错过的周期并按 overrunReportInterval 汇总上报 poll_overrun 事件
+func (s *scheduler) finish(ctx context.Context, g *pollGroup, end time.Time) {
+	delay := end.Sub(g.next)
+	g.next = g.next.Add(g.interval)
+	if !g.next.After(end) {
+		missed := end.Sub(g.next)/g.interval + 1
+		g.next = g.next.Add(missed * g.interval)
+		g.overruns++
+		g.maxDelay = max(g.maxDelay, delay)
+	}
+	if g.overruns > 0 && end.Sub(g.lastReport) >= overrunReportInterval {
+		reportOverrun(ctx, g)
+		g.overruns, g.maxDelay, g.lastReport = 0, 0, end
+	}
+}
+
+func reportOverrun(ctx context.Context, g *pollGroup) {
+	log.WithField("group", g.name).Warnf("采集分组 %d 次超过周期 %v，最大延迟 %v，总线上的读取太多或设备响应太慢",
+		g.overruns, g.interval, g.maxDelay.Round(time.Millisecond))
+	ev := eventSt{Method: "poll_overrun", Params: map[string]interface{}{
+		"group":        g.name,
+		"interval_ms":  g.interval.Milliseconds(),
+		"overruns":     g.overruns,
+		"max_delay_ms": g.maxDelay.Milliseconds(),
+	}}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.WithField("group", g.name).WithError(err).Error("序列化 poll_overrun 事件失败")
+		return
+	}
+	publish.PublishMessage(ctx, genEventTopic(), payload)
+}
+
+// sameGroups 热加载时判断分组配置是否变化
+func sameGroups(a, b []config.PollGroup) bool {
+	return slices.EqualFunc(a, b, func(x, y config.PollGroup) bool {
+		return x.Name == y.Name && x.Interval == y.Interval && x.Priority == y.Priority && slices.Equal(x.Registers, y.Registers)
+	})
+}
+
+// 其他分组的数据超过该分组 latestMaxPeriods 个周期没有更新时不再使用
+const latestMaxPeriods = 2
+
+// 各设备最近一次读到的数据，按读取的分组记录
+type latestValue struct {
+	value interface{}
+	group string
+	// 超过该时间后视为过期
+	expires time.Time
+}
+
+var (
+	latestMu sync.Mutex
+	// 设备编号 -> 字段 -> 最近一次的值
+	latest = make(map[string]map[string]latestValue)
+	// 设备编号 -> 分组 -> 最近一次是否读到数据
+	groupRead = make(map[string]map[string]bool)
+)
+
+// mergeLatest 用分组本次的数据替换该分组上一次的数据，返回设备所有分组最近读到且没有过期的数据
+func mergeLatest(dev *device, g *pollGroup, ts time.Time, values map[string]interface{}) map[string]interface{} {
+	latestMu.Lock()
+	defer latestMu.Unlock()
+	m, ok := latest[dev.ID]
+	if !ok {
+		m = make(map[string]latestValue)
+		latest[dev.ID] = m
+	}
+	for key, lv := range m {
+		if lv.group == g.name || ts.After(lv.expires) {
+			delete(m, key)
+		}
+	}
+	expires := ts.Add(latestMaxPeriods * g.interval)
+	for key, v := range values {
+		m[key] = latestValue{v, g.name, expires}
+	}
+	snapshot := make(map[string]interface{}, len(m))
+	for key, lv := range m {
+		snapshot[key] = lv.value
+	}
+	return snapshot
+}
+
+// groupOnline 记录分组本次是否读到数据，任一分组最近一次读到数据时设备在线
+func groupOnline(dev *device, g *pollGroup, read bool) bool {
+	latestMu.Lock()
+	defer latestMu.Unlock()
+	m, ok := groupRead[dev.ID]
+	if !ok {
+		m = make(map[string]bool)
+		groupRead[dev.ID] = m
+	}
+	m[g.name] = read
+	for _, r := range m {
+		if r {
+			return true
+		}
+	}
+	return false
+}
+
+// resetLatest 分组变化后清除按原分组记录的数据
+func resetLatest() {
+	latestMu.Lock()
+	defer latestMu.Unlock()
+	latest = make(map[string]map[string]latestValue)
+	groupRead = make(map[string]map[string]bool)
+}
@@ -0,0 +1,155 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"testing"
+	"time"
+)
+
+func testScheduler() *scheduler {
+	return newScheduler(&collectConfig{
+		PollInterval: 10 * time.Second,
+		Groups: []config.PollGroup{
+			{Name: "fast", Interval: time.Second, Priority: 5, Registers: []string{"windSpeed"}},
+			{Name: "slow", Interval: time.Minute, Priority: 5, Registers: []string{"pressure"}},
+		},
+	}, nil)
+}
+
+func TestPick(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// 各分组距离 now 的到期时间，负数为已经到期
+		next map[string]time.Duration
+		want string
+	}{
+		{"none due", map[string]time.Duration{"default": time.Second, "fast": time.Second, "slow": time.Second}, ""},
+		{"only due", map[string]time.Duration{"default": 0, "fast": time.Second, "slow": time.Second}, "default"},
+		// 都到期时优先级高的先采集
+		{"priority", map[string]time.Duration{"default": -2 * time.Second, "fast": 0, "slow": time.Second}, "fast"},
+		// 优先级相同时先到期的先采集
+		{"same priority", map[string]time.Duration{"default": time.Second, "fast": 0, "slow": -500 * time.Millisecond}, "slow"},
+		// 已经错过一个周期的分组不论优先级最先采集
+		{"starved", map[string]time.Duration{"default": -10 * time.Second, "fast": -500 * time.Millisecond, "slow": 0}, "default"},
+		{"starved high priority", map[string]time.Duration{"default": -10 * time.Second, "fast": -time.Second, "slow": 0}, "default"},
+		{"starved only high priority", map[string]time.Duration{"default": -9 * time.Second, "fast": -time.Second, "slow": 0}, "fast"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testScheduler()
+			for _, g := range s.groups {
+				g.next = now.Add(tt.next[g.name])
+			}
+			got := ""
+			if g := s.pick(now); g != nil {
+				got = g.name
+			}
+			if got != tt.want {
+				t.Errorf("pick = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := testScheduler()
+	for i, d := range []time.Duration{3 * time.Second, 2 * time.Second, 5 * time.Second} {
+		s.groups[i].next = now.Add(d)
+	}
+	if w := s.wait(now); w != 2*time.Second {
+		t.Errorf("wait = %v, want 2s", w)
+	}
+	s.groups[2].next = now.Add(-time.Second)
+	if w := s.wait(now); w != 0 {
+		t.Errorf("wait = %v, want 0", w)
+	}
+}
+
+func TestFinish(t *testing.T) {
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		elapsed  time.Duration // 从到期到采集完成的时间
+		next     time.Duration // 下一次采集距离 start 的时间
+		overruns int
+	}{
+		{"in time", 2 * time.Second, 10 * time.Second, 0},
+		// 正好用完一个周期也算超时，跳过错过的周期而不是连续补采
+		{"one period", 10 * time.Second, 20 * time.Second, 1},
+		{"skip periods", 25 * time.Second, 30 * time.Second, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &pollGroup{name: "default", interval: 10 * time.Second, next: start, lastReport: start}
+			s := &scheduler{groups: []*pollGroup{g}}
+			s.finish(context.Background(), g, start.Add(tt.elapsed))
+			if g.next != start.Add(tt.next) {
+				t.Errorf("next = %v, want %v", g.next.Sub(start), tt.next)
+			}
+			if g.overruns != tt.overruns {
+				t.Errorf("overruns = %d, want %d", g.overruns, tt.overruns)
+			}
+		})
+	}
+}
+
+// 超时在 overrunReportInterval 内汇总，上报后清零
+func TestOverrunAggregation(t *testing.T) {
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	g := &pollGroup{name: "fast", interval: time.Second, next: start, lastReport: start}
+	s := &scheduler{groups: []*pollGroup{g}}
+	ctx := context.Background()
+
+	end := start
+	delays := []time.Duration{1500 * time.Millisecond, 3 * time.Second, 1200 * time.Millisecond}
+	for _, d := range delays {
+		end = g.next.Add(d)
+		s.finish(ctx, g, end)
+	}
+	if g.overruns != 3 || g.maxDelay != 3*time.Second || g.lastReport != start {
+		t.Fatalf("overruns %d maxDelay %v lastReport %v, want 3 3s 未上报", g.overruns, g.maxDelay, g.lastReport.Sub(start))
+	}
+
+	// 超过 overrunReportInterval 后的下一次超时触发上报
+	g.next = start.Add(overrunReportInterval)
+	end = g.next.Add(2 * time.Second)
+	s.finish(ctx, g, end)
+	if g.overruns != 0 || g.maxDelay != 0 || g.lastReport != end {
+		t.Errorf("上报后 overruns %d maxDelay %v lastReport %v", g.overruns, g.maxDelay, g.lastReport.Sub(start))
+	}
+
+	// 没有超时时不上报
+	g.next = end.Add(2 * overrunReportInterval)
+	s.finish(ctx, g, g.next.Add(100*time.Millisecond))
+	if g.lastReport != end {
+		t.Errorf("没有超时时上报了 lastReport %v", g.lastReport.Sub(start))
+	}
+}
+
+func TestNewSchedulerKeepsState(t *testing.T) {
+	prev := testScheduler()
+	at := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, g := range prev.groups {
+		g.next, g.overruns = at, 2
+	}
+	s := newScheduler(&collectConfig{
+		PollInterval: 10 * time.Second,
+		Groups: []config.PollGroup{
+			{Name: "fast", Interval: time.Second, Priority: 1, Registers: []string{"windSpeed"}},
+			{Name: "slow", Interval: 2 * time.Minute, Registers: []string{"pressure"}},
+		},
+	}, prev)
+	for _, g := range s.groups {
+		kept := g.next == at && g.overruns == 2
+		// 周期变化的分组重新开始
+		if want := g.name != "slow"; kept != want {
+			t.Errorf("%s 保留状态 %v, want %v", g.name, kept, want)
+		}
+	}
+	if !s.groups[0].keys["windSpeed"] || !s.groups[0].keys["pressure"] || !s.groups[1].keys["windSpeed"] {
+		t.Errorf("keys default %v fast %v", s.groups[0].keys, s.groups[1].keys)
+	}
+}
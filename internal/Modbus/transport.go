@@ -0,0 +1,101 @@
+package modbus
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// 支持的读功能码
+const (
+	FuncReadCoils            = 1
+	FuncReadDiscreteInputs   = 2
+	FuncReadHoldingRegisters = 3
+	FuncReadInputRegisters   = 4
+)
+
+// Connection 一条 RTU 串口连接，Handler 用于切换从站地址和关闭串口
+type Connection struct {
+	Handler *modbus.RTUClientHandler
+	Client  modbus.Client
+}
+
+// NewRTUHandler 按串口配置创建 RTU 连接，采集程序和诊断命令共用
+func NewRTUHandler(conf *config.Modbus) *modbus.RTUClientHandler {
+	handler := modbus.NewRTUClientHandler(conf.Port)
+	handler.BaudRate = conf.BaudRate
+	handler.DataBits = conf.DataBits
+	handler.Parity = conf.Parity
+	handler.StopBits = conf.StopBits
+
+	handler.SlaveId = byte(conf.SlaveID)
+	handler.Timeout = conf.Timeout
+	return handler
+}
+
+// ReadFunction 按功能码读取，返回原始数据
+func ReadFunction(client modbus.Client, function int, address, quantity uint16) ([]byte, error) {
+	switch function {
+	case FuncReadCoils:
+		return client.ReadCoils(address, quantity)
+	case FuncReadDiscreteInputs:
+		return client.ReadDiscreteInputs(address, quantity)
+	case FuncReadHoldingRegisters, 0:
+		return client.ReadHoldingRegisters(address, quantity)
+	case FuncReadInputRegisters:
+		return client.ReadInputRegisters(address, quantity)
+	default:
+		return nil, fmt.Errorf("不支持的功能码 %d", function)
+	}
+}
+
+// ReadValues 按寄存器表逐个读取并解析，读取或解析失败的寄存器记录在 errs 中
+func ReadValues(ctx context.Context, client modbus.Client, regs []Register) (map[string]interface{}, map[string]error) {
+	values := make(map[string]interface{})
+	errs := make(map[string]error)
+	for _, reg := range regs {
+		// 退出时不再继续读取剩余的寄存器
+		if ctx.Err() != nil {
+			break
+		}
+		results, err := ReadFunction(client, reg.Function, reg.Address, reg.Length)
+		if err != nil {
+			errs[reg.Key] = fmt.Errorf("读取 %s 失败: %w", reg.Name, err)
+			continue
+		}
+		value, err := reg.Handler(results)
+		if err != nil {
+			errs[reg.Key] = fmt.Errorf("解析 %s 失败: %v", reg.Name, err)
+			continue
+		}
+		values[reg.Key] = value
+	}
+	return values, errs
+}
+
+// ErrorCode 把读写错误归类为便于日志检索的错误码：
+// 设备异常响应为 exception_<异常码>，其余为 timeout、crc、bus_down、canceled、io
+func ErrorCode(err error) string {
+	var mbErr *modbus.ModbusError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &mbErr):
+		return fmt.Sprintf("exception_%d", mbErr.ExceptionCode)
+	case errors.Is(err, serial.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrBusDown):
+		return "bus_down"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case strings.Contains(err.Error(), "crc"):
+		return "crc"
+	default:
+		return "io"
+	}
+}
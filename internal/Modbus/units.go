@@ -0,0 +1,76 @@
+package modbus
+
+import (
+	"dataCollect/internal/config"
+	"dataCollect/internal/derived"
+	"dataCollect/internal/et0"
+	"dataCollect/internal/solar"
+	"dataCollect/internal/units"
+	"maps"
+)
+
+// sourceUnits 返回设备上报的各字段计算时的单位：寄存器的 unit、衍生量、ET0 和太阳辐射累计值
+func (d *device) sourceUnits() map[string]string {
+	src := make(map[string]string)
+	for _, reg := range d.Registers {
+		if reg.Unit != "" {
+			src[reg.Key] = reg.Unit
+		}
+	}
+	// 滤波结果和原始值与滤波前的字段单位相同
+	for _, f := range d.Filters {
+		if u, ok := src[f.Key]; ok {
+			src[f.Output] = u
+			if f.RawKey != "" {
+				src[f.RawKey] = u
+			}
+		}
+	}
+	for _, m := range d.Derived.Metrics {
+		src[m] = derived.Units[m]
+	}
+	conf := config.Get()
+	if conf.ET0.Enabled {
+		maps.Copy(src, et0.Units)
+	}
+	if conf.Solar.Enabled {
+		maps.Copy(src, solar.Units())
+	}
+	return src
+}
+
+// outputUnits 返回设备上报 MQTT 时各字段换算后的单位，作为属性上报供平台显示
+func outputUnits(d *device) map[string]string {
+	targets := d.Units.Targets()
+	out := make(map[string]string)
+	for key, unit := range d.sourceUnits() {
+		out[key] = units.Target(unit, targets)
+	}
+	return out
+}
+
+// convertUnits 按输出单位换算，返回新的 map，原来的 values 保持计算时的单位，供历史数据和 ET0 等使用
+func convertUnits(values map[string]interface{}, src, targets map[string]string) map[string]interface{} {
+	if len(targets) == 0 {
+		return values
+	}
+	out := make(map[string]interface{}, len(values))
+	for key, v := range values {
+		out[key] = convertValue(v, src[key], targets)
+	}
+	return out
+}
+
+// convertValue 换算一个值，没有单位或不需要换算时原样返回
+func convertValue(v interface{}, from string, targets map[string]string) interface{} {
+	f, ok := v.(float64)
+	to := units.Target(from, targets)
+	if !ok || from == "" || to == units.Normalize(from) {
+		return v
+	}
+	c, err := units.Convert(f, from, to)
+	if err != nil {
+		return v
+	}
+	return units.Round(c)
+}
@@ -0,0 +1,340 @@
+// Package alarm 边缘告警规则：每次采集后按 alarms.rules 检查，告警产生和解除时生成事件并写入 redis
+package alarm
+
+import (
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Event 告警事件，method 为 alarm_raise 或 alarm_clear
+type Event struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// 一条规则在一个设备上的状态
+type ruleState struct {
+	active    bool
+	since     time.Time // 告警产生的时间
+	lastClear time.Time
+	// 各条件开始连续满足的时间，零值表示当前不满足
+	condSince []time.Time
+	condMet   []bool
+	raise     Event // 产生告警时的事件，写入 redis 的当前告警
+}
+
+// 一次采集的值，用于计算窗口内的变化量
+type sample struct {
+	t time.Time
+	v float64
+}
+
+type deviceState struct {
+	rules   map[string]*ruleState
+	samples map[string][]sample
+}
+
+var (
+	log     = initialize.Logger("alarm")
+	mu      sync.Mutex
+	devices = make(map[string]*deviceState)
+	// 启动后第一次写入 redis 前清除上次运行留下的告警
+	redisReset bool
+)
+
+// Evaluate 用一个设备本次采集的数据检查所有规则，返回产生和解除的告警事件。
+// device 为网关模式下的子设备编号，直连模式为空；values 中的数值使用寄存器的原始单位
+func Evaluate(ctx context.Context, device string, ts time.Time, values map[string]interface{}) []Event {
+	conf := config.Get().Alarms
+	if !conf.Enabled {
+		return nil
+	}
+	mu.Lock()
+	ds, ok := devices[device]
+	if !ok {
+		ds = &deviceState{rules: make(map[string]*ruleState), samples: make(map[string][]sample)}
+		devices[device] = ds
+	}
+	ds.record(conf.Rules, ts, values)
+
+	var events []Event
+	for i := range conf.Rules {
+		r := &conf.Rules[i]
+		if len(r.Devices) > 0 && !slices.Contains(r.Devices, device) {
+			continue
+		}
+		rs, ok := ds.rules[r.Name]
+		if !ok {
+			rs = &ruleState{}
+			ds.rules[r.Name] = rs
+		}
+		// 热加载修改了条件时重新计时
+		if len(rs.condSince) != len(r.Conditions) {
+			rs.condSince = make([]time.Time, len(r.Conditions))
+			rs.condMet = make([]bool, len(r.Conditions))
+		}
+		if ev, ok := ds.evaluate(r, rs, device, ts, values); ok {
+			events = append(events, ev)
+		}
+	}
+	// 热加载删除了规则时解除对应的告警
+	for name, rs := range ds.rules {
+		if !slices.ContainsFunc(conf.Rules, func(r config.AlarmRule) bool { return r.Name == name }) {
+			if rs.active {
+				events = append(events, clearEvent(rs, ts, "规则已删除"))
+			}
+			delete(ds.rules, name)
+		}
+	}
+	mu.Unlock()
+
+	writeRedis(ctx, &conf, device, events)
+	return events
+}
+
+// record 保存窗口条件用到的字段的历史值，只保留最长窗口内的数据
+func (ds *deviceState) record(rules []config.AlarmRule, ts time.Time, values map[string]interface{}) {
+	windows := make(map[string]time.Duration)
+	for _, r := range rules {
+		for _, c := range r.Conditions {
+			if c.Window > 0 {
+				windows[c.Field] = max(windows[c.Field], c.Window)
+			}
+		}
+	}
+	for field, window := range windows {
+		s := ds.samples[field]
+		if v, ok := values[field].(float64); ok {
+			s = append(s, sample{ts, v})
+		}
+		i := 0
+		for i < len(s) && ts.Sub(s[i].t) > window {
+			i++
+		}
+		ds.samples[field] = s[i:]
+	}
+	for field := range ds.samples {
+		if _, ok := windows[field]; !ok {
+			delete(ds.samples, field)
+		}
+	}
+}
+
+// value 返回条件比较的值，窗口条件为窗口内的变化量
+func (ds *deviceState) value(c *config.AlarmCondition, ts time.Time, values map[string]interface{}) (float64, bool) {
+	if c.Window == 0 {
+		v, ok := values[c.Field].(float64)
+		return v, ok
+	}
+	var s []sample
+	for _, x := range ds.samples[c.Field] {
+		if ts.Sub(x.t) <= c.Window {
+			s = append(s, x)
+		}
+	}
+	if len(s) < 2 {
+		return 0, false
+	}
+	if c.Agg == "increase" {
+		sum := 0.0
+		for i := 1; i < len(s); i++ {
+			sum += math.Max(s[i].v-s[i-1].v, 0)
+		}
+		return sum, true
+	}
+	return s[len(s)-1].v - s[0].v, true
+}
+
+func (ds *deviceState) evaluate(r *config.AlarmRule, rs *ruleState, device string, ts time.Time, values map[string]interface{}) (Event, bool) {
+	// met 为当前是否满足(告警中时考虑回差)，ready 为满足的时间是否已达到 for
+	met := make([]bool, len(r.Conditions))
+	ready := make([]bool, len(r.Conditions))
+	current := make(map[string]interface{})
+	for i := range r.Conditions {
+		c := &r.Conditions[i]
+		v, ok := ds.value(c, ts, values)
+		if !ok {
+			// 读取失败时保持上一次的结果
+			met[i] = rs.condMet[i]
+		} else {
+			current[c.Field] = v
+			met[i] = compare(c, v, rs.active)
+			if !met[i] {
+				rs.condSince[i] = time.Time{}
+			} else if rs.condSince[i].IsZero() {
+				rs.condSince[i] = ts
+			}
+		}
+		rs.condMet[i] = met[i]
+		ready[i] = met[i] && !rs.condSince[i].IsZero() && ts.Sub(rs.condSince[i]) >= c.For
+	}
+
+	if !rs.active {
+		if !combine(r.Match, ready) || (!rs.lastClear.IsZero() && ts.Sub(rs.lastClear) < r.Cooldown) {
+			return Event{}, false
+		}
+		rs.active, rs.since = true, ts
+		params := map[string]interface{}{
+			"rule":     r.Name,
+			"severity": r.Severity,
+			"message":  message(r),
+			"values":   current,
+			"ts":       ts.UnixMilli(),
+		}
+		if device != "" {
+			params["sub_device"] = device
+		}
+		rs.raise = Event{Method: "alarm_raise", Params: params}
+		log.WithField("device", device).Warnf("告警 %s(%s): %s %v", r.Name, r.Severity, message(r), current)
+		return rs.raise, true
+	}
+	if combine(r.Match, met) {
+		return Event{}, false
+	}
+	ev := clearEvent(rs, ts, "")
+	ev.Params["values"] = current
+	log.WithField("device", device).Infof("告警解除 %s，持续 %v", r.Name, ts.Sub(rs.since).Round(time.Second))
+	return ev, true
+}
+
+// clearEvent 解除告警，事件中带上告警产生时的规则信息和持续时间
+func clearEvent(rs *ruleState, ts time.Time, reason string) Event {
+	params := make(map[string]interface{})
+	for _, k := range []string{"rule", "severity", "message", "sub_device"} {
+		if v, ok := rs.raise.Params[k]; ok {
+			params[k] = v
+		}
+	}
+	params["since"] = rs.since.UnixMilli()
+	params["duration"] = int64(ts.Sub(rs.since).Seconds())
+	params["ts"] = ts.UnixMilli()
+	if reason != "" {
+		params["reason"] = reason
+	}
+	rs.active, rs.lastClear = false, ts
+	return Event{Method: "alarm_clear", Params: params}
+}
+
+// compare 按 op 比较，告警中时阈值向解除的方向移动 hysteresis
+func compare(c *config.AlarmCondition, v float64, active bool) bool {
+	th := c.Value
+	switch c.Op {
+	case ">":
+		if active {
+			th -= c.Hysteresis
+		}
+		return v > th
+	case ">=":
+		if active {
+			th -= c.Hysteresis
+		}
+		return v >= th
+	case "<":
+		if active {
+			th += c.Hysteresis
+		}
+		return v < th
+	case "<=":
+		if active {
+			th += c.Hysteresis
+		}
+		return v <= th
+	}
+	return false
+}
+
+func combine(match string, results []bool) bool {
+	if match == "any" {
+		return slices.Contains(results, true)
+	}
+	return len(results) > 0 && !slices.Contains(results, false)
+}
+
+// message 规则没有填写说明时按条件生成，如 "temperature < 2 持续 10m0s"
+func message(r *config.AlarmRule) string {
+	if r.Message != "" {
+		return r.Message
+	}
+	parts := make([]string, 0, len(r.Conditions))
+	for _, c := range r.Conditions {
+		field := c.Field
+		if c.Window > 0 {
+			field = fmt.Sprintf("%s %v 内的%s", c.Field, c.Window, map[string]string{"delta": "变化量", "increase": "增加量"}[c.Agg])
+		}
+		p := fmt.Sprintf("%s %s %v", field, c.Op, c.Value)
+		if c.For > 0 {
+			p += fmt.Sprintf(" 持续 %v", c.For)
+		}
+		parts = append(parts, p)
+	}
+	sep := " 且 "
+	if r.Match == "any" {
+		sep = " 或 "
+	}
+	return strings.Join(parts, sep)
+}
+
+// writeRedis 当前告警写入 hash(网关模式下字段名为 <子设备编号>:<规则名>)，事件发布到频道，redis 不可用时跳过
+func writeRedis(ctx context.Context, conf *config.Alarms, device string, events []Event) {
+	client, ok := initialize.RedisClient()
+	if !ok {
+		return
+	}
+	pipe := client.Pipeline()
+	// 第一次写入时清除上次运行留下的告警，并写入 redis 不可用期间产生的告警
+	mu.Lock()
+	if !redisReset {
+		pipe.Del(ctx, conf.RedisHash)
+		for dev, ds := range devices {
+			for _, rs := range ds.rules {
+				if rs.active {
+					hsetEvent(ctx, pipe, conf.RedisHash, dev, rs.raise)
+				}
+			}
+		}
+		redisReset = true
+	}
+	mu.Unlock()
+	for _, ev := range events {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			continue
+		}
+		if ev.Method == "alarm_raise" {
+			hsetEvent(ctx, pipe, conf.RedisHash, device, ev)
+		} else {
+			pipe.HDel(ctx, conf.RedisHash, hashField(device, ev))
+		}
+		pipe.Publish(ctx, conf.RedisChannel, payload)
+	}
+	if pipe.Len() == 0 {
+		return
+	}
+	if _, err := pipe.Exec(ctx); err != nil && ctx.Err() == nil {
+		log.WithField("key", conf.RedisHash).WithError(err).Error("写入告警到 redis 失败")
+	}
+}
+
+func hsetEvent(ctx context.Context, pipe redis.Pipeliner, key, device string, ev Event) {
+	if payload, err := json.Marshal(ev); err == nil {
+		pipe.HSet(ctx, key, hashField(device, ev), payload)
+	}
+}
+
+func hashField(device string, ev Event) string {
+	rule, _ := ev.Params["rule"].(string)
+	if device == "" {
+		return rule
+	}
+	return device + ":" + rule
+}
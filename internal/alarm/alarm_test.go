@@ -0,0 +1,147 @@
+package alarm
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"testing"
+	"time"
+)
+
+type step struct {
+	at     time.Duration // 距离第一次采集的时间
+	values map[string]interface{}
+	want   string // 产生的事件，空为没有事件
+}
+
+func temp(v float64) map[string]interface{} { return map[string]interface{}{"temperature": v} }
+
+func rain(v float64) map[string]interface{} { return map[string]interface{}{"rainfall": v} }
+
+func TestEvaluate(t *testing.T) {
+	hot := config.AlarmCondition{Field: "temperature", Op: ">", Value: 30}
+	tests := []struct {
+		name  string
+		rule  config.AlarmRule
+		steps []step
+	}{
+		{"threshold", config.AlarmRule{Conditions: []config.AlarmCondition{hot}}, []step{
+			{0, temp(25), ""},
+			{time.Minute, temp(31), "alarm_raise"},
+			{2 * time.Minute, temp(32), ""},
+			{3 * time.Minute, temp(30), "alarm_clear"},
+		}},
+		{"for", config.AlarmRule{Conditions: []config.AlarmCondition{{Field: "temperature", Op: ">", Value: 30, For: 2 * time.Minute}}}, []step{
+			{0, temp(31), ""},
+			{time.Minute, temp(31), ""},
+			{2 * time.Minute, temp(31), "alarm_raise"},
+		}},
+		// 中途不满足时重新计时
+		{"for reset", config.AlarmRule{Conditions: []config.AlarmCondition{{Field: "temperature", Op: ">", Value: 30, For: 2 * time.Minute}}}, []step{
+			{0, temp(31), ""},
+			{time.Minute, temp(29), ""},
+			{2 * time.Minute, temp(31), ""},
+			{3 * time.Minute, temp(31), ""},
+			{4 * time.Minute, temp(31), "alarm_raise"},
+		}},
+		{"hysteresis", config.AlarmRule{Conditions: []config.AlarmCondition{{Field: "temperature", Op: ">", Value: 30, Hysteresis: 2}}}, []step{
+			{0, temp(31), "alarm_raise"},
+			{time.Minute, temp(29), ""},
+			{2 * time.Minute, temp(28), "alarm_clear"},
+		}},
+		{"hysteresis below", config.AlarmRule{Conditions: []config.AlarmCondition{{Field: "temperature", Op: "<", Value: 2, Hysteresis: 1}}}, []step{
+			{0, temp(1), "alarm_raise"},
+			{time.Minute, temp(2.5), ""},
+			{2 * time.Minute, temp(3.5), "alarm_clear"},
+			{3 * time.Minute, temp(1.5), "alarm_raise"},
+		}},
+		{"cooldown", config.AlarmRule{Conditions: []config.AlarmCondition{hot}, Cooldown: 10 * time.Minute}, []step{
+			{0, temp(31), "alarm_raise"},
+			{time.Minute, temp(29), "alarm_clear"},
+			{5 * time.Minute, temp(31), ""},
+			{11 * time.Minute, temp(31), "alarm_raise"},
+		}},
+		// 读取失败时保持上一次的结果
+		{"missing value", config.AlarmRule{Conditions: []config.AlarmCondition{hot}}, []step{
+			{0, temp(31), "alarm_raise"},
+			{time.Minute, map[string]interface{}{}, ""},
+			{2 * time.Minute, map[string]interface{}{"temperature": "err"}, ""},
+			{3 * time.Minute, temp(29), "alarm_clear"},
+		}},
+		{"window delta", config.AlarmRule{Conditions: []config.AlarmCondition{{Field: "rainfall", Op: ">=", Value: 10, Window: time.Hour, Agg: "delta"}}}, []step{
+			{0, rain(0), ""},
+			{30 * time.Minute, rain(5), ""},
+			{50 * time.Minute, rain(12), "alarm_raise"},
+			// 0 时刻的值离开窗口，变化量为 12-5
+			{70 * time.Minute, rain(12), "alarm_clear"},
+		}},
+		// 累计值清零后 delta 为负，increase 只累加增加量
+		{"window increase", config.AlarmRule{Conditions: []config.AlarmCondition{{Field: "rainfall", Op: ">=", Value: 10, Window: time.Hour, Agg: "increase"}}}, []step{
+			{0, rain(0), ""},
+			{20 * time.Minute, rain(8), ""},
+			{30 * time.Minute, rain(0), ""},
+			{40 * time.Minute, rain(4), "alarm_raise"},
+		}},
+		{"match all", config.AlarmRule{Match: "all", Conditions: []config.AlarmCondition{hot, {Field: "humidity", Op: "<", Value: 20}}}, []step{
+			{0, map[string]interface{}{"temperature": 31.0, "humidity": 50.0}, ""},
+			{time.Minute, map[string]interface{}{"temperature": 31.0, "humidity": 10.0}, "alarm_raise"},
+			{2 * time.Minute, map[string]interface{}{"temperature": 29.0, "humidity": 10.0}, "alarm_clear"},
+		}},
+		{"match any", config.AlarmRule{Match: "any", Conditions: []config.AlarmCondition{hot, {Field: "wind_speed", Op: ">", Value: 20}}}, []step{
+			{0, map[string]interface{}{"temperature": 25.0, "wind_speed": 5.0}, ""},
+			{time.Minute, map[string]interface{}{"temperature": 25.0, "wind_speed": 25.0}, "alarm_raise"},
+			{2 * time.Minute, map[string]interface{}{"temperature": 31.0, "wind_speed": 5.0}, ""},
+			{3 * time.Minute, map[string]interface{}{"temperature": 25.0, "wind_speed": 5.0}, "alarm_clear"},
+		}},
+	}
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices = make(map[string]*deviceState)
+			tt.rule.Name = "test"
+			config.Set(&config.Config{Alarms: config.Alarms{Enabled: true, Rules: []config.AlarmRule{tt.rule}}})
+			for i, s := range tt.steps {
+				events := Evaluate(context.Background(), "", start.Add(s.at), s.values)
+				got := ""
+				if len(events) > 0 {
+					got = events[0].Method
+				}
+				if len(events) > 1 || got != s.want {
+					t.Errorf("step %d: events %v, want %q", i, events, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateDevices(t *testing.T) {
+	devices = make(map[string]*deviceState)
+	rule := config.AlarmRule{Name: "hot", Conditions: []config.AlarmCondition{{Field: "temperature", Op: ">", Value: 30}}, Devices: []string{"A1"}}
+	config.Set(&config.Config{Alarms: config.Alarms{Enabled: true, Rules: []config.AlarmRule{rule}}})
+	ts := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if events := Evaluate(context.Background(), "B1", ts, temp(35)); len(events) != 0 {
+		t.Errorf("不适用的设备产生了告警 %v", events)
+	}
+	events := Evaluate(context.Background(), "A1", ts, temp(35))
+	if len(events) != 1 || events[0].Params["sub_device"] != "A1" {
+		t.Fatalf("events %v", events)
+	}
+
+	// 热加载删除规则后解除告警
+	config.Set(&config.Config{Alarms: config.Alarms{Enabled: true}})
+	events = Evaluate(context.Background(), "A1", ts.Add(time.Minute), temp(35))
+	if len(events) != 1 || events[0].Method != "alarm_clear" || events[0].Params["reason"] != "规则已删除" || events[0].Params["sub_device"] != "A1" {
+		t.Errorf("删除规则后 events %v", events)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	r := &config.AlarmRule{Match: "any", Conditions: []config.AlarmCondition{
+		{Field: "temperature", Op: "<", Value: 2, For: 10 * time.Minute},
+		{Field: "rainfall", Op: ">=", Value: 10, Window: time.Hour, Agg: "increase"},
+	}}
+	want := "temperature < 2 持续 10m0s 或 rainfall 1h0m0s 内的增加量 >= 10"
+	if got := message(r); got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package attributes
+
+import (
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+var log = initialize.Logger("attributes")
+
+var (
+	// ErrNotFound 属性来源中没有对应的值，例如 redis key 或文件不存在
+	ErrNotFound = errors.New("属性值不存在")
+	// ErrUnavailable 属性来源暂时不可用，目前只有 redis 断开时出现
+	ErrUnavailable = errors.New("属性来源不可用")
+)
+
+// Collect 按配置读取所有属性，读取失败的属性不上报。
+// 来源不可用的属性上报为 null，表示当前无法获取，断开日志由 redis 模块记录，这里不再重复
+func Collect(ctx context.Context, items []config.Attribute) map[string]interface{} {
+	values := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		v, err := Read(ctx, item)
+		if errors.Is(err, ErrUnavailable) {
+			values[item.Name] = nil
+			continue
+		}
+		if err != nil {
+			log.WithFields(logrus.Fields{"attribute": item.Name, "source": item.Source}).Warnf("读取属性失败: %v", err)
+			continue
+		}
+		values[item.Name] = v
+	}
+	return values
+}
+
+// Read 读取一个属性并按 transform 转换
+func Read(ctx context.Context, item config.Attribute) (interface{}, error) {
+	raw, err := readSource(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return Transform(item.Transform, raw)
+}
+
+func readSource(ctx context.Context, item config.Attribute) (string, error) {
+	switch item.Source {
+	case "static":
+		return item.Key, nil
+	case "env":
+		v, ok := os.LookupEnv(item.Key)
+		if !ok {
+			return "", ErrNotFound
+		}
+		return v, nil
+	case "file":
+		data, err := os.ReadFile(item.Key)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return strings.TrimSpace(string(data)), err
+	case "command":
+		cctx, cancel := context.WithTimeout(ctx, item.Timeout)
+		defer cancel()
+		out, err := exec.CommandContext(cctx, "sh", "-c", item.Key).Output()
+		if err != nil {
+			return "", fmt.Errorf("执行 %q 失败: %v", item.Key, err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	case "redis_hash", "redis_string":
+		client, ok := initialize.RedisClient()
+		if !ok {
+			return "", ErrUnavailable
+		}
+		var v string
+		var err error
+		if item.Source == "redis_hash" {
+			v, err = client.HGet(ctx, item.Key, item.Field).Result()
+		} else {
+			v, err = client.Get(ctx, item.Key).Result()
+		}
+		if errors.Is(err, redis.Nil) {
+			return "", ErrNotFound
+		}
+		return v, err
+	}
+	return "", fmt.Errorf("不支持的来源 %q", item.Source)
+}
+
+// Transform 把读取到的字符串转换为上报的值，t 为空时原样上报
+func Transform(t, raw string) (interface{}, error) {
+	switch t {
+	case "":
+		return raw, nil
+	case "upper":
+		return strings.ToUpper(raw), nil
+	case "lower":
+		return strings.ToLower(raw), nil
+	case "int":
+		return strconv.ParseInt(strings.TrimSpace(raw), 0, 64)
+	case "float":
+		return strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	case "bool":
+		return strconv.ParseBool(strings.TrimSpace(raw))
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if expr, ok := strings.CutPrefix(t, "regex:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		// 有分组时取第一个分组，否则取整个匹配
+		m := re.FindStringSubmatch(raw)
+		switch {
+		case m == nil:
+			return nil, fmt.Errorf("%q 不匹配 %s", raw, expr)
+		case len(m) > 1:
+			return m[1], nil
+		default:
+			return m[0], nil
+		}
+	}
+	return nil, fmt.Errorf("不支持的 transform %q", t)
+}
@@ -0,0 +1,109 @@
+package attributes
+
+import (
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// 订阅失败或 redis 不可用时的重试间隔
+	watchRetry = 5 * time.Second
+	// 等待通知的超时，超时后检查配置或 redis 客户端是否变化
+	watchCheck = 30 * time.Second
+)
+
+// Watch 按 attributes.watch 订阅 redis 通知，属性相关的 key 变化或频道收到消息时向返回的 channel 发送通知。
+// 配置热加载、redis 断开重连后会自动重新订阅
+func Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	go func() {
+		for ctx.Err() == nil {
+			conf := config.Get()
+			channels := watchChannels(&conf.Attributes, conf.DB.Redis.DB)
+			client, ok := initialize.RedisClient()
+			if len(channels) > 0 && ok {
+				if err := subscribe(ctx, client, conf, channels, changes); err != nil {
+					log.Warnf("订阅 redis 通知失败: %v", err)
+				} else {
+					continue
+				}
+			}
+			select {
+			case <-time.After(watchRetry):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return changes
+}
+
+// 需要订阅的频道，keyspace 模式下为 items 中每个 redis key 的 keyspace 频道
+func watchChannels(a *config.Attributes, db int) []string {
+	switch a.Watch {
+	case "pubsub":
+		return a.Channels
+	case "keyspace":
+		var channels []string
+		for _, item := range a.Items {
+			if item.Source != "redis_hash" && item.Source != "redis_string" {
+				continue
+			}
+			ch := fmt.Sprintf("__keyspace@%d__:%s", db, item.Key)
+			if !slices.Contains(channels, ch) {
+				channels = append(channels, ch)
+			}
+		}
+		return channels
+	}
+	return nil
+}
+
+// subscribe 订阅并转发通知，配置或 redis 客户端变化时返回 nil，由调用方重新订阅
+func subscribe(ctx context.Context, client *redis.Client, conf *config.Config, channels []string, changes chan<- struct{}) error {
+	if conf.Attributes.Watch == "keyspace" && conf.Attributes.NotifyEvents != "" {
+		if err := client.ConfigSet(ctx, "notify-keyspace-events", conf.Attributes.NotifyEvents).Err(); err != nil {
+			log.Warnf("设置 notify-keyspace-events 失败: %v", err)
+		}
+	}
+	ps := client.Subscribe(ctx, channels...)
+	defer ps.Close()
+	if _, err := ps.Receive(ctx); err != nil {
+		return err
+	}
+	log.Infof("已订阅 redis 通知: %v", channels)
+
+	for {
+		msg, err := ps.ReceiveTimeout(ctx, watchCheck)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			cur := config.Get()
+			curClient, ok := initialize.RedisClient()
+			if !ok || curClient != client || !slices.Equal(channels, watchChannels(&cur.Attributes, cur.DB.Redis.DB)) ||
+				cur.Attributes.NotifyEvents != conf.Attributes.NotifyEvents {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if m, ok := msg.(*redis.Message); ok {
+			log.Debugf("收到 redis 通知 %s: %s", m.Channel, m.Payload)
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
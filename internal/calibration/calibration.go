@@ -0,0 +1,216 @@
+// Package calibration 按校准表修正读到的数据，通过 MQTT 命令设置的校准保存在本地文件中，重启后仍然生效
+package calibration
+
+import (
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"dataCollect/internal/fileutil"
+	"dataCollect/internal/units"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+)
+
+// 校准的来源
+const (
+	SourceConfig = "config" // 配置文件中的 calibration
+	SourceRemote = "remote" // MQTT 命令设置
+)
+
+// Entry 一个字段当前生效的校准
+type Entry struct {
+	config.Calibration
+	Source string `json:"source"`
+	// 按读数排序的校准点
+	sorted [][]float64
+}
+
+func newEntry(c config.Calibration, source string) Entry {
+	e := Entry{Calibration: c, Source: source}
+	if len(c.Points) > 1 {
+		e.sorted = slices.Clone(c.Points)
+		slices.SortFunc(e.sorted, func(a, b []float64) int {
+			switch {
+			case a[0] < b[0]:
+				return -1
+			case a[0] > b[0]:
+				return 1
+			}
+			return 0
+		})
+	}
+	return e
+}
+
+// 一个设备生成好的校准表，配置中的校准或命令设置的校准变化后重新生成
+type cachedTable struct {
+	conf  []config.Calibration
+	table map[string]Entry
+}
+
+var (
+	log = initialize.Logger("calibration")
+	mu  sync.Mutex
+	// 设备编号 -> 字段 -> 命令设置的校准，第一次使用时从 calibration_file 读取
+	remote map[string]map[string]config.Calibration
+	// remote 读取自的文件
+	remotePath string
+	// 设备编号 -> 校准表
+	tables = make(map[string]*cachedTable)
+)
+
+// Table 返回设备当前生效的校准表，conf 为设备配置中的校准，同一字段优先使用命令设置的。
+// 返回的表在多次采集之间共用，不能修改
+func Table(device string, conf []config.Calibration) map[string]Entry {
+	mu.Lock()
+	defer mu.Unlock()
+	load()
+	if t, ok := tables[device]; ok && sameCalibrations(t.conf, conf) {
+		return t.table
+	}
+	table := make(map[string]Entry)
+	for _, c := range conf {
+		table[c.Key] = newEntry(c, SourceConfig)
+	}
+	for key, c := range remote[device] {
+		table[key] = newEntry(c, SourceRemote)
+	}
+	tables[device] = &cachedTable{conf, table}
+	return table
+}
+
+// Apply 按校准表修正 values 中的数值，values 使用寄存器的原始单位
+func Apply(device string, conf []config.Calibration, values map[string]interface{}) {
+	for key, e := range Table(device, conf) {
+		if v, ok := values[key].(float64); ok {
+			values[key] = units.Round(e.apply(v))
+		}
+	}
+}
+
+func (e *Entry) apply(v float64) float64 {
+	if len(e.Points) == 0 {
+		return v*e.Gain + e.Offset
+	}
+	if len(e.Points) == 1 {
+		return v + e.Points[0][1] - e.Points[0][0]
+	}
+	// 找到 v 所在的线段，超出范围时使用两端的线段
+	points := e.sorted
+	i := 1
+	for i < len(points)-1 && v > points[i][0] {
+		i++
+	}
+	p0, p1 := points[i-1], points[i]
+	return p0[1] + (v-p0[0])*(p1[1]-p0[1])/(p1[0]-p0[0])
+}
+
+func sameCalibrations(a, b []config.Calibration) bool {
+	return slices.EqualFunc(a, b, func(x, y config.Calibration) bool {
+		return x.Key == y.Key && x.Gain == y.Gain && x.Offset == y.Offset && x.Date == y.Date && x.Operator == y.Operator &&
+			slices.EqualFunc(x.Points, y.Points, slices.Equal[[]float64])
+	})
+}
+
+// Reload 热加载修改了 calibration_file 后从新的文件读取命令设置的校准
+func Reload() {
+	mu.Lock()
+	defer mu.Unlock()
+	if remote != nil && config.Get().Modbus.CalibrationFile == remotePath {
+		return
+	}
+	remote = nil
+	load()
+}
+
+// Set 保存命令设置的校准，c 需要先通过 Validate 检查。保存到文件失败时不生效
+func Set(device string, c config.Calibration) error {
+	mu.Lock()
+	defer mu.Unlock()
+	load()
+	next := withDevice(device)
+	next[device][c.Key] = c
+	if err := save(next); err != nil {
+		return err
+	}
+	remote = next
+	delete(tables, device)
+	log.WithField("device", device).Infof("设置 %s 的校准: gain %v offset %v points %v，日期 %s 操作人员 %s",
+		c.Key, c.Gain, c.Offset, c.Points, c.Date, c.Operator)
+	return nil
+}
+
+// Clear 删除命令设置的校准，恢复使用配置文件中的校准；key 为空时删除设备的全部字段。保存到文件失败时不生效
+func Clear(device, key string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	load()
+	if _, ok := remote[device][key]; !ok && (key != "" || len(remote[device]) == 0) {
+		if key == "" {
+			return errors.New("没有远程设置的校准")
+		}
+		return fmt.Errorf("%s 没有远程设置的校准", key)
+	}
+	next := withDevice(device)
+	if key == "" {
+		delete(next, device)
+	} else {
+		delete(next[device], key)
+		if len(next[device]) == 0 {
+			delete(next, device)
+		}
+	}
+	if err := save(next); err != nil {
+		return err
+	}
+	remote = next
+	delete(tables, device)
+	log.WithField("device", device).Infof("清除 %s 的远程校准", key)
+	return nil
+}
+
+// withDevice 复制 remote 用于修改 device 的校准，其他设备的校准不会被修改，与 remote 共用
+func withDevice(device string) map[string]map[string]config.Calibration {
+	next := maps.Clone(remote)
+	next[device] = maps.Clone(remote[device])
+	if next[device] == nil {
+		next[device] = make(map[string]config.Calibration)
+	}
+	return next
+}
+
+func load() {
+	if remote != nil {
+		return
+	}
+	remote = make(map[string]map[string]config.Calibration)
+	tables = make(map[string]*cachedTable)
+	path := config.Get().Modbus.CalibrationFile
+	remotePath = path
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &remote)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Errorf("读取 %s 失败，远程设置的校准不生效: %v", path, err)
+	}
+	if remote == nil {
+		remote = make(map[string]map[string]config.Calibration)
+	}
+}
+
+func save(cals map[string]map[string]config.Calibration) error {
+	path := remotePath
+	data, err := json.MarshalIndent(cals, "", "  ")
+	if err == nil {
+		err = fileutil.AtomicWrite(path, data)
+	}
+	if err != nil {
+		log.Errorf("保存 %s 失败: %v", path, err)
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package calibration
+
+import (
+	"dataCollect/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  config.Calibration
+		in   float64
+		want float64
+	}{
+		{"gain offset", config.Calibration{Gain: 1.02, Offset: -0.5}, 20, 19.9},
+		{"single point", config.Calibration{Gain: 1, Points: [][]float64{{10, 10.4}}}, 25, 25.4},
+		// 两点之间线性插值
+		{"interpolate", config.Calibration{Gain: 1, Points: [][]float64{{0, 0}, {10, 12}, {20, 22}}}, 5, 6},
+		{"interpolate upper", config.Calibration{Gain: 1, Points: [][]float64{{0, 0}, {10, 12}, {20, 22}}}, 15, 17},
+		{"on point", config.Calibration{Gain: 1, Points: [][]float64{{0, 0}, {10, 12}, {20, 22}}}, 10, 12},
+		// 超出范围时按两端的线段外推
+		{"extrapolate below", config.Calibration{Gain: 1, Points: [][]float64{{0, 0}, {10, 12}, {20, 22}}}, -5, -6},
+		{"extrapolate above", config.Calibration{Gain: 1, Points: [][]float64{{0, 0}, {10, 12}, {20, 22}}}, 30, 32},
+		// 点的顺序不影响结果
+		{"unsorted", config.Calibration{Gain: 1, Points: [][]float64{{20, 22}, {0, 0}, {10, 12}}}, 15, 17},
+	}
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: filepath.Join(t.TempDir(), "calibration.json")}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote = nil
+			tt.cal.Key = "temperature"
+			values := map[string]interface{}{"temperature": tt.in, "humidity": tt.in, "status": "ok"}
+			Apply("1", []config.Calibration{tt.cal}, values)
+			if values["temperature"] != tt.want {
+				t.Errorf("temperature = %v, want %v", values["temperature"], tt.want)
+			}
+			if values["humidity"] != tt.in || values["status"] != "ok" {
+				t.Errorf("未校准的字段被修改: %v", values)
+			}
+		})
+	}
+}
+
+func TestRemote(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calibration.json")
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: path}})
+	remote = nil
+	conf := []config.Calibration{{Key: "temperature", Gain: 1, Offset: 1}, {Key: "humidity", Gain: 1, Offset: 2}}
+
+	// 命令设置的校准优先于配置文件中的
+	if err := Set("1", config.Calibration{Key: "temperature", Gain: 1, Offset: -1}); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{"temperature": 20.0, "humidity": 50.0}
+	Apply("1", conf, values)
+	if values["temperature"] != 19.0 || values["humidity"] != 52.0 {
+		t.Errorf("values = %v", values)
+	}
+	table := Table("1", conf)
+	if table["temperature"].Source != SourceRemote || table["humidity"].Source != SourceConfig {
+		t.Errorf("table = %v", table)
+	}
+
+	// 重新读取文件后仍然生效
+	remote = nil
+	if e := Table("1", conf)["temperature"]; e.Source != SourceRemote || e.Offset != -1 {
+		t.Errorf("从文件读取 %v", e)
+	}
+	// 其他设备不受影响
+	if e := Table("2", conf)["temperature"]; e.Source != SourceConfig {
+		t.Errorf("设备 2 %v", e)
+	}
+
+	if err := Clear("1", "temperature"); err != nil {
+		t.Fatal(err)
+	}
+	if e := Table("1", conf)["temperature"]; e.Source != SourceConfig {
+		t.Errorf("清除后 %v", e)
+	}
+	if err := Clear("1", ""); err == nil {
+		t.Error("没有远程校准时 Clear 应当返回错误")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: a}})
+	remote = nil
+	if err := Set("1", config.Calibration{Key: "temperature", Gain: 1, Offset: -1}); err != nil {
+		t.Fatal(err)
+	}
+	conf := []config.Calibration{{Key: "temperature", Gain: 1, Offset: 1}}
+	table := Table("1", conf)
+	// 配置和命令设置的校准都没有变化时使用生成好的表
+	if again := Table("1", slices.Clone(conf)); reflect.ValueOf(again).Pointer() != reflect.ValueOf(table).Pointer() {
+		t.Error("校准没有变化时重新生成了校准表")
+	}
+	if again := Table("1", []config.Calibration{{Key: "humidity", Gain: 1}}); again["humidity"].Source != SourceConfig {
+		t.Errorf("配置变化后 %v", again)
+	}
+
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: b}})
+	Reload()
+	if e := Table("1", conf)["temperature"]; e.Source != SourceConfig {
+		t.Errorf("切换到 %s 后 %v", b, e)
+	}
+	// 之后的设置保存到新的文件
+	if err := Set("1", config.Calibration{Key: "temperature", Gain: 1, Offset: -2}); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: a}})
+	Reload()
+	if e := Table("1", conf)["temperature"]; e.Source != SourceRemote || e.Offset != -1 {
+		t.Errorf("切换回 %s 后 %v", a, e)
+	}
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: b}})
+	Reload()
+	if e := Table("1", conf)["temperature"]; e.Source != SourceRemote || e.Offset != -2 {
+		t.Errorf("切换回 %s 后 %v", b, e)
+	}
+}
+
+// 保存到文件失败时设置和清除都不生效
+func TestSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calibration.json")
+	config.Set(&config.Config{Modbus: config.Modbus{CalibrationFile: path}})
+	remote = nil
+	if err := Set("1", config.Calibration{Key: "temperature", Gain: 1, Offset: -1}); err != nil {
+		t.Fatal(err)
+	}
+	conf := []config.Calibration{{Key: "temperature", Gain: 1, Offset: 1}}
+	Table("1", conf)
+
+	// 目录被替换为普通文件，无法写入
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+	if err := Set("1", config.Calibration{Key: "temperature", Gain: 1, Offset: -2}); err == nil {
+		t.Fatal("保存失败时 Set 应当返回错误")
+	}
+	if err := Set("2", config.Calibration{Key: "humidity", Gain: 1, Offset: 3}); err == nil {
+		t.Fatal("保存失败时 Set 应当返回错误")
+	}
+	if e := Table("1", conf)["temperature"]; e.Source != SourceRemote || e.Offset != -1 {
+		t.Errorf("Set 保存失败后 %v", e)
+	}
+	if _, ok := remote["2"]; ok {
+		t.Errorf("Set 保存失败后 remote %v", remote)
+	}
+	if err := Clear("1", ""); err == nil {
+		t.Fatal("保存失败时 Clear 应当返回错误")
+	}
+	if e := Table("1", conf)["temperature"]; e.Source != SourceRemote || e.Offset != -1 {
+		t.Errorf("Clear 保存失败后 %v", e)
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Alarms 每次采集后按规则检查，告警产生和解除时上报 MQTT 并写入 redis，云端断开时本地脚本仍能收到
+type Alarms struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 当前的告警写入 redis_hash(默认 alarms)，产生和解除事件发布到 redis_channel(默认 alarm_events)
+	RedisHash    string      `mapstructure:"redis_hash"`
+	RedisChannel string      `mapstructure:"redis_channel"`
+	Rules        []AlarmRule `mapstructure:"rules"`
+}
+
+// AlarmRule 一条告警规则，match 为 all 时所有条件满足才告警，any 时任一条件满足即告警
+type AlarmRule struct {
+	Name       string           `mapstructure:"name"`
+	Severity   string           `mapstructure:"severity"` // info warning(默认) critical
+	Message    string           `mapstructure:"message"`  // 告警说明，不填时按条件生成
+	Match      string           `mapstructure:"match"`    // all(默认) any
+	Conditions []AlarmCondition `mapstructure:"conditions"`
+	// 告警解除后 cooldown 内不再产生同一告警，避免反复告警
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// 网关模式下适用的子设备编号，为空时适用所有设备
+	Devices []string `mapstructure:"devices"`
+}
+
+// AlarmCondition 告警条件：field 的值与 value 按 op 比较，数值使用寄存器的原始单位
+type AlarmCondition struct {
+	Field string  `mapstructure:"field"`
+	Op    string  `mapstructure:"op"` // > >= < <=
+	Value float64 `mapstructure:"value"`
+	// 条件持续满足 for 时长后才告警
+	For time.Duration `mapstructure:"for"`
+	// 不为 0 时比较 window 内的变化量：agg 为 delta(默认) 时为当前值减去窗口内最早的值，
+	// increase 时为窗口内各次增加量之和，适用于会清零的累计值如雨量
+	Window time.Duration `mapstructure:"window"`
+	Agg    string        `mapstructure:"agg"`
+	// 告警后回到阈值另一侧超过 hysteresis 才解除
+	Hysteresis float64 `mapstructure:"hysteresis"`
+}
+
+func (a *Alarms) applyDefaults() {
+	if a.RedisHash == "" {
+		a.RedisHash = "alarms"
+	}
+	if a.RedisChannel == "" {
+		a.RedisChannel = "alarm_events"
+	}
+	for i := range a.Rules {
+		r := &a.Rules[i]
+		if r.Severity == "" {
+			r.Severity = "warning"
+		}
+		if r.Match == "" {
+			r.Match = "all"
+		}
+		for j := range r.Conditions {
+			if r.Conditions[j].Agg == "" {
+				r.Conditions[j].Agg = "delta"
+			}
+		}
+	}
+}
+
+func (a *Alarms) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	names := make(map[string]bool)
+	for i, r := range a.Rules {
+		key := fmt.Sprintf("alarms.rules[%d]", i)
+		if r.Name == "" {
+			add(key+".name", "不能为空")
+		} else if names[r.Name] {
+			add(key+".name", "%s 重复", r.Name)
+		}
+		names[r.Name] = true
+		if !slices.Contains([]string{"info", "warning", "critical"}, r.Severity) {
+			add(key+".severity", "只能是 info warning critical，当前为 %q", r.Severity)
+		}
+		if r.Match != "all" && r.Match != "any" {
+			add(key+".match", "只能是 all 或 any，当前为 %q", r.Match)
+		}
+		if len(r.Conditions) == 0 {
+			add(key+".conditions", "不能为空")
+		}
+		if r.Cooldown < 0 {
+			add(key+".cooldown", "不能小于 0")
+		}
+		for j, c := range r.Conditions {
+			ckey := fmt.Sprintf("%s.conditions[%d]", key, j)
+			if c.Field == "" {
+				add(ckey+".field", "不能为空")
+			}
+			if !slices.Contains([]string{">", ">=", "<", "<="}, c.Op) {
+				add(ckey+".op", "只能是 > >= < <=，当前为 %q", c.Op)
+			}
+			if c.Agg != "delta" && c.Agg != "increase" {
+				add(ckey+".agg", "只能是 delta 或 increase，当前为 %q", c.Agg)
+			}
+			if c.For < 0 || c.Window < 0 || c.Hysteresis < 0 {
+				add(ckey, "for、window、hysteresis 不能小于 0")
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Attributes 设备属性上报配置，对应 conf.yml 中的 attributes
+type Attributes struct {
+	Interval time.Duration `mapstructure:"interval"` // 检查属性是否变化的周期，默认 1m
+	Items    []Attribute   `mapstructure:"items"`
+	// 订阅 redis 通知，属性对应的 key 变化后立即检查：keyspace 订阅 items 中 redis key 的 keyspace 通知，
+	// pubsub 订阅 channels 中的频道，为空时只按 interval 检查
+	Watch    string   `mapstructure:"watch"`
+	Channels []string `mapstructure:"channels"`
+	// 不为空时订阅前执行 CONFIG SET notify-keyspace-events，redis 默认不发送 keyspace 通知
+	NotifyEvents string `mapstructure:"notify_events"`
+	// 属性变化后才上报，两次上报至少间隔 min_interval(默认 5s)，每隔 full_refresh(默认 10m)无论是否变化都上报一次
+	MinInterval time.Duration `mapstructure:"min_interval"`
+	FullRefresh time.Duration `mapstructure:"full_refresh"`
+}
+
+// Attribute 一个属性的来源，读取到的值经过 transform 转换后以 name 为字段名上报
+type Attribute struct {
+	Name   string `mapstructure:"name"`   // 上报 json 中的字段名
+	Source string `mapstructure:"source"` // redis_hash redis_string file env command static
+	// redis_hash/redis_string 为 redis key，file 为文件路径，env 为环境变量名，command 为 shell 命令，static 为属性值
+	Key       string        `mapstructure:"key"`
+	Field     string        `mapstructure:"field"`     // redis_hash 的字段名
+	Transform string        `mapstructure:"transform"` // 可选 upper lower int float bool json regex:<表达式>
+	Timeout   time.Duration `mapstructure:"timeout"`   // command 的执行超时，默认 5s
+}
+
+// AttributeSources 支持的属性来源
+var AttributeSources = []string{"redis_hash", "redis_string", "file", "env", "command", "static"}
+
+// 未配置 attributes.items 时使用的默认属性，和路由器上 GPS、4G 插件写入 redis 的数据对应
+var defaultAttributes = []Attribute{
+	{Name: "latitude", Source: "redis_hash", Key: "gps_data", Field: "latitude"},
+	{Name: "longitude", Source: "redis_hash", Key: "gps_data", Field: "longitude"},
+	{Name: "signal", Source: "redis_hash", Key: "modem_data", Field: "signal"},
+	{Name: "modelVersion", Source: "redis_hash", Key: "modem_data", Field: "modelVersion"},
+	{Name: "network", Source: "redis_hash", Key: "modem_data", Field: "network"},
+}
+
+func (a *Attributes) applyDefaults() {
+	if a.Interval == 0 {
+		a.Interval = time.Minute
+	}
+	if a.MinInterval == 0 {
+		a.MinInterval = 5 * time.Second
+	}
+	if a.FullRefresh == 0 {
+		a.FullRefresh = 10 * time.Minute
+	}
+	if a.Items == nil {
+		a.Items = append([]Attribute(nil), defaultAttributes...)
+	}
+	for i := range a.Items {
+		if a.Items[i].Source == "command" && a.Items[i].Timeout == 0 {
+			a.Items[i].Timeout = 5 * time.Second
+		}
+	}
+}
+
+func (a *Attributes) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if a.Interval <= 0 {
+		add("attributes.interval", "必须大于 0")
+	}
+	if a.MinInterval < 0 {
+		add("attributes.min_interval", "不能小于 0")
+	}
+	if a.FullRefresh <= 0 {
+		add("attributes.full_refresh", "必须大于 0")
+	}
+	switch a.Watch {
+	case "", "keyspace":
+	case "pubsub":
+		if len(a.Channels) == 0 {
+			add("attributes.channels", "watch 为 pubsub 时不能为空")
+		}
+	default:
+		add("attributes.watch", "只能是 keyspace 或 pubsub，当前为 %q", a.Watch)
+	}
+	names := make(map[string]bool)
+	for i, item := range a.Items {
+		key := fmt.Sprintf("attributes.items[%d]", i)
+		if item.Name == "" {
+			add(key, "缺少 name")
+		} else if names[item.Name] {
+			add(key, "name %q 重复", item.Name)
+		}
+		names[item.Name] = true
+		switch item.Source {
+		case "static":
+		case "redis_hash":
+			if item.Key == "" || item.Field == "" {
+				add(key, "redis_hash 需要 key 和 field")
+			}
+		case "redis_string", "file", "env", "command":
+			if item.Key == "" {
+				add(key, "%s 需要 key", item.Source)
+			}
+		default:
+			add(key, "不支持的来源 %q，可选 %v", item.Source, AttributeSources)
+		}
+		if err := CheckTransform(item.Transform); err != nil {
+			add(key, "%v", err)
+		}
+		if item.Timeout < 0 {
+			add(key, "timeout 不能小于 0")
+		}
+	}
+	return issues
+}
+
+// CheckTransform 检查属性的 transform 是否有效
+func CheckTransform(t string) error {
+	switch t {
+	case "", "upper", "lower", "int", "float", "bool", "json":
+		return nil
+	}
+	if expr, ok := strings.CutPrefix(t, "regex:"); ok {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("transform 正则表达式错误: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("不支持的 transform %q", t)
+}
@@ -0,0 +1,149 @@
+// Package config 定义 conf.yml 的强类型结构，负责加载、补全默认值和校验
+// 各配置段的结构、默认值和校验在同名文件中
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Config 对应 conf.yml 的完整结构，字段上的 mapstructure tag 即配置文件中的 key
+type Config struct {
+	Log    Log    `mapstructure:"log"`
+	Mqtt   Mqtt   `mapstructure:"mqtt"`
+	DB     DB     `mapstructure:"db"`
+	Modbus Modbus `mapstructure:"modbus"`
+	// 设备属性(GPS、4G 信号等)的来源
+	Attributes Attributes `mapstructure:"attributes"`
+	// 把最新的采集数据写回 redis
+	RedisOutput RedisOutput `mapstructure:"redis_output"`
+	// 本地历史数据
+	History History `mapstructure:"history"`
+	// 网关模式，modbus.devices 中的设备作为子设备上报
+	Gateway Gateway `mapstructure:"gateway"`
+	// 参考作物蒸散量
+	ET0 ET0 `mapstructure:"et0"`
+	// 太阳辐射日累计
+	Solar Solar `mapstructure:"solar"`
+	// 边缘告警规则
+	Alarms Alarms `mapstructure:"alarms"`
+	// 收到退出信号后，停止采集、清空发布队列、上报离线等步骤的总超时
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+var current atomic.Pointer[Config]
+
+// Get 返回当前生效的配置，热加载时会被整体替换，调用方不要修改返回值
+func Get() *Config {
+	return current.Load()
+}
+
+func Set(c *Config) {
+	current.Store(c)
+}
+
+// dateToString yaml 中不加引号的日期(如校准日期 2026-10-19)会被解析为时间，写入字符串字段时还原为日期
+func dateToString(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if t, ok := data.(time.Time); ok && to.Kind() == reflect.String {
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format(time.DateOnly), nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+	return data, nil
+}
+
+// Load 把 viper 中的配置解析为 Config，补全默认值并校验。
+// 解析出错的字段会保留零值继续校验，所有问题一次性返回
+func Load(v *viper.Viper) (*Config, []Issue) {
+	var issues []Issue
+	cfg := &Config{}
+	err := v.Unmarshal(cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		dateToString,
+	)))
+	if err != nil {
+		if merr, ok := err.(*mapstructure.Error); ok {
+			for _, e := range merr.Errors {
+				issues = append(issues, Issue{Msg: "类型错误: " + e})
+			}
+		} else {
+			issues = append(issues, Issue{Msg: fmt.Sprintf("解析配置失败: %v", err)})
+		}
+	}
+	settings := v.AllSettings()
+	// mapstructure 遇到类型错误时不再统计未使用的 key，这里按结构定义单独检查
+	for _, key := range unknownKeys("", settings, reflect.TypeOf(*cfg)) {
+		issues = append(issues, Issue{Key: key, Msg: "未知的配置项", Warning: true})
+	}
+	markRegisterFields(settings, cfg)
+	cfg.applyDefaults()
+	issues = append(issues, cfg.Validate()...)
+	return cfg, issues
+}
+
+func (c *Config) applyDefaults() {
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 10 * time.Second
+	}
+	c.Log.applyDefaults()
+	c.Mqtt.applyDefaults()
+	c.DB.applyDefaults()
+	c.Gateway.applyDefaults()
+	c.RedisOutput.applyDefaults()
+	c.History.applyDefaults()
+	c.ET0.applyDefaults()
+	c.Solar.applyDefaults()
+	c.Alarms.applyDefaults()
+	c.Attributes.applyDefaults()
+	c.Modbus.applyDefaults()
+}
+
+// unknownKeys 对照结构体的 mapstructure tag 找出配置中多余的 key，列表中的结构体也会逐项检查
+func unknownKeys(prefix string, settings map[string]interface{}, t reflect.Type) []string {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+
+	var unknown []string
+	for key, val := range settings {
+		full := key
+		if prefix != "" {
+			full = prefix + "." + key
+		}
+		ft, ok := fields[strings.ToLower(key)]
+		if !ok {
+			unknown = append(unknown, full)
+			continue
+		}
+		switch {
+		case ft.Kind() == reflect.Struct:
+			if sub, ok := val.(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(full, sub, ft)...)
+			}
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			items, _ := val.([]interface{})
+			for i, item := range items {
+				if sub, ok := item.(map[string]interface{}); ok {
+					unknown = append(unknown, unknownKeys(fmt.Sprintf("%s[%d]", full, i), sub, ft.Elem())...)
+				}
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// defaults 返回只有默认值的配置，默认配置不能有错误
+func defaults(t *testing.T) *Config {
+	t.Helper()
+	cfg, issues := load(t, "{}")
+	if HasError(issues) {
+		t.Fatalf("默认配置 %v", errorsOf(issues))
+	}
+	return cfg
+}
+
+// wantError 检查只有一个错误并且包含 want，want 为空时不能有错误
+func wantError(t *testing.T, issues []Issue, want string) {
+	t.Helper()
+	errs := errorsOf(issues)
+	if want == "" && len(errs) > 0 || want != "" && (len(errs) != 1 || !strings.Contains(errs[0], want)) {
+		t.Errorf("errors %v, want %q", errs, want)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	cfg := defaults(t)
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"shutdown_timeout", cfg.ShutdownTimeout, 10 * time.Second},
+		{"log.level", cfg.Log.Level, "info"},
+		{"log.maxlines", cfg.Log.MaxLines, 10000},
+		{"log.maxsize", cfg.Log.MaxSize, 20},
+		{"mqtt.broker", cfg.Mqtt.Broker, "localhost:1883"},
+		{"mqtt.write_workers", cfg.Mqtt.WriteWorkers, 10},
+		{"db.redis.addr", cfg.DB.Redis.Addr, "localhost:6379"},
+		{"history.downsample_step", cfg.History.DownsampleStep, 5 * time.Minute},
+		{"et0.solar_radiation", cfg.ET0.SolarRadiation, "solarRadiation"},
+		{"gateway.name", cfg.Gateway.Name, "气象网关"},
+		{"alarms.redis_hash", cfg.Alarms.RedisHash, "alarms"},
+		{"modbus.baud_rate", cfg.Modbus.BaudRate, 4800},
+		{"modbus.poll_interval", cfg.Modbus.PollInterval, 10 * time.Second},
+		{"modbus.profile", cfg.Modbus.Profile, DefaultProfile},
+		{"modbus.cfg_id", cfg.Modbus.CfgID, profiles[DefaultProfile].CfgID},
+		{"modbus.registers", len(cfg.Modbus.Registers), len(profiles[DefaultProfile].Registers)},
+		{"modbus.autodetect.probe_address", cfg.Modbus.AutoDetect.ProbeAddress, int(profiles[DefaultProfile].Registers[0].Address)},
+		{"modbus.derived.temperature", cfg.Modbus.Derived.Temperature, "temperature"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestApplyDefaultsRegisters(t *testing.T) {
+	cfg, _ := load(t, `
+modbus:
+  registers:
+    - { name: 温度, key: temperature, address: 0 }
+    - { name: 气压, key: pressure, address: 2, type: float32, function: 4, scale: 0.01, word_order: CDAB }
+  filters:
+    - { key: temperature, type: median }
+  calibration:
+    - { key: temperature, offset: 0.5 }
+`)
+	m := cfg.Modbus
+	// 自定义寄存器表且没有指定型号时使用原来的模板和写命令
+	if m.Profile != "" || m.CfgID != profiles[DefaultProfile].CfgID || m.Commands["reset_rainfall"].Function != 6 {
+		t.Errorf("profile %q cfg_id %q commands %v", m.Profile, m.CfgID, m.Commands)
+	}
+	want := []Register{
+		{Name: "温度", Key: "temperature", Function: 3, Address: 0, Length: 1, Type: "int16", Scale: 1, WordOrder: "ABCD"},
+		{Name: "气压", Key: "pressure", Function: 4, Address: 2, Length: 2, Type: "float32", Scale: 0.01, WordOrder: "CDAB"},
+	}
+	for i, r := range m.Registers {
+		r.set = nil
+		if !reflect.DeepEqual(r, want[i]) {
+			t.Errorf("registers[%d] = %+v, want %+v", i, r, want[i])
+		}
+	}
+	if f := m.Filters[0]; f.Window != 5 || f.Alpha != 0.3 || f.Output != "temperature" {
+		t.Errorf("filter %+v", f)
+	}
+	if c := m.Calibration[0]; c.Gain != 1 || c.Offset != 0.5 {
+		t.Errorf("calibration %+v", c)
+	}
+}
+
+func TestApplyDefaultsDevices(t *testing.T) {
+	cfg, _ := load(t, `
+gateway: { enabled: true, cfg_id: gw }
+modbus:
+  profile: compact_8in1
+  derived: { metrics: [dew_point] }
+  units: { system: imperial }
+  checks:
+    - { key: temperature, min: -40, max: 60 }
+  devices:
+    - slave_id: 2
+    - id: north
+      name: 北侧
+      slave_id: 3
+      profile: weather_6in1
+      units: { speed: km/h }
+      checks: []
+`)
+	m := cfg.Modbus
+	d := m.Devices[0]
+	// 没有指定型号和 registers 时与 modbus 下的相同
+	if d.ID != "2" || d.Name != "设备2" || d.CfgID != m.CfgID || len(d.Registers) != len(m.Registers) {
+		t.Errorf("devices[0] id %q name %q cfg_id %q %d registers", d.ID, d.Name, d.CfgID, len(d.Registers))
+	}
+	if d.Units != m.Units || len(d.Checks) != 1 || len(d.Derived.Metrics) != 1 || d.Derived.Humidity != "humidity" {
+		t.Errorf("devices[0] units %+v checks %v derived %+v", d.Units, d.Checks, d.Derived)
+	}
+	d = m.Devices[1]
+	p := profiles["weather_6in1"]
+	if d.ID != "north" || d.Name != "北侧" || d.CfgID != p.CfgID || len(d.Registers) != len(p.Registers) {
+		t.Errorf("devices[1] id %q name %q cfg_id %q %d registers", d.ID, d.Name, d.CfgID, len(d.Registers))
+	}
+	// 配置为空列表时不继承
+	if d.Units.Speed != "km/h" || d.Units.System != "" || d.Checks == nil || len(d.Checks) != 0 {
+		t.Errorf("devices[1] units %+v checks %v", d.Units, d.Checks)
+	}
+}
+
+func TestLoadIssues(t *testing.T) {
+	_, issues := load(t, `
+log: { level: info, colour: true }
+modbus:
+  slave_id: abc
+  registers:
+    - { name: 温度, key: temperature, adress: 1 }
+`)
+	var warnings []string
+	for _, i := range issues {
+		if i.Warning {
+			warnings = append(warnings, i.Key)
+		}
+	}
+	if strings.Join(warnings, " ") != "log.colour modbus.registers[0].adress" {
+		t.Errorf("warnings %v", warnings)
+	}
+	errs := errorsOf(issues)
+	if len(errs) != 1 || !strings.Contains(errs[0], "类型错误") || !strings.Contains(errs[0], "slave_id") {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	lat := 91.0
+	cond := []AlarmCondition{{Field: "temperature", Op: ">", Agg: "delta"}}
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"default", func(c *Config) {}, ""},
+		{"shutdown_timeout", func(c *Config) { c.ShutdownTimeout = -time.Second }, "shutdown_timeout: 必须大于 0"},
+		{"log.level", func(c *Config) { c.Log.Level = "verbose" }, "log.level: 无效的日志级别"},
+		{"log.format", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"log.modules unknown", func(c *Config) { c.Log.Modules = map[string]string{"http": "debug"} }, "log.modules.http: 未知的模块"},
+		{"log.modules level", func(c *Config) { c.Log.Modules = map[string]string{"mqtt": "loud"} }, "log.modules.mqtt: 无效的日志级别"},
+		{"log.adapter_type", func(c *Config) { c.Log.AdapterType = 3 }, "log.adapter_type"},
+		{"log.maxdays", func(c *Config) { c.Log.MaxDays = -1 }, "log.maxdays"},
+		{"log.maxlines", func(c *Config) { c.Log.MaxLines = -1 }, "log.maxlines"},
+		{"log.maxsize", func(c *Config) { c.Log.MaxSize = -1 }, "log.maxsize"},
+		{"mqtt.broker", func(c *Config) { c.Mqtt.Broker = "localhost" }, "mqtt.broker: 格式错误"},
+		{"mqtt.channel_buffer_size", func(c *Config) { c.Mqtt.ChannelBufferSize = -1 }, "mqtt.channel_buffer_size"},
+		{"mqtt.write_workers", func(c *Config) { c.Mqtt.WriteWorkers = -1 }, "mqtt.write_workers"},
+		{"mqtt.telemetry.qos", func(c *Config) { c.Mqtt.Telemetry.QoS = 3 }, "mqtt.telemetry.qos"},
+		{"db.redis.addr", func(c *Config) { c.DB.Redis.Addr = "redis" }, "db.redis.addr"},
+		{"db.redis.db", func(c *Config) { c.DB.Redis.DB = 16 }, "db.redis.db"},
+		{"db.redis.check_interval", func(c *Config) { c.DB.Redis.CheckInterval = -time.Second }, "db.redis.check_interval"},
+		{"history", func(c *Config) { c.History.MaxSizeMB = -1 }, "history: retention"},
+		{"history.downsample_step", func(c *Config) { c.History.DownsampleStep = 7 * time.Minute }, "history.downsample_step"},
+		{"history.downsample_after", func(c *Config) { c.History.DownsampleAfter = c.History.Retention }, ""},
+		{"gateway.cfg_id", func(c *Config) { c.Gateway.Enabled = true }, "gateway.cfg_id"},
+		{"et0.latitude", func(c *Config) { c.ET0.Enabled = true; c.ET0.Latitude = &lat }, "et0.latitude"},
+		{"et0.wind_height", func(c *Config) { c.ET0.Enabled = true; c.ET0.WindHeight = 0.2 }, "et0.wind_height"},
+		{"solar.unit", func(c *Config) { c.Solar.Enabled = true; c.Solar.Unit = "J" }, "solar.unit"},
+		{"solar.threshold", func(c *Config) { c.Solar.Enabled = true; c.Solar.Threshold = -1 }, "solar.threshold"},
+		{"solar.max_gap", func(c *Config) { c.Solar.Enabled = true; c.Solar.MaxGap = -time.Second }, "solar.max_gap"},
+		{"solar disabled", func(c *Config) { c.Solar.Unit = "J" }, ""},
+		{"redis_output.maxlen", func(c *Config) { c.RedisOutput.MaxLen = -1 }, "redis_output.maxlen"},
+		{"redis_output.units", func(c *Config) { c.RedisOutput.Units.Speed = "furlong/s" }, "redis_output.units.speed"},
+		{"attributes.interval", func(c *Config) { c.Attributes.Interval = 0 }, "attributes.interval"},
+		{"attributes.min_interval", func(c *Config) { c.Attributes.MinInterval = -time.Second }, "attributes.min_interval"},
+		{"attributes.full_refresh", func(c *Config) { c.Attributes.FullRefresh = 0 }, "attributes.full_refresh"},
+		{"attributes.watch", func(c *Config) { c.Attributes.Watch = "poll" }, "attributes.watch"},
+		{"attributes.channels", func(c *Config) { c.Attributes.Watch = "pubsub" }, "attributes.channels"},
+		{"attributes.items name", func(c *Config) { c.Attributes.Items = []Attribute{{Source: "static"}} }, "attributes.items[0]: 缺少 name"},
+		{"attributes.items duplicate", func(c *Config) {
+			c.Attributes.Items = []Attribute{{Name: "gps", Source: "static"}, {Name: "gps", Source: "static"}}
+		}, "attributes.items[1]: name \"gps\" 重复"},
+		{"attributes.items redis_hash", func(c *Config) {
+			c.Attributes.Items = []Attribute{{Name: "gps", Source: "redis_hash", Key: "gps_data"}}
+		}, "redis_hash 需要 key 和 field"},
+		{"attributes.items key", func(c *Config) { c.Attributes.Items = []Attribute{{Name: "imei", Source: "command"}} }, "command 需要 key"},
+		{"attributes.items source", func(c *Config) { c.Attributes.Items = []Attribute{{Name: "imei", Source: "http"}} }, "不支持的来源"},
+		{"attributes.items transform", func(c *Config) {
+			c.Attributes.Items = []Attribute{{Name: "imei", Source: "env", Key: "IMEI", Transform: "regex:("}}
+		}, "transform 正则表达式错误"},
+		{"attributes.items timeout", func(c *Config) {
+			c.Attributes.Items = []Attribute{{Name: "imei", Source: "env", Key: "IMEI", Timeout: -time.Second}}
+		}, "timeout 不能小于 0"},
+		{"alarms.rules name", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Severity: "warning", Match: "all", Conditions: cond}}
+		}, "alarms.rules[0].name"},
+		{"alarms.rules duplicate", func(c *Config) {
+			r := AlarmRule{Name: "高温", Severity: "warning", Match: "all", Conditions: cond}
+			c.Alarms.Rules = []AlarmRule{r, r}
+		}, "alarms.rules[1].name: 高温 重复"},
+		{"alarms.rules severity", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "fatal", Match: "all", Conditions: cond}}
+		}, "alarms.rules[0].severity"},
+		{"alarms.rules match", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "one", Conditions: cond}}
+		}, "alarms.rules[0].match"},
+		{"alarms.rules conditions", func(c *Config) { c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "all"}} }, "alarms.rules[0].conditions"},
+		{"alarms.rules cooldown", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "all", Cooldown: -time.Second, Conditions: cond}}
+		}, "alarms.rules[0].cooldown"},
+		{"alarms.rules op", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "all", Conditions: []AlarmCondition{{Field: "temperature", Op: "==", Agg: "delta"}}}}
+		}, "alarms.rules[0].conditions[0].op"},
+		{"alarms.rules agg", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "all", Conditions: []AlarmCondition{{Field: "temperature", Op: ">", Agg: "sum"}}}}
+		}, "alarms.rules[0].conditions[0].agg"},
+		{"alarms.rules for", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "all", Conditions: []AlarmCondition{{Field: "temperature", Op: ">", Agg: "delta", For: -time.Second}}}}
+		}, "alarms.rules[0].conditions[0]: for、window、hysteresis 不能小于 0"},
+		{"alarms.rules devices", func(c *Config) {
+			c.Alarms.Rules = []AlarmRule{{Name: "高温", Severity: "info", Match: "all", Devices: []string{"2"}, Conditions: cond}}
+		}, "alarms.rules[0].devices: 只在网关模式"},
+		{"modbus.devices", func(c *Config) {
+			c.Modbus.Devices = []Device{
+				{ID: "1", SlaveID: 1, CfgID: c.Modbus.CfgID, Registers: c.Modbus.Registers},
+				{ID: "2", SlaveID: 2, CfgID: c.Modbus.CfgID, Registers: c.Modbus.Registers},
+			}
+		}, "modbus.devices: 多个设备需要开启网关模式"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults(t)
+			tt.modify(cfg)
+			wantError(t, cfg.Validate(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+type DB struct {
+	Redis Redis `mapstructure:"redis"`
+}
+
+type Redis struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// redis 是可选依赖，按该周期检查连接状态，断开期间依赖 redis 的属性不读取
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+func (d *DB) applyDefaults() {
+	if d.Redis.Addr == "" {
+		d.Redis.Addr = "localhost:6379"
+	}
+	if d.Redis.CheckInterval == 0 {
+		d.Redis.CheckInterval = 10 * time.Second
+	}
+}
+
+func (d *DB) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if _, _, err := net.SplitHostPort(d.Redis.Addr); err != nil {
+		add("db.redis.addr", "格式错误(应为 host:port): %v", err)
+	}
+	if d.Redis.DB < 0 || d.Redis.DB > 15 {
+		add("db.redis.db", "只能是 0-15，当前为 %d", d.Redis.DB)
+	}
+	if d.Redis.CheckInterval <= 0 {
+		add("db.redis.check_interval", "必须大于 0")
+	}
+	return issues
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"dataCollect/internal/units"
+	"fmt"
+)
+
+// ET0 按 FAO-56 Penman-Monteith 方法计算每小时和每天的参考作物蒸散量(mm)
+type ET0 struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 纬度、经度(度，北纬、东经为正)和海拔(m)，不配置时从 redis 的 gps_key(默认 gps_data) 读取 latitude longitude altitude
+	Latitude  *float64 `mapstructure:"latitude"`
+	Longitude *float64 `mapstructure:"longitude"`
+	Altitude  *float64 `mapstructure:"altitude"`
+	GPSKey    string   `mapstructure:"gps_key"`
+	// 风速传感器离地高度(m)，默认 2，按 FAO-56 换算为 2m 高度的风速
+	WindHeight float64 `mapstructure:"wind_height"`
+	// 输入字段，默认 temperature(℃) humidity(%) wind_speed(m/s) solarRadiation(W/m²)
+	Temperature    string `mapstructure:"temperature"`
+	Humidity       string `mapstructure:"humidity"`
+	WindSpeed      string `mapstructure:"wind_speed"`
+	SolarRadiation string `mapstructure:"solar_radiation"`
+	// 未结束的小时和当天的累计值保存位置，重启后继续累计
+	StateFile string `mapstructure:"state_file"`
+}
+
+func (e *ET0) applyDefaults() {
+	if e.GPSKey == "" {
+		e.GPSKey = "gps_data"
+	}
+	if e.WindHeight == 0 {
+		e.WindHeight = 2
+	}
+	if e.Temperature == "" {
+		e.Temperature = "temperature"
+	}
+	if e.Humidity == "" {
+		e.Humidity = "humidity"
+	}
+	if e.WindSpeed == "" {
+		e.WindSpeed = "wind_speed"
+	}
+	if e.SolarRadiation == "" {
+		e.SolarRadiation = "solarRadiation"
+	}
+	if e.StateFile == "" {
+		e.StateFile = "/mnt/data_collect/et0_state.json"
+	}
+}
+
+func (e *ET0) validate() []Issue {
+	if !e.Enabled {
+		return nil
+	}
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if e.Latitude != nil && (*e.Latitude < -90 || *e.Latitude > 90) {
+		add("et0.latitude", "只能是 -90 到 90，当前为 %v", *e.Latitude)
+	}
+	if e.Longitude != nil && (*e.Longitude < -180 || *e.Longitude > 180) {
+		add("et0.longitude", "只能是 -180 到 180，当前为 %v", *e.Longitude)
+	}
+	if e.WindHeight <= 0.5 {
+		add("et0.wind_height", "必须大于 0.5m，当前为 %v", e.WindHeight)
+	}
+	if e.Latitude == nil {
+		issues = append(issues, Issue{Key: "et0.latitude", Msg: fmt.Sprintf("未配置，从 redis %s 读取，GPS 未定位时不计算", e.GPSKey), Warning: true})
+	}
+	return issues
+}
+
+// validateInputs 检查 regs 中输入字段的单位：温度和风速必须能换算为 ℃ 和 m/s，湿度只能是 %，太阳辐射只能是 W/m²
+func (e *ET0) validateInputs(prefix string, regs []Register) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	for _, r := range regs {
+		if r.Unit == "" {
+			continue
+		}
+		switch r.Key {
+		case e.Temperature:
+			if _, err := units.Convert(0, r.Unit, "°C"); err != nil {
+				add("et0.temperature", "%s 中 %s 的单位 %q 不能换算为 °C", prefix, r.Key, r.Unit)
+			}
+		case e.WindSpeed:
+			if _, err := units.Convert(0, r.Unit, "m/s"); err != nil {
+				add("et0.wind_speed", "%s 中 %s 的单位 %q 不能换算为 m/s", prefix, r.Key, r.Unit)
+			}
+		case e.Humidity:
+			if r.Unit != "%" {
+				add("et0.humidity", "%s 中 %s 的单位必须为 %%，当前为 %q", prefix, r.Key, r.Unit)
+			}
+		case e.SolarRadiation:
+			if units.Normalize(r.Unit) != "W/m²" {
+				add("et0.solar_radiation", "%s 中 %s 的单位必须为 W/m²，当前为 %q", prefix, r.Key, r.Unit)
+			}
+		}
+	}
+	return issues
+}
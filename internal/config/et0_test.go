@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestET0ValidateInputs(t *testing.T) {
+	e := ET0{Enabled: true}
+	e.applyDefaults()
+	tests := []struct {
+		name string
+		reg  Register
+		key  string // 期望的错误 key，空为没有错误
+	}{
+		{"fahrenheit", Register{Key: "temperature", Unit: "°F"}, ""},
+		{"km/h", Register{Key: "wind_speed", Unit: "km/h"}, ""},
+		{"radiation alias", Register{Key: "solarRadiation", Unit: "w/m2"}, ""},
+		{"other field", Register{Key: "pressure", Unit: "kPa"}, ""},
+		{"temperature", Register{Key: "temperature", Unit: "kPa"}, "et0.temperature"},
+		{"wind", Register{Key: "wind_speed", Unit: "°"}, "et0.wind_speed"},
+		{"humidity", Register{Key: "humidity", Unit: "g/m³"}, "et0.humidity"},
+		{"radiation", Register{Key: "solarRadiation", Unit: "lux"}, "et0.solar_radiation"},
+	}
+	for _, tt := range tests {
+		issues := e.validateInputs("modbus.registers", []Register{tt.reg})
+		if tt.key == "" && len(issues) > 0 || tt.key != "" && (len(issues) != 1 || issues[0].Key != tt.key) {
+			t.Errorf("%s: issues %v, want %q", tt.name, issues, tt.key)
+		}
+	}
+
+	// 每个设备分别检查
+	c := &Config{ET0: e, Modbus: Modbus{Devices: []Device{
+		{Registers: []Register{{Key: "temperature", Unit: "°C"}}},
+		{Registers: []Register{{Key: "temperature", Unit: "hPa"}}},
+	}}}
+	var found bool
+	for _, i := range c.Validate() {
+		if i.Key == "et0.temperature" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("设备 1 的温度单位没有报错")
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import "fmt"
+
+// Gateway 网关模式：路由器作为网关注册，总线上的设备作为子设备，
+// 遥测、属性和状态都合并为一条网关消息上报，修改后需要重启
+type Gateway struct {
+	Enabled bool   `mapstructure:"enabled"`
+	CfgID   string `mapstructure:"cfg_id"` // 网关的模板 ID，开启网关模式时必填
+	Name    string `mapstructure:"name"`   // 默认 气象网关
+}
+
+func (g *Gateway) applyDefaults() {
+	if g.Name == "" {
+		g.Name = "气象网关"
+	}
+}
+
+func (g *Gateway) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if g.Enabled && g.CfgID == "" {
+		add("gateway.cfg_id", "开启网关模式时不能为空")
+	}
+	return issues
+}
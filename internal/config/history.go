@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// History 本地历史数据存储，云端断开期间的数据可以通过 query_history 命令补传
+type History struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"` // 数据目录，默认 /mnt/data_collect/history
+	// 超过 retention(默认 720h) 的数据删除，目录超过 max_size_mb(默认 50) 时从最早的数据开始删除
+	Retention time.Duration `mapstructure:"retention"`
+	MaxSizeMB int64         `mapstructure:"max_size_mb"`
+	// 超过 downsample_after(默认 168h) 的原始数据按 downsample_step(默认 5m) 聚合，只保留每段的统计值
+	DownsampleAfter time.Duration `mapstructure:"downsample_after"`
+	DownsampleStep  time.Duration `mapstructure:"downsample_step"`
+}
+
+func (h *History) applyDefaults() {
+	if h.Path == "" {
+		h.Path = "/mnt/data_collect/history"
+	}
+	if h.Retention == 0 {
+		h.Retention = 30 * 24 * time.Hour
+	}
+	if h.MaxSizeMB == 0 {
+		h.MaxSizeMB = 50
+	}
+	if h.DownsampleAfter == 0 {
+		h.DownsampleAfter = 7 * 24 * time.Hour
+	}
+	if h.DownsampleStep == 0 {
+		h.DownsampleStep = 5 * time.Minute
+	}
+}
+
+func (h *History) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if h.Retention <= 0 || h.MaxSizeMB <= 0 || h.DownsampleAfter <= 0 || h.DownsampleStep <= 0 {
+		add("history", "retention、max_size_mb、downsample_after、downsample_step 必须大于 0")
+	} else {
+		if h.DownsampleAfter >= h.Retention {
+			issues = append(issues, Issue{Key: "history.downsample_after", Msg: "不小于 retention，数据不会被聚合", Warning: true})
+		}
+		if time.Hour%h.DownsampleStep != 0 && h.DownsampleStep%time.Hour != 0 {
+			add("history.downsample_step", "必须能整除 1 小时或是 1 小时的整数倍，当前为 %v", h.DownsampleStep)
+		}
+	}
+	return issues
+}
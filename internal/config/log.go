@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+type Log struct {
+	AdapterType int    `mapstructure:"adapter_type"` // 0-控制台输出 1-文件输出 2-文件和控制台输出
+	MaxDays     int    `mapstructure:"maxdays"`      // 文件最多保存多少天，默认 3
+	Level       string `mapstructure:"level"`        // panic fatal error warn info debug trace
+	MaxLines    int    `mapstructure:"maxlines"`     // 每个文件保存的最大行数，默认 10000
+	MaxSize     int    `mapstructure:"maxsize"`      // 每个文件的最大大小(MB)，默认 20
+	Path        string `mapstructure:"path"`         // 日志目录，默认 /mnt/data_collect/logs
+	Format      string `mapstructure:"format"`       // text 或 json
+	// 按模块单独设置日志级别，未设置的模块使用 level
+	Modules map[string]string `mapstructure:"modules"`
+}
+
+// LogModules 支持单独设置日志级别的模块
+var LogModules = []string{"modbus", "mqtt", "redis", "cron"}
+
+var logLevels = map[string]bool{
+	"panic": true, "fatal": true, "error": true, "warn": true,
+	"info": true, "debug": true, "trace": true,
+}
+
+func (l *Log) applyDefaults() {
+	if l.Level == "" {
+		l.Level = "info"
+	}
+	if l.MaxDays == 0 {
+		l.MaxDays = 3
+	}
+	if l.MaxLines == 0 {
+		l.MaxLines = 10000
+	}
+	if l.MaxSize == 0 {
+		l.MaxSize = 20
+	}
+	if l.Path == "" {
+		l.Path = "/mnt/data_collect/logs"
+	}
+	if l.Format == "" {
+		l.Format = "text"
+	}
+}
+
+func (l *Log) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if !logLevels[l.Level] {
+		add("log.level", "无效的日志级别 %q", l.Level)
+	}
+	if l.Format != "text" && l.Format != "json" {
+		add("log.format", "只能是 text 或 json，当前为 %q", l.Format)
+	}
+	for _, module := range slices.Sorted(maps.Keys(l.Modules)) {
+		level := l.Modules[module]
+		if !slices.Contains(LogModules, module) {
+			add("log.modules."+module, "未知的模块，可选 %v", LogModules)
+		} else if !logLevels[level] {
+			add("log.modules."+module, "无效的日志级别 %q", level)
+		}
+	}
+	if l.AdapterType < 0 || l.AdapterType > 2 {
+		add("log.adapter_type", "只能是 0、1、2，当前为 %d", l.AdapterType)
+	}
+	if l.MaxDays < 0 {
+		add("log.maxdays", "不能小于 0")
+	}
+	if l.MaxLines < 0 {
+		add("log.maxlines", "不能小于 0")
+	}
+	if l.MaxSize < 0 {
+		add("log.maxsize", "不能小于 0")
+	}
+	return issues
+}
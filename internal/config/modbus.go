@@ -0,0 +1,538 @@
+package config
+
+import (
+	"dataCollect/internal/units"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"syscall"
+	"time"
+)
+
+type Modbus struct {
+	Port         string        `mapstructure:"port"`          // 串口设备
+	BaudRate     int           `mapstructure:"baud_rate"`     // 波特率
+	DataBits     int           `mapstructure:"data_bits"`     // 数据位 5-8
+	Parity       string        `mapstructure:"parity"`        // 校验位 N E O
+	StopBits     int           `mapstructure:"stop_bits"`     // 停止位 1 2
+	SlaveID      int           `mapstructure:"slave_id"`      // 从站地址 1-247
+	Timeout      time.Duration `mapstructure:"timeout"`       // 单次读写超时
+	PollInterval time.Duration `mapstructure:"poll_interval"` // 采集周期
+	Registers    []Register    `mapstructure:"registers"`     // 寄存器表
+	AutoDetect   AutoDetect    `mapstructure:"autodetect"`    // 串口参数和从站地址自动探测
+	Reconnect    Reconnect     `mapstructure:"reconnect"`     // 串口断线重连
+	// 采集分组，组内的寄存器按各自的周期采集，不属于任何分组的寄存器按 poll_interval 采集
+	Groups []PollGroup `mapstructure:"groups"`
+	// 设备型号，寄存器表、写命令和模板 ID 来自内置的型号库，registers 和 commands 中的配置覆盖型号中的同名项。
+	// profile 和 registers 都不配置时使用 weather_6in1
+	Profile  string                  `mapstructure:"profile"`
+	CfgID    string                  `mapstructure:"cfg_id"`   // 平台模板 ID，默认使用型号中的模板
+	Commands map[string]WriteCommand `mapstructure:"commands"` // 写命令，如 reset_rainfall
+	Derived  Derived                 `mapstructure:"derived"`  // 由采集数据计算的衍生气象量
+	Units    Units                   `mapstructure:"units"`    // 上报 MQTT 的单位
+	Checks   []Check                 `mapstructure:"checks"`   // 数据合理性检查
+	Filters  []Filter                `mapstructure:"filters"`  // 数字滤波
+	// 校准表，通过 MQTT 命令设置的校准保存在 calibration_file 中，同一字段优先使用命令设置的
+	Calibration     []Calibration `mapstructure:"calibration"`
+	CalibrationFile string        `mapstructure:"calibration_file"`
+	// 同一条总线上的多个设备，不配置时只有一个设备，使用 slave_id 和 registers
+	Devices []Device `mapstructure:"devices"`
+}
+
+// PollGroup 一组按相同周期采集的寄存器，对总线上的所有设备生效
+type PollGroup struct {
+	Name     string        `mapstructure:"name"`
+	Interval time.Duration `mapstructure:"interval"`
+	// 多个分组同时到期时先采集 priority 大的，已经错过一个周期的分组不受优先级限制，避免一直轮不到
+	Priority  int      `mapstructure:"priority"`
+	Registers []string `mapstructure:"registers"` // 寄存器的 key
+}
+
+// Device 总线上的一个设备，网关模式下作为子设备上报
+type Device struct {
+	ID      string `mapstructure:"id"`       // 子设备编号，即网关消息 sub_device_data 中的 key，默认为从站地址
+	Name    string `mapstructure:"name"`     // 设备名称，默认 设备<id>
+	SlaveID int    `mapstructure:"slave_id"` // 从站地址 1-247
+	// 设备型号，用法与 modbus.profile 相同。不指定型号时 cfg_id、registers、commands 未配置的部分与 modbus 下的相同
+	Profile   string                  `mapstructure:"profile"`
+	CfgID     string                  `mapstructure:"cfg_id"`
+	Registers []Register              `mapstructure:"registers"`
+	Commands  map[string]WriteCommand `mapstructure:"commands"`
+	// 衍生气象量，不配置 metrics 时与 modbus.derived 相同
+	Derived Derived `mapstructure:"derived"`
+	// 上报 MQTT 的单位，不配置时与 modbus.units 相同
+	Units Units `mapstructure:"units"`
+	// 数据合理性检查，不配置时与 modbus.checks 相同
+	Checks []Check `mapstructure:"checks"`
+	// 数字滤波，不配置时与 modbus.filters 相同
+	Filters []Filter `mapstructure:"filters"`
+	// 校准表，不配置时与 modbus.calibration 相同
+	Calibration []Calibration `mapstructure:"calibration"`
+}
+
+// Reconnect 连续失败 MaxFailures 次后关闭串口，按 BackoffMin 起翻倍、最大 BackoffMax 的间隔重新打开
+type Reconnect struct {
+	MaxFailures int           `mapstructure:"max_failures"`
+	BackoffMin  time.Duration `mapstructure:"backoff_min"`
+	BackoffMax  time.Duration `mapstructure:"backoff_max"`
+}
+
+// AutoDetect 依次尝试波特率、校验位和从站地址的组合，锁定第一个能正常响应探测寄存器的组合
+type AutoDetect struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	BaudRates     []int         `mapstructure:"baud_rates"`     // 候选波特率
+	Parities      []string      `mapstructure:"parities"`       // 候选校验位
+	SlaveIDs      []int         `mapstructure:"slave_ids"`      // 候选从站地址
+	ProbeFunction int           `mapstructure:"probe_function"` // 探测使用的功能码，默认 3
+	ProbeAddress  int           `mapstructure:"probe_address"`  // 探测的寄存器地址，默认第一个寄存器
+	ProbeTimeout  time.Duration `mapstructure:"probe_timeout"`  // 每个组合的超时
+	Timeout       time.Duration `mapstructure:"timeout"`        // 一次探测的总时长上限，默认 30s
+	RetryAfter    int           `mapstructure:"retry_after"`    // 连续多少个采集周期读不到数据后重新探测
+	StateFile     string        `mapstructure:"state_file"`     // 探测结果保存位置，重启后优先尝试
+}
+
+// Register 寄存器配置，对应 conf.yml 中的 modbus.registers
+type Register struct {
+	Name     string  `mapstructure:"name"`     // 寄存器名称
+	Key      string  `mapstructure:"key"`      // 上报 json 中的字段名
+	Function int     `mapstructure:"function"` // 读功能码 3 保持寄存器(默认) 4 输入寄存器
+	Address  uint16  `mapstructure:"address"`  // 起始地址
+	Length   uint16  `mapstructure:"length"`   // 寄存器数量，不填时按数据类型推算
+	Type     string  `mapstructure:"type"`     // 数据类型 int16 uint16 int32 uint32 float32
+	Scale    float64 `mapstructure:"scale"`    // 缩放系数，原始值乘以该系数得到实际值，默认 1
+	// 32 位数据的字序，ABCD 高字在前(默认)，CDAB 低字在前
+	WordOrder string `mapstructure:"word_order"`
+	// 实际值的单位，如 m/s °C % mm hPa W/m²，按 units 换算后上报，并在属性中上报单位
+	Unit string `mapstructure:"unit"`
+	// 配置文件中填写了的字段，与型号合并时区分没有填写和填写为 0
+	set map[string]bool `mapstructure:"-"`
+}
+
+// TypeLength 各数据类型占用的寄存器数量
+var TypeLength = map[string]uint16{
+	"int16":   1,
+	"uint16":  1,
+	"int32":   2,
+	"uint32":  2,
+	"float32": 2,
+}
+
+var baudRates = map[int]bool{
+	1200: true, 2400: true, 4800: true, 9600: true, 19200: true,
+	38400: true, 57600: true, 115200: true,
+}
+
+func (m *Modbus) applyDefaults() {
+	if m.Port == "" {
+		m.Port = "/dev/ttyS1"
+	}
+	if m.BaudRate == 0 {
+		m.BaudRate = 4800
+	}
+	if m.DataBits == 0 {
+		m.DataBits = 8
+	}
+	if m.Parity == "" {
+		m.Parity = "N"
+	}
+	if m.StopBits == 0 {
+		m.StopBits = 1
+	}
+	if m.SlaveID == 0 {
+		m.SlaveID = 1
+	}
+	if m.Timeout == 0 {
+		m.Timeout = time.Second
+	}
+	if m.PollInterval == 0 {
+		m.PollInterval = 10 * time.Second
+	}
+	if m.Profile == "" && m.Registers == nil {
+		m.Profile = DefaultProfile
+	}
+	if p, ok := LookupProfile(m.Profile); ok {
+		m.Registers, m.Commands, m.CfgID = applyProfile(p, m.Registers, m.Commands, m.CfgID)
+	} else if m.Profile == "" {
+		// 自定义寄存器表且没有指定型号时保持原来的行为：气象监控站模板和雨量清零命令
+		legacy := profiles[DefaultProfile]
+		if m.CfgID == "" {
+			m.CfgID = legacy.CfgID
+		}
+		if m.Commands == nil {
+			m.Commands = maps.Clone(legacy.Commands)
+		}
+	}
+	if m.Reconnect.MaxFailures == 0 {
+		m.Reconnect.MaxFailures = 3
+	}
+	if m.Reconnect.BackoffMin == 0 {
+		m.Reconnect.BackoffMin = time.Second
+	}
+	if m.Reconnect.BackoffMax == 0 {
+		m.Reconnect.BackoffMax = time.Minute
+	}
+	ad := &m.AutoDetect
+	if len(ad.BaudRates) == 0 {
+		ad.BaudRates = []int{4800, 9600, 19200, 2400, 38400, 115200}
+	}
+	if len(ad.Parities) == 0 {
+		ad.Parities = []string{"N", "E", "O"}
+	}
+	if len(ad.SlaveIDs) == 0 {
+		ad.SlaveIDs = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	}
+	if ad.ProbeFunction == 0 {
+		ad.ProbeFunction = 3
+	}
+	if ad.ProbeAddress == 0 && len(m.Registers) > 0 {
+		ad.ProbeAddress = int(m.Registers[0].Address)
+	}
+	if ad.ProbeTimeout == 0 {
+		ad.ProbeTimeout = 300 * time.Millisecond
+	}
+	if ad.Timeout == 0 {
+		ad.Timeout = 30 * time.Second
+	}
+	if ad.RetryAfter == 0 {
+		ad.RetryAfter = 6
+	}
+	if ad.StateFile == "" {
+		ad.StateFile = "/mnt/data_collect/serial_params.json"
+	}
+	applyRegisterDefaults(m.Registers)
+	m.Derived.applyDefaults()
+	applyFilterDefaults(m.Filters)
+	applyCalibrationDefaults(m.Calibration)
+	if m.CalibrationFile == "" {
+		m.CalibrationFile = "/mnt/data_collect/calibration.json"
+	}
+	for i := range m.Devices {
+		d := &m.Devices[i]
+		if d.Derived.Metrics == nil {
+			d.Derived = m.Derived
+		}
+		if d.Units == (Units{}) {
+			d.Units = m.Units
+		}
+		if d.Checks == nil {
+			d.Checks = m.Checks
+		}
+		if d.Filters == nil {
+			d.Filters = m.Filters
+		}
+		if d.Calibration == nil {
+			d.Calibration = m.Calibration
+		}
+		applyCalibrationDefaults(d.Calibration)
+		applyFilterDefaults(d.Filters)
+		d.Derived.applyDefaults()
+		if d.ID == "" {
+			d.ID = fmt.Sprint(d.SlaveID)
+		}
+		if d.Name == "" {
+			d.Name = "设备" + d.ID
+		}
+		if p, ok := LookupProfile(d.Profile); ok {
+			d.Registers, d.Commands, d.CfgID = applyProfile(p, d.Registers, d.Commands, d.CfgID)
+		} else if d.Profile == "" {
+			if d.Registers == nil {
+				d.Registers = append([]Register(nil), m.Registers...)
+			}
+			if d.Commands == nil {
+				d.Commands = m.Commands
+			}
+			if d.CfgID == "" {
+				d.CfgID = m.CfgID
+			}
+		}
+		applyRegisterDefaults(d.Registers)
+	}
+}
+
+func applyRegisterDefaults(regs []Register) {
+	for i := range regs {
+		r := &regs[i]
+		if r.Type == "" {
+			r.Type = "int16"
+		}
+		if r.Function == 0 {
+			r.Function = 3
+		}
+		if r.Length == 0 {
+			r.Length = TypeLength[r.Type]
+		}
+		if r.Scale == 0 {
+			r.Scale = 1
+		}
+		if r.WordOrder == "" {
+			r.WordOrder = "ABCD"
+		}
+	}
+}
+
+func (m *Modbus) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if !baudRates[m.BaudRate] {
+		add("modbus.baud_rate", "不支持的波特率 %d", m.BaudRate)
+	}
+	if m.DataBits < 5 || m.DataBits > 8 {
+		add("modbus.data_bits", "只能是 5-8，当前为 %d", m.DataBits)
+	}
+	if m.Parity != "N" && m.Parity != "E" && m.Parity != "O" {
+		add("modbus.parity", "只能是 N、E、O，当前为 %q", m.Parity)
+	}
+	if m.StopBits != 1 && m.StopBits != 2 {
+		add("modbus.stop_bits", "只能是 1 或 2，当前为 %d", m.StopBits)
+	}
+	if m.SlaveID < 1 || m.SlaveID > 247 {
+		add("modbus.slave_id", "只能是 1-247，当前为 %d", m.SlaveID)
+	}
+	if m.Timeout <= 0 {
+		add("modbus.timeout", "必须大于 0")
+	}
+	if m.PollInterval <= 0 {
+		add("modbus.poll_interval", "必须大于 0")
+	}
+	issues = append(issues, validateRegisters("modbus.registers", m.Registers)...)
+	issues = append(issues, validateProfile("modbus", m.Profile, m.CfgID, m.Commands)...)
+	issues = append(issues, validateDerived("modbus.derived", &m.Derived, m.Registers)...)
+	issues = append(issues, validateUnits("modbus.units", &m.Units)...)
+	issues = append(issues, validateChecks("modbus.checks", m.Checks, m.Registers)...)
+	issues = append(issues, validateFilters("modbus.filters", m.Filters, m.Registers)...)
+	issues = append(issues, validateCalibration("modbus.calibration", m.Calibration, m.Registers)...)
+	issues = append(issues, validateGroups(m)...)
+
+	if m.Reconnect.MaxFailures < 1 {
+		add("modbus.reconnect.max_failures", "必须大于 0")
+	}
+	if m.Reconnect.BackoffMin <= 0 {
+		add("modbus.reconnect.backoff_min", "必须大于 0")
+	}
+	if m.Reconnect.BackoffMax < m.Reconnect.BackoffMin {
+		add("modbus.reconnect.backoff_max", "不能小于 backoff_min")
+	}
+
+	ad := &m.AutoDetect
+	for _, b := range ad.BaudRates {
+		if !baudRates[b] {
+			add("modbus.autodetect.baud_rates", "不支持的波特率 %d", b)
+		}
+	}
+	for _, p := range ad.Parities {
+		if p != "N" && p != "E" && p != "O" {
+			add("modbus.autodetect.parities", "只能是 N、E、O，当前为 %q", p)
+		}
+	}
+	for _, id := range ad.SlaveIDs {
+		if id < 1 || id > 247 {
+			add("modbus.autodetect.slave_ids", "只能是 1-247，当前为 %d", id)
+		}
+	}
+	if ad.ProbeFunction != 3 && ad.ProbeFunction != 4 {
+		add("modbus.autodetect.probe_function", "只能是 3 或 4，当前为 %d", ad.ProbeFunction)
+	}
+	if ad.ProbeAddress < 0 || ad.ProbeAddress > 0xFFFF {
+		add("modbus.autodetect.probe_address", "只能是 0-65535，当前为 %d", ad.ProbeAddress)
+	}
+	if ad.ProbeTimeout <= 0 {
+		add("modbus.autodetect.probe_timeout", "必须大于 0")
+	}
+	if ad.Timeout < ad.ProbeTimeout {
+		add("modbus.autodetect.timeout", "不能小于 probe_timeout")
+	}
+	if ad.RetryAfter < 0 {
+		add("modbus.autodetect.retry_after", "不能小于 0")
+	}
+
+	ids := make(map[string]bool)
+	for i, d := range m.Devices {
+		key := fmt.Sprintf("modbus.devices[%d]", i)
+		if ids[d.ID] {
+			add(key, "id %q 重复", d.ID)
+		}
+		ids[d.ID] = true
+		if d.SlaveID < 1 || d.SlaveID > 247 {
+			add(key+".slave_id", "只能是 1-247，当前为 %d", d.SlaveID)
+		}
+		issues = append(issues, validateRegisters(key+".registers", d.Registers)...)
+		issues = append(issues, validateProfile(key, d.Profile, d.CfgID, d.Commands)...)
+		issues = append(issues, validateDerived(key+".derived", &d.Derived, d.Registers)...)
+		issues = append(issues, validateUnits(key+".units", &d.Units)...)
+		issues = append(issues, validateChecks(key+".checks", d.Checks, d.Registers)...)
+		issues = append(issues, validateFilters(key+".filters", d.Filters, d.Registers)...)
+		issues = append(issues, validateCalibration(key+".calibration", d.Calibration, d.Registers)...)
+	}
+	// 探测只能确定一个从站地址
+	if ad.Enabled && len(m.Devices) > 0 {
+		add("modbus.autodetect.enabled", "配置了 modbus.devices 时不能开启自动探测")
+	}
+	return issues
+}
+
+func validateRegisters(prefix string, regs []Register) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if len(regs) == 0 {
+		add(prefix, "不能为空")
+		return issues
+	}
+
+	keys := make(map[string]bool)
+	for i, r := range regs {
+		key := fmt.Sprintf("%s[%d]", prefix, i)
+		if r.Name == "" || r.Key == "" {
+			add(key, "缺少 name 或 key")
+		}
+		if r.Key != "" && keys[r.Key] {
+			add(key, "key %q 重复", r.Key)
+		}
+		keys[r.Key] = true
+		if r.Function != 3 && r.Function != 4 {
+			add(key, "功能码只能是 3 或 4，当前为 %d", r.Function)
+		}
+		size, ok := TypeLength[r.Type]
+		if !ok {
+			add(key, "不支持的数据类型 %q", r.Type)
+			continue
+		}
+		if r.Length < size {
+			add(key, "长度 %d 不足以存放 %s", r.Length, r.Type)
+		}
+		if r.Length > 125 {
+			add(key, "长度 %d 超过单次读取上限 125", r.Length)
+		}
+		if int(r.Address)+int(r.Length) > 0x10000 {
+			add(key, "地址范围 %d+%d 超出 65535", r.Address, r.Length)
+		}
+		if r.Scale < 0 {
+			add(key, "scale 不能小于 0")
+		}
+		if r.WordOrder != "ABCD" && r.WordOrder != "CDAB" {
+			add(key, "word_order 只能是 ABCD 或 CDAB，当前为 %q", r.WordOrder)
+		}
+		if units.Normalize(r.Unit) == "bft" {
+			add(key, "蒲福风级只能作为输出单位，寄存器的 unit 请使用 m/s 等风速单位")
+		}
+	}
+
+	// 按功能码和地址排序后检查相邻寄存器是否重叠，保持寄存器和输入寄存器是不同的地址空间
+	sorted := make([]int, len(regs))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		ra, rb := regs[sorted[a]], regs[sorted[b]]
+		if ra.Function != rb.Function {
+			return ra.Function < rb.Function
+		}
+		return ra.Address < rb.Address
+	})
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := regs[sorted[i-1]], regs[sorted[i]]
+		if prev.Function == cur.Function && int(prev.Address)+int(prev.Length) > int(cur.Address) {
+			add(fmt.Sprintf("%s[%d]", prefix, sorted[i]), "地址 %d 与寄存器 %s(%d-%d) 重叠",
+				cur.Address, prev.Name, prev.Address, int(prev.Address)+int(prev.Length)-1)
+		}
+	}
+	return issues
+}
+
+// validateProfile 检查型号是否存在、模板 ID 是否确定以及写命令是否有效，prefix 为 modbus 或 modbus.devices[i]
+func validateProfile(prefix, profile, cfgID string, commands map[string]WriteCommand) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if _, ok := LookupProfile(profile); profile != "" && !ok {
+		add(prefix+".profile", "未知的型号 %q，可选 %v", profile, ProfileNames())
+	} else if cfgID == "" {
+		add(prefix+".cfg_id", "型号 %s 没有对应的平台模板，需要填写 cfg_id", profile)
+	}
+	for _, name := range slices.Sorted(maps.Keys(commands)) {
+		c := commands[name]
+		key := prefix + ".commands." + name
+		switch {
+		case c.Function != 5 && c.Function != 6 && c.Function != 16:
+			add(key, "功能码只能是 5、6、16，当前为 %d", c.Function)
+		case len(c.Values) == 0:
+			add(key, "values 不能为空")
+		case c.Function != 16 && len(c.Values) != 1:
+			add(key, "功能码 %d 只能写入一个值", c.Function)
+		case len(c.Values) > 123:
+			add(key, "一次最多写入 123 个寄存器")
+		}
+	}
+	return issues
+}
+
+// validateGroups 检查采集分组，一个寄存器只能属于一个分组，不在任何设备的寄存器表中时给出警告
+func validateGroups(m *Modbus) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	known := make(map[string]bool)
+	for _, r := range m.Registers {
+		known[r.Key] = true
+	}
+	for _, d := range m.Devices {
+		for _, r := range d.Registers {
+			known[r.Key] = true
+		}
+	}
+	names := make(map[string]bool)
+	owner := make(map[string]string)
+	for i, g := range m.Groups {
+		key := fmt.Sprintf("modbus.groups[%d]", i)
+		switch {
+		case g.Name == "":
+			add(key+".name", "不能为空")
+		case g.Name == "default":
+			add(key+".name", "default 为未分组寄存器使用的名称")
+		case names[g.Name]:
+			add(key+".name", "%s 重复", g.Name)
+		}
+		names[g.Name] = true
+		if g.Interval < 100*time.Millisecond {
+			add(key+".interval", "不能小于 100ms，当前为 %v", g.Interval)
+		}
+		if len(g.Registers) == 0 {
+			add(key+".registers", "不能为空")
+		}
+		for _, r := range g.Registers {
+			if o, ok := owner[r]; ok {
+				add(key+".registers", "%s 已经属于分组 %s", r, o)
+				continue
+			}
+			owner[r] = g.Name
+			if !known[r] {
+				issues = append(issues, Issue{Key: key + ".registers", Msg: fmt.Sprintf("%s 不在寄存器表中", r), Warning: true})
+			}
+		}
+	}
+	return issues
+}
+
+// CheckSerial 检查串口设备是否存在并且可以打开
+func CheckSerial(port string) error {
+	info, err := os.Stat(port)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s 不是字符设备", port)
+	}
+	f, err := os.OpenFile(port, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyProfile(t *testing.T) {
+	p := profiles["weather_6in1"]
+	regs := []Register{
+		{Name: "气压", Key: "pressure", Address: 600, Type: "uint16"},
+		{Key: "temperature", Unit: "°F"},
+	}
+	commands := map[string]WriteCommand{
+		"reset_rainfall": {Function: 16, Address: 1, Values: []uint16{1, 2}},
+		"reboot":         {Function: 6, Address: 2, Values: []uint16{1}},
+	}
+	merged, cmds, cfgID := applyProfile(p, regs, commands, "")
+	if cfgID != p.CfgID {
+		t.Errorf("cfg_id %q, want %q", cfgID, p.CfgID)
+	}
+	// 同名的寄存器原位置覆盖，新的 key 追加在后面
+	if len(merged) != len(p.Registers)+1 || merged[len(merged)-1].Key != "pressure" {
+		t.Fatalf("merged %+v", merged)
+	}
+	if r := register(merged, "temperature"); r.Unit != "°F" || r.Address != 505 || r.Name != "温度" {
+		t.Errorf("temperature %+v", r)
+	}
+	if r := register(p.Registers, "temperature"); r.Unit != "°C" {
+		t.Errorf("型号的寄存器表被修改 %+v", r)
+	}
+	if len(cmds) != 2 || cmds["reset_rainfall"].Function != 16 || cmds["reboot"].Function != 6 {
+		t.Errorf("commands %v", cmds)
+	}
+	if p.Commands["reset_rainfall"].Function != 6 {
+		t.Errorf("型号的写命令被修改 %v", p.Commands)
+	}
+
+	if _, _, cfgID := applyProfile(p, nil, nil, "custom"); cfgID != "custom" {
+		t.Errorf("cfg_id %q, want custom", cfgID)
+	}
+}
+
+func TestValidateRegisters(t *testing.T) {
+	reg := func(key string, addr uint16, modify func(r *Register)) Register {
+		r := Register{Name: key, Key: key, Function: 3, Address: addr, Length: 1, Type: "int16", Scale: 1, WordOrder: "ABCD"}
+		if modify != nil {
+			modify(&r)
+		}
+		return r
+	}
+	tests := []struct {
+		name string
+		regs []Register
+		want string
+	}{
+		{"valid", []Register{reg("a", 0, nil), reg("b", 1, nil), reg("c", 0xFFFF, nil)}, ""},
+		{"empty", nil, "regs: 不能为空"},
+		{"name", []Register{reg("a", 0, func(r *Register) { r.Name = "" })}, "regs[0]: 缺少 name 或 key"},
+		{"key", []Register{reg("a", 0, func(r *Register) { r.Key = "" })}, "regs[0]: 缺少 name 或 key"},
+		{"duplicate key", []Register{reg("a", 0, nil), reg("a", 1, nil)}, "regs[1]: key \"a\" 重复"},
+		{"function", []Register{reg("a", 0, func(r *Register) { r.Function = 1 })}, "功能码只能是 3 或 4"},
+		{"type", []Register{reg("a", 0, func(r *Register) { r.Type = "float64" })}, "不支持的数据类型 \"float64\""},
+		{"length", []Register{reg("a", 0, func(r *Register) { r.Type = "float32" })}, "长度 1 不足以存放 float32"},
+		{"max length", []Register{reg("a", 0, func(r *Register) { r.Length = 126 })}, "超过单次读取上限 125"},
+		{"address", []Register{reg("a", 0xFFFF, func(r *Register) { r.Type, r.Length = "int32", 2 })}, "地址范围 65535+2 超出 65535"},
+		{"scale", []Register{reg("a", 0, func(r *Register) { r.Scale = -1 })}, "scale 不能小于 0"},
+		{"word_order", []Register{reg("a", 0, func(r *Register) { r.WordOrder = "BADC" })}, "word_order 只能是 ABCD 或 CDAB"},
+		{"bft", []Register{reg("a", 0, func(r *Register) { r.Unit = "bft" })}, "蒲福风级只能作为输出单位"},
+		{"overlap", []Register{reg("a", 10, func(r *Register) { r.Type, r.Length = "float32", 2 }), reg("b", 11, nil)}, "regs[1]: 地址 11 与寄存器 a(10-11) 重叠"},
+		// 按地址排序后检查，配置顺序不影响
+		{"overlap unordered", []Register{reg("b", 11, nil), reg("a", 10, func(r *Register) { r.Type, r.Length = "float32", 2 })}, "regs[0]: 地址 11 与寄存器 a(10-11) 重叠"},
+		// 保持寄存器和输入寄存器是不同的地址空间
+		{"other function", []Register{reg("a", 10, nil), reg("b", 10, func(r *Register) { r.Function = 4 })}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantError(t, validateRegisters("regs", tt.regs), tt.want)
+		})
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		cfgID    string
+		commands map[string]WriteCommand
+		want     string
+	}{
+		{"valid", "weather_6in1", "id", map[string]WriteCommand{"c": {Function: 16, Values: []uint16{1, 2}}}, ""},
+		{"unknown", "weather_9in1", "id", nil, "modbus.profile: 未知的型号 \"weather_9in1\""},
+		{"cfg_id", "compact_8in1", "", nil, "modbus.cfg_id: 型号 compact_8in1 没有对应的平台模板"},
+		{"function", "", "id", map[string]WriteCommand{"c": {Function: 3, Values: []uint16{1}}}, "modbus.commands.c: 功能码只能是 5、6、16"},
+		{"values", "", "id", map[string]WriteCommand{"c": {Function: 6}}, "modbus.commands.c: values 不能为空"},
+		{"single", "", "id", map[string]WriteCommand{"c": {Function: 5, Values: []uint16{1, 0}}}, "功能码 5 只能写入一个值"},
+		{"max values", "", "id", map[string]WriteCommand{"c": {Function: 16, Values: make([]uint16, 124)}}, "一次最多写入 123 个寄存器"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantError(t, validateProfile("modbus", tt.profile, tt.cfgID, tt.commands), tt.want)
+		})
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	group := func(name string, regs ...string) PollGroup {
+		return PollGroup{Name: name, Interval: time.Second, Registers: regs}
+	}
+	tests := []struct {
+		name   string
+		groups []PollGroup
+		want   string
+	}{
+		{"valid", []PollGroup{group("fast", "wind_speed"), group("slow", "temperature", "humidity")}, ""},
+		{"device register", []PollGroup{group("fast", "pressure")}, ""},
+		{"name", []PollGroup{group("", "wind_speed")}, "modbus.groups[0].name: 不能为空"},
+		{"default", []PollGroup{group("default", "wind_speed")}, "modbus.groups[0].name: default 为未分组寄存器使用的名称"},
+		{"duplicate name", []PollGroup{group("fast", "wind_speed"), group("fast", "humidity")}, "modbus.groups[1].name: fast 重复"},
+		{"interval", []PollGroup{{Name: "fast", Interval: 50 * time.Millisecond, Registers: []string{"wind_speed"}}}, "modbus.groups[0].interval: 不能小于 100ms"},
+		{"registers", []PollGroup{group("fast")}, "modbus.groups[0].registers: 不能为空"},
+		{"two groups", []PollGroup{group("fast", "wind_speed"), group("slow", "wind_speed")}, "modbus.groups[1].registers: wind_speed 已经属于分组 fast"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Modbus{
+				Registers: []Register{{Key: "wind_speed"}, {Key: "temperature"}, {Key: "humidity"}},
+				Devices:   []Device{{Registers: []Register{{Key: "pressure"}}}},
+				Groups:    tt.groups,
+			}
+			wantError(t, validateGroups(&m), tt.want)
+		})
+	}
+
+	// 不在寄存器表中只是警告
+	m := Modbus{Registers: []Register{{Key: "wind_speed"}}, Groups: []PollGroup{group("fast", "visibility")}}
+	if issues := validateGroups(&m); len(issues) != 1 || !issues[0].Warning {
+		t.Errorf("unknown register %v", issues)
+	}
+}
+
+func TestModbusValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *Modbus)
+		want   string
+	}{
+		{"baud_rate", func(m *Modbus) { m.BaudRate = 1000 }, "modbus.baud_rate: 不支持的波特率 1000"},
+		{"data_bits", func(m *Modbus) { m.DataBits = 9 }, "modbus.data_bits"},
+		{"parity", func(m *Modbus) { m.Parity = "M" }, "modbus.parity"},
+		{"stop_bits", func(m *Modbus) { m.StopBits = 3 }, "modbus.stop_bits"},
+		{"slave_id", func(m *Modbus) { m.SlaveID = 248 }, "modbus.slave_id"},
+		{"timeout", func(m *Modbus) { m.Timeout = 0 }, "modbus.timeout"},
+		{"poll_interval", func(m *Modbus) { m.PollInterval = 0 }, "modbus.poll_interval"},
+		{"reconnect.max_failures", func(m *Modbus) { m.Reconnect.MaxFailures = 0 }, "modbus.reconnect.max_failures"},
+		{"reconnect.backoff_max", func(m *Modbus) { m.Reconnect.BackoffMax = time.Millisecond }, "modbus.reconnect.backoff_max"},
+		{"autodetect.baud_rates", func(m *Modbus) { m.AutoDetect.BaudRates = []int{9600, 100} }, "modbus.autodetect.baud_rates: 不支持的波特率 100"},
+		{"autodetect.parities", func(m *Modbus) { m.AutoDetect.Parities = []string{"X"} }, "modbus.autodetect.parities"},
+		{"autodetect.slave_ids", func(m *Modbus) { m.AutoDetect.SlaveIDs = []int{0} }, "modbus.autodetect.slave_ids"},
+		{"autodetect.probe_function", func(m *Modbus) { m.AutoDetect.ProbeFunction = 1 }, "modbus.autodetect.probe_function"},
+		{"autodetect.timeout", func(m *Modbus) { m.AutoDetect.Timeout = time.Millisecond }, "modbus.autodetect.timeout: 不能小于 probe_timeout"},
+		{"autodetect.retry_after", func(m *Modbus) { m.AutoDetect.RetryAfter = -1 }, "modbus.autodetect.retry_after"},
+		{"registers", func(m *Modbus) { m.Registers[1].Address = m.Registers[0].Address }, "modbus.registers[1]: 地址"},
+		{"devices duplicate id", func(m *Modbus) {
+			m.Devices = []Device{{ID: "1", SlaveID: 1, CfgID: "x", Registers: m.Registers}, {ID: "1", SlaveID: 2, CfgID: "x", Registers: m.Registers}}
+		}, "modbus.devices[1]: id \"1\" 重复"},
+		{"devices slave_id", func(m *Modbus) {
+			m.Devices = []Device{{ID: "1", SlaveID: 0, CfgID: "x", Registers: m.Registers}}
+		}, "modbus.devices[0].slave_id"},
+		{"devices registers", func(m *Modbus) {
+			m.Devices = []Device{{ID: "1", SlaveID: 1, CfgID: "x"}}
+		}, "modbus.devices[0].registers: 不能为空"},
+		{"devices profile", func(m *Modbus) {
+			m.Devices = []Device{{ID: "1", SlaveID: 1, Profile: "compact_8in1", Registers: m.Registers}}
+		}, "modbus.devices[0].cfg_id"},
+		{"autodetect devices", func(m *Modbus) {
+			m.AutoDetect.Enabled = true
+			m.Devices = []Device{{ID: "1", SlaveID: 1, CfgID: "x", Registers: m.Registers}}
+		}, "modbus.autodetect.enabled: 配置了 modbus.devices 时不能开启自动探测"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults(t)
+			tt.modify(&cfg.Modbus)
+			wantError(t, cfg.Modbus.validate(), tt.want)
+		})
+	}
+}
+
+func TestCheckSerial(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckSerial(filepath.Join(dir, "ttyS9")); !os.IsNotExist(err) {
+		t.Errorf("不存在的串口 %v", err)
+	}
+	file := filepath.Join(dir, "ttyS1")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSerial(file); err == nil || !strings.Contains(err.Error(), "不是字符设备") {
+		t.Errorf("普通文件 %v", err)
+	}
+	if _, err := os.Stat("/dev/null"); err == nil {
+		if err := CheckSerial("/dev/null"); err != nil {
+			t.Errorf("字符设备 %v", err)
+		}
+	}
+}
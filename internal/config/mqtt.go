@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+type Mqtt struct {
+	Broker            string    `mapstructure:"broker" json:"broker"`
+	User              string    `mapstructure:"user" json:"user"`
+	Pass              string    `mapstructure:"pass" json:"pass"`
+	ChannelBufferSize int       `mapstructure:"channel_buffer_size" json:"channel_buffer_size"`
+	WriteWorkers      int       `mapstructure:"write_workers" json:"write_workers"`
+	Telemetry         Telemetry `mapstructure:"telemetry" json:"telemetry"`
+}
+
+type Telemetry struct {
+	SubscribeTopic string `mapstructure:"subscribe_topic" json:"subscribe_topic"`
+	PublishTopic   string `mapstructure:"publish_topic" json:"publish_topic"`
+	// 网关模式下命令主题的前缀，默认 gateway/command，订阅 <前缀>/{cfgID}/{mac}/{message_id}
+	GatewaySubscribeTopic string `mapstructure:"gateway_subscribe_topic" json:"gateway_subscribe_topic"`
+	// 网关模式下上报主题的前缀，默认 gateway，上报到 <前缀>/telemetry|attributes|status|event/{cfgID}/{mac}
+	GatewayPublishTopic string `mapstructure:"gateway_publish_topic" json:"gateway_publish_topic"`
+	QoS                 int    `mapstructure:"qos" json:"qos"`
+	PoolSize            int    `mapstructure:"pool_size" json:"pool_size"`
+	BatchSize           int    `mapstructure:"batch_size" json:"batch_size"`
+}
+
+func (m *Mqtt) applyDefaults() {
+	if m.Broker == "" {
+		m.Broker = "localhost:1883"
+	}
+	if m.User == "" {
+		m.User = "root"
+	}
+	if m.Pass == "" {
+		m.Pass = "root"
+	}
+	if m.ChannelBufferSize == 0 {
+		m.ChannelBufferSize = 10000
+	}
+	if m.WriteWorkers == 0 {
+		m.WriteWorkers = 10
+	}
+	if m.Telemetry.PoolSize == 0 {
+		m.Telemetry.PoolSize = 100
+	}
+	if m.Telemetry.BatchSize == 0 {
+		m.Telemetry.BatchSize = 100
+	}
+	if m.Telemetry.GatewaySubscribeTopic == "" {
+		m.Telemetry.GatewaySubscribeTopic = "gateway/command"
+	}
+	if m.Telemetry.GatewayPublishTopic == "" {
+		m.Telemetry.GatewayPublishTopic = "gateway"
+	}
+}
+
+func (m *Mqtt) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if _, _, err := net.SplitHostPort(m.Broker); err != nil {
+		add("mqtt.broker", "格式错误(应为 host:port): %v", err)
+	}
+	if m.ChannelBufferSize < 0 {
+		add("mqtt.channel_buffer_size", "不能小于 0")
+	}
+	if m.WriteWorkers < 0 {
+		add("mqtt.write_workers", "不能小于 0")
+	}
+	if q := m.Telemetry.QoS; q < 0 || q > 2 {
+		add("mqtt.telemetry.qos", "只能是 0、1、2，当前为 %d", q)
+	}
+	return issues
+}
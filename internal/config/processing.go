@@ -0,0 +1,332 @@
+package config
+
+import (
+	"dataCollect/internal/units"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Calibration 一个字段的校准，读到的值(寄存器的原始单位)换算为 值×gain+offset，
+// 配置了 points 时改为按 [[读数, 标准值], ...] 分段线性插值，超出范围时按两端的线段外推
+type Calibration struct {
+	Key    string      `mapstructure:"key" json:"key"`
+	Gain   float64     `mapstructure:"gain" json:"gain"` // 默认 1
+	Offset float64     `mapstructure:"offset" json:"offset"`
+	Points [][]float64 `mapstructure:"points" json:"points,omitempty"`
+	// 校准日期和操作人员，作为属性上报
+	Date     string `mapstructure:"date" json:"date,omitempty"`
+	Operator string `mapstructure:"operator" json:"operator,omitempty"`
+}
+
+// applyCalibrationDefaults 没有配置 gain 时为 1
+func applyCalibrationDefaults(cals []Calibration) {
+	for i := range cals {
+		if cals[i].Gain == 0 {
+			cals[i].Gain = 1
+		}
+	}
+}
+
+// Validate 检查校准参数，MQTT 命令设置的校准也使用该检查
+func (c *Calibration) Validate() error {
+	if c.Key == "" {
+		return errors.New("key 不能为空")
+	}
+	if len(c.Points) == 0 {
+		if c.Gain == 0 {
+			return errors.New("gain 不能为 0")
+		}
+		return nil
+	}
+	if c.Gain != 1 || c.Offset != 0 {
+		return errors.New("points 与 gain/offset 不能同时配置")
+	}
+	seen := make(map[float64]bool)
+	for i, p := range c.Points {
+		if len(p) != 2 {
+			return fmt.Errorf("points[%d] 必须为 [读数, 标准值]", i)
+		}
+		if seen[p[0]] {
+			return fmt.Errorf("points 中的读数 %v 重复", p[0])
+		}
+		seen[p[0]] = true
+	}
+	return nil
+}
+
+// validateCalibration 检查校准表，字段不在寄存器表中时给出警告
+func validateCalibration(prefix string, cals []Calibration, regs []Register) []Issue {
+	var issues []Issue
+	seen := make(map[string]bool)
+	for i := range cals {
+		c := &cals[i]
+		key := fmt.Sprintf("%s[%d]", prefix, i)
+		if err := c.Validate(); err != nil {
+			issues = append(issues, Issue{Key: key, Msg: err.Error()})
+			continue
+		}
+		if seen[c.Key] {
+			issues = append(issues, Issue{Key: key + ".key", Msg: fmt.Sprintf("%s 重复", c.Key)})
+		}
+		seen[c.Key] = true
+		if !slices.ContainsFunc(regs, func(r Register) bool { return r.Key == c.Key }) {
+			issues = append(issues, Issue{Key: key + ".key", Msg: fmt.Sprintf("%s 不在寄存器表中", c.Key), Warning: true})
+		}
+	}
+	return issues
+}
+
+// Check 一个字段的合理性检查，不通过时数据质量标记为 suspect 并上报 sensor_fault 事件
+type Check struct {
+	Key string `mapstructure:"key"`
+	// 物理量程，超出时不合理
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+	// 相邻两次采集之间每分钟的最大变化量，0 不检查
+	MaxRate float64 `mapstructure:"max_rate"`
+	// 连续 stuck_count 次或 stuck_duration 时长内数值完全相同时认为传感器卡死，0 不检查
+	StuckCount    int           `mapstructure:"stuck_count"`
+	StuckDuration time.Duration `mapstructure:"stuck_duration"`
+	// 不合理的值不上报、不写入 redis 和历史数据，默认仍然上报
+	Suppress bool `mapstructure:"suppress"`
+}
+
+// validateChecks 检查合理性检查规则，字段不在寄存器表中时给出警告
+func validateChecks(prefix string, checks []Check, regs []Register) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	seen := make(map[string]bool)
+	for i, c := range checks {
+		key := fmt.Sprintf("%s[%d]", prefix, i)
+		if c.Key == "" {
+			add(key+".key", "不能为空")
+			continue
+		}
+		if seen[c.Key] {
+			add(key+".key", "%s 重复", c.Key)
+		}
+		seen[c.Key] = true
+		if !slices.ContainsFunc(regs, func(r Register) bool { return r.Key == c.Key }) {
+			issues = append(issues, Issue{Key: key + ".key", Msg: fmt.Sprintf("%s 不在寄存器表中", c.Key), Warning: true})
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			add(key, "min 不能大于 max")
+		}
+		if c.MaxRate < 0 || c.StuckCount < 0 || c.StuckDuration < 0 {
+			add(key, "max_rate、stuck_count、stuck_duration 不能小于 0")
+		}
+		if c.StuckCount == 1 {
+			add(key+".stuck_count", "至少为 2")
+		}
+	}
+	return issues
+}
+
+// Filter 对一个字段做数字滤波，按配置顺序处理，结果覆盖原字段时同一字段的多个滤波器依次串联
+type Filter struct {
+	Key  string `mapstructure:"key"`
+	Type string `mapstructure:"type"` // median(中位值) average(滑动平均) ema(指数滑动平均) spike(去除尖峰)
+	// median average spike 使用最近 window 次采集的值，默认 5
+	Window int `mapstructure:"window"`
+	// ema 的平滑系数 0-1，越小越平滑，默认 0.3
+	Alpha float64 `mapstructure:"alpha"`
+	// spike: 与之前 window 次采集的中位数相差超过 threshold 时替换为中位数
+	Threshold float64 `mapstructure:"threshold"`
+	// 滤波结果的字段名，默认覆盖 key
+	Output string `mapstructure:"output"`
+	// 不为空时同时以该字段名上报滤波前的值
+	RawKey string `mapstructure:"raw_key"`
+}
+
+func applyFilterDefaults(filters []Filter) {
+	for i := range filters {
+		f := &filters[i]
+		if f.Window == 0 {
+			f.Window = 5
+		}
+		if f.Alpha == 0 {
+			f.Alpha = 0.3
+		}
+		if f.Output == "" {
+			f.Output = f.Key
+		}
+	}
+}
+
+// validateFilters 检查滤波器参数，输出的字段名不能与寄存器重复(覆盖原字段除外)
+func validateFilters(prefix string, filters []Filter, regs []Register) []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	isRegister := func(key string) bool {
+		return slices.ContainsFunc(regs, func(r Register) bool { return r.Key == key })
+	}
+	for i, f := range filters {
+		key := fmt.Sprintf("%s[%d]", prefix, i)
+		if f.Key == "" {
+			add(key+".key", "不能为空")
+			continue
+		}
+		if !isRegister(f.Key) && !slices.ContainsFunc(filters[:i], func(p Filter) bool { return p.Output == f.Key }) {
+			issues = append(issues, Issue{Key: key + ".key", Msg: fmt.Sprintf("%s 不在寄存器表中", f.Key), Warning: true})
+		}
+		switch f.Type {
+		case "median", "average", "ema":
+		case "spike":
+			if f.Threshold <= 0 {
+				add(key+".threshold", "必须大于 0")
+			}
+		default:
+			add(key+".type", "只能是 median average ema spike，当前为 %q", f.Type)
+		}
+		if f.Window < 1 || f.Window > 100 {
+			add(key+".window", "只能是 1-100，当前为 %d", f.Window)
+		}
+		if f.Alpha <= 0 || f.Alpha > 1 {
+			add(key+".alpha", "只能是 0-1，当前为 %v", f.Alpha)
+		}
+		if f.Output != f.Key && isRegister(f.Output) {
+			add(key+".output", "%s 与寄存器的 key 重复", f.Output)
+		}
+		if f.RawKey != "" && (f.RawKey == f.Output || isRegister(f.RawKey)) {
+			add(key+".raw_key", "%s 与其他字段重复", f.RawKey)
+		}
+	}
+	return issues
+}
+
+// Derived 由温度(℃)、相对湿度(%)、风速(m/s)计算的衍生气象量，和采集数据一起上报
+type Derived struct {
+	// 可选 dew_point absolute_humidity vpd heat_index wind_chill apparent_temperature，上报的字段名与之相同
+	Metrics []string `mapstructure:"metrics"`
+	// 输入字段，默认 temperature humidity wind_speed
+	Temperature string `mapstructure:"temperature"`
+	Humidity    string `mapstructure:"humidity"`
+	WindSpeed   string `mapstructure:"wind_speed"`
+}
+
+// DerivedMetrics 支持的衍生气象量
+var DerivedMetrics = []string{"dew_point", "absolute_humidity", "vpd", "heat_index", "wind_chill", "apparent_temperature"}
+
+func (d *Derived) applyDefaults() {
+	if d.Temperature == "" {
+		d.Temperature = "temperature"
+	}
+	if d.Humidity == "" {
+		d.Humidity = "humidity"
+	}
+	if d.WindSpeed == "" {
+		d.WindSpeed = "wind_speed"
+	}
+}
+
+// validateDerived 检查衍生量名称，需要的输入字段不在寄存器表中时给出警告
+func validateDerived(prefix string, d *Derived, regs []Register) []Issue {
+	var issues []Issue
+	keys := make(map[string]bool, len(regs))
+	for _, r := range regs {
+		keys[r.Key] = true
+	}
+	// 温度和风速按寄存器的单位换算，湿度只能是 %
+	for _, r := range regs {
+		if r.Unit == "" || len(d.Metrics) == 0 {
+			continue
+		}
+		switch r.Key {
+		case d.Temperature:
+			if _, err := units.Convert(0, r.Unit, "°C"); err != nil {
+				issues = append(issues, Issue{Key: prefix + ".temperature", Msg: fmt.Sprintf("输入字段 %s 的单位 %q 不能换算为 °C", r.Key, r.Unit)})
+			}
+		case d.Humidity:
+			if r.Unit != "%" {
+				issues = append(issues, Issue{Key: prefix + ".humidity", Msg: fmt.Sprintf("输入字段 %s 的单位必须为 %%，当前为 %q", r.Key, r.Unit)})
+			}
+		case d.WindSpeed:
+			if _, err := units.Convert(0, r.Unit, "m/s"); err != nil {
+				issues = append(issues, Issue{Key: prefix + ".wind_speed", Msg: fmt.Sprintf("输入字段 %s 的单位 %q 不能换算为 m/s", r.Key, r.Unit)})
+			}
+		}
+	}
+	// 各衍生量需要的输入
+	needs := map[string][]string{
+		"dew_point":            {d.Temperature, d.Humidity},
+		"absolute_humidity":    {d.Temperature, d.Humidity},
+		"vpd":                  {d.Temperature, d.Humidity},
+		"heat_index":           {d.Temperature, d.Humidity},
+		"wind_chill":           {d.Temperature, d.WindSpeed},
+		"apparent_temperature": {d.Temperature, d.Humidity, d.WindSpeed},
+	}
+	seen := make(map[string]bool)
+	for _, m := range d.Metrics {
+		if !slices.Contains(DerivedMetrics, m) {
+			issues = append(issues, Issue{Key: prefix + ".metrics", Msg: fmt.Sprintf("不支持的衍生量 %q，可选 %v", m, DerivedMetrics)})
+			continue
+		}
+		if seen[m] {
+			issues = append(issues, Issue{Key: prefix + ".metrics", Msg: fmt.Sprintf("%s 重复", m)})
+		}
+		seen[m] = true
+		if keys[m] {
+			issues = append(issues, Issue{Key: prefix + ".metrics", Msg: fmt.Sprintf("%s 与寄存器的 key 重复", m)})
+		}
+		for _, in := range needs[m] {
+			if !keys[in] {
+				issues = append(issues, Issue{Key: prefix + ".metrics", Msg: fmt.Sprintf("%s 需要的字段 %s 不在寄存器表中", m, in), Warning: true})
+			}
+		}
+	}
+	return issues
+}
+
+// Units 输出单位，寄存器和衍生量按单位所属的物理量换算，没有配置的物理量保持原单位
+type Units struct {
+	System        string `mapstructure:"system"`        // metric(默认，不换算) 或 imperial(mph °F in inHg)
+	Speed         string `mapstructure:"speed"`         // m/s km/h kn mph bft(蒲福风级)
+	Temperature   string `mapstructure:"temperature"`   // °C °F K
+	Precipitation string `mapstructure:"precipitation"` // mm in
+	Pressure      string `mapstructure:"pressure"`      // hPa kPa Pa inHg mmHg
+}
+
+// Targets 返回各物理量的输出单位，单独配置的物理量覆盖 system 中的单位
+func (u *Units) Targets() map[string]string {
+	targets := maps.Clone(units.Presets[u.System])
+	if targets == nil {
+		targets = make(map[string]string)
+	}
+	for q, unit := range map[string]string{
+		units.Speed:         u.Speed,
+		units.Temperature:   u.Temperature,
+		units.Precipitation: u.Precipitation,
+		units.Pressure:      u.Pressure,
+	} {
+		if unit != "" {
+			targets[q] = unit
+		}
+	}
+	return targets
+}
+
+// validateUnits 检查单位制和各物理量的输出单位
+func validateUnits(prefix string, u *Units) []Issue {
+	var issues []Issue
+	if _, ok := units.Presets[u.System]; u.System != "" && !ok {
+		issues = append(issues, Issue{Key: prefix + ".system", Msg: fmt.Sprintf("只能是 metric 或 imperial，当前为 %q", u.System)})
+	}
+	for _, f := range []struct{ key, quantity, unit string }{
+		{"speed", units.Speed, u.Speed},
+		{"temperature", units.Temperature, u.Temperature},
+		{"precipitation", units.Precipitation, u.Precipitation},
+		{"pressure", units.Pressure, u.Pressure},
+	} {
+		if f.unit != "" && !units.Valid(f.quantity, f.unit) {
+			issues = append(issues, Issue{Key: prefix + "." + f.key, Msg: fmt.Sprintf("不支持的单位 %q", f.unit)})
+		}
+	}
+	return issues
+}
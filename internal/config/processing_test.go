@@ -0,0 +1,183 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// errorsOf 返回非 Warning 的问题，格式为 key: msg
+func errorsOf(issues []Issue) []string {
+	var out []string
+	for _, i := range issues {
+		if !i.Warning {
+			out = append(out, i.Key+": "+i.Msg)
+		}
+	}
+	return out
+}
+
+func TestValidateDerived(t *testing.T) {
+	d := Derived{Temperature: "temperature", Humidity: "humidity", WindSpeed: "wind_speed", Metrics: []string{"dew_point", "wind_chill"}}
+	tests := []struct {
+		name string
+		regs []Register
+		want string // 期望的错误中包含的内容，空为没有错误
+	}{
+		{"convertible", []Register{{Key: "temperature", Unit: "°F"}, {Key: "humidity", Unit: "%"}, {Key: "wind_speed", Unit: "km/h"}}, ""},
+		{"no unit", []Register{{Key: "temperature"}, {Key: "humidity"}, {Key: "wind_speed"}}, ""},
+		{"temperature unit", []Register{{Key: "temperature", Unit: "hPa"}, {Key: "humidity", Unit: "%"}, {Key: "wind_speed"}}, "derived.temperature: 输入字段 temperature 的单位 \"hPa\" 不能换算为 °C"},
+		{"wind unit", []Register{{Key: "temperature"}, {Key: "humidity"}, {Key: "wind_speed", Unit: "mm"}}, "derived.wind_speed"},
+		{"humidity unit", []Register{{Key: "temperature"}, {Key: "humidity", Unit: "g/m³"}, {Key: "wind_speed"}}, "derived.humidity"},
+		{"metric key", []Register{{Key: "temperature"}, {Key: "humidity"}, {Key: "wind_speed"}, {Key: "dew_point"}}, "dew_point 与寄存器的 key 重复"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := errorsOf(validateDerived("derived", &d, tt.regs))
+			if tt.want == "" && len(errs) > 0 || tt.want != "" && (len(errs) != 1 || !strings.Contains(errs[0], tt.want)) {
+				t.Errorf("errors %v, want %q", errs, tt.want)
+			}
+		})
+	}
+
+	bad := d
+	bad.Metrics = []string{"dew_point", "dew_point", "frost_point"}
+	if errs := errorsOf(validateDerived("derived", &bad, []Register{{Key: "temperature"}, {Key: "humidity"}})); len(errs) != 2 {
+		t.Errorf("重复和不支持的衍生量 %v", errs)
+	}
+	// 缺少输入字段只是警告
+	if issues := validateDerived("derived", &d, []Register{{Key: "temperature"}}); len(issues) != 2 || len(errorsOf(issues)) != 0 {
+		t.Errorf("缺少输入字段 %v", issues)
+	}
+}
+
+func TestCalibrationValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Calibration
+		want string // 空为没有错误
+	}{
+		{"gain", Calibration{Key: "temperature", Gain: 1.02, Offset: -0.3}, ""},
+		{"points", Calibration{Key: "temperature", Gain: 1, Points: [][]float64{{0, 0.2}, {50, 49.5}}}, ""},
+		{"key", Calibration{Gain: 1}, "key 不能为空"},
+		{"zero gain", Calibration{Key: "temperature"}, "gain 不能为 0"},
+		{"points and gain", Calibration{Key: "temperature", Gain: 2, Points: [][]float64{{0, 0}, {1, 1}}}, "points 与 gain/offset 不能同时配置"},
+		{"points and offset", Calibration{Key: "temperature", Gain: 1, Offset: 1, Points: [][]float64{{0, 0}, {1, 1}}}, "points 与 gain/offset 不能同时配置"},
+		{"point size", Calibration{Key: "temperature", Gain: 1, Points: [][]float64{{0, 0}, {1}}}, "points[1] 必须为 [读数, 标准值]"},
+		{"duplicate point", Calibration{Key: "temperature", Gain: 1, Points: [][]float64{{1, 0}, {1, 1}}}, "points 中的读数 1 重复"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.c.Validate()
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || err.Error() != tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCalibration(t *testing.T) {
+	regs := []Register{{Key: "temperature"}, {Key: "humidity"}}
+	cals := []Calibration{
+		{Key: "temperature", Gain: 1, Offset: 0.5},
+		{Key: "temperature", Gain: 1},
+		{Key: "humidity"},
+		{Key: "pressure", Gain: 1},
+	}
+	issues := validateCalibration("cal", cals, regs)
+	errs := errorsOf(issues)
+	if strings.Join(errs, "\n") != "cal[1].key: temperature 重复\ncal[2]: gain 不能为 0" {
+		t.Errorf("errors %v", errs)
+	}
+	// 字段不在寄存器表中只是警告
+	if len(issues) != 3 || issues[2].Key != "cal[3].key" || !issues[2].Warning {
+		t.Errorf("issues %v", issues)
+	}
+}
+
+func limit(v float64) *float64 { return &v }
+
+func TestValidateChecks(t *testing.T) {
+	regs := []Register{{Key: "temperature"}, {Key: "humidity"}}
+	tests := []struct {
+		name  string
+		check Check
+		want  string
+	}{
+		{"valid", Check{Key: "temperature", Min: limit(-40), Max: limit(60), MaxRate: 2, StuckCount: 10, StuckDuration: time.Hour}, ""},
+		{"key", Check{}, "checks[0].key: 不能为空"},
+		{"min max", Check{Key: "temperature", Min: limit(60), Max: limit(-40)}, "checks[0]: min 不能大于 max"},
+		{"max_rate", Check{Key: "temperature", MaxRate: -1}, "checks[0]: max_rate、stuck_count、stuck_duration 不能小于 0"},
+		{"stuck_duration", Check{Key: "temperature", StuckDuration: -time.Minute}, "不能小于 0"},
+		{"stuck_count", Check{Key: "temperature", StuckCount: 1}, "checks[0].stuck_count: 至少为 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantError(t, validateChecks("checks", []Check{tt.check}, regs), tt.want)
+		})
+	}
+
+	issues := validateChecks("checks", []Check{{Key: "humidity"}, {Key: "humidity"}, {Key: "pressure"}}, regs)
+	wantError(t, issues, "checks[1].key: humidity 重复")
+	if len(issues) != 2 || !issues[1].Warning {
+		t.Errorf("不在寄存器表中 %v", issues)
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	regs := []Register{{Key: "temperature"}, {Key: "wind_speed"}}
+	filter := func(key, typ string, modify func(f *Filter)) Filter {
+		f := Filter{Key: key, Type: typ, Window: 5, Alpha: 0.3, Output: key}
+		if modify != nil {
+			modify(&f)
+		}
+		return f
+	}
+	tests := []struct {
+		name    string
+		filters []Filter
+		want    string
+	}{
+		{"valid", []Filter{filter("temperature", "median", nil), filter("wind_speed", "spike", func(f *Filter) { f.Threshold = 5 })}, ""},
+		// 后面的滤波器可以使用前面的输出
+		{"chain", []Filter{filter("wind_speed", "average", func(f *Filter) { f.Output = "wind_avg" }), filter("wind_avg", "ema", nil)}, ""},
+		{"key", []Filter{filter("", "median", nil)}, "filters[0].key: 不能为空"},
+		{"type", []Filter{filter("temperature", "kalman", nil)}, "filters[0].type: 只能是 median average ema spike"},
+		{"threshold", []Filter{filter("temperature", "spike", nil)}, "filters[0].threshold: 必须大于 0"},
+		{"window", []Filter{filter("temperature", "median", func(f *Filter) { f.Window = 101 })}, "filters[0].window: 只能是 1-100"},
+		{"alpha", []Filter{filter("temperature", "ema", func(f *Filter) { f.Alpha = 1.5 })}, "filters[0].alpha: 只能是 0-1"},
+		{"output", []Filter{filter("temperature", "median", func(f *Filter) { f.Output = "wind_speed" })}, "filters[0].output: wind_speed 与寄存器的 key 重复"},
+		{"raw_key output", []Filter{filter("temperature", "median", func(f *Filter) { f.RawKey = "temperature" })}, "filters[0].raw_key: temperature 与其他字段重复"},
+		{"raw_key register", []Filter{filter("temperature", "median", func(f *Filter) { f.Output = "t"; f.RawKey = "wind_speed" })}, "filters[0].raw_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantError(t, validateFilters("filters", tt.filters, regs), tt.want)
+		})
+	}
+
+	if issues := validateFilters("filters", []Filter{filter("pressure", "median", nil)}, regs); len(issues) != 1 || !issues[0].Warning {
+		t.Errorf("不在寄存器表中 %v", issues)
+	}
+}
+
+func TestValidateUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		u    Units
+		want string
+	}{
+		{"empty", Units{}, ""},
+		{"imperial", Units{System: "imperial", Speed: "bft"}, ""},
+		{"system", Units{System: "british"}, "units.system: 只能是 metric 或 imperial"},
+		{"speed", Units{Speed: "°C"}, "units.speed: 不支持的单位 \"°C\""},
+		{"temperature", Units{Temperature: "m/s"}, "units.temperature"},
+		{"precipitation", Units{Precipitation: "hPa"}, "units.precipitation"},
+		{"pressure", Units{Pressure: "mm"}, "units.pressure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantError(t, validateUnits("units", &tt.u), tt.want)
+		})
+	}
+}
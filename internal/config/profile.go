@@ -0,0 +1,168 @@
+package config
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Profile 设备型号：寄存器表、写命令和平台模板 ID，内置的型号在 profiles 目录下，每个文件一个型号，文件名即型号名
+type Profile struct {
+	Name        string                  `mapstructure:"-"`
+	Description string                  `mapstructure:"description"`
+	CfgID       string                  `mapstructure:"cfg_id"`
+	Registers   []Register              `mapstructure:"registers"`
+	Commands    map[string]WriteCommand `mapstructure:"commands"`
+}
+
+// WriteCommand 设备支持的写命令，例如雨量清零
+type WriteCommand struct {
+	Function int      `mapstructure:"function"` // 5 写单个线圈 6 写单个寄存器 16 写多个寄存器
+	Address  uint16   `mapstructure:"address"`
+	Values   []uint16 `mapstructure:"values"` // 功能码 5 时 0 为断开，其他值为闭合
+}
+
+// DefaultProfile 未配置 profile 和 registers 时使用的型号
+const DefaultProfile = "weather_6in1"
+
+//go:embed profiles/*.yml
+var profileFiles embed.FS
+
+// 内置型号在程序启动时解析，文件随程序编译，解析失败说明文件本身有误
+var profiles = loadProfiles()
+
+func loadProfiles() map[string]*Profile {
+	entries, err := profileFiles.ReadDir("profiles")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]*Profile)
+	for _, entry := range entries {
+		data, err := profileFiles.ReadFile(path.Join("profiles", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		v := viper.New()
+		v.SetConfigType("yml")
+		p := &Profile{Name: strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))}
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			panic(fmt.Errorf("解析型号 %s 失败: %v", entry.Name(), err))
+		}
+		if err := v.Unmarshal(p); err != nil {
+			panic(fmt.Errorf("解析型号 %s 失败: %v", entry.Name(), err))
+		}
+		applyRegisterDefaults(p.Registers)
+		out[p.Name] = p
+	}
+	return out
+}
+
+// LookupProfile 按名称查找内置型号
+func LookupProfile(name string) (*Profile, bool) {
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// ProfileNames 返回所有内置型号的名称
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// applyProfile 以型号的寄存器表为基础，按 key 合并配置中的寄存器：key 相同时覆盖填写了的字段，新的 key 追加在后面。
+// 写命令按名称合并，模板 ID 只在配置中没有填写时使用型号中的值
+func applyProfile(p *Profile, regs []Register, commands map[string]WriteCommand, cfgID string) ([]Register, map[string]WriteCommand, string) {
+	merged := append([]Register(nil), p.Registers...)
+	for _, r := range regs {
+		i := slices.IndexFunc(merged, func(m Register) bool { return m.Key == r.Key })
+		if i < 0 {
+			merged = append(merged, r)
+			continue
+		}
+		merged[i] = overrideRegister(merged[i], r)
+	}
+
+	cmds := make(map[string]WriteCommand, len(p.Commands)+len(commands))
+	for name, c := range p.Commands {
+		cmds[name] = c
+	}
+	for name, c := range commands {
+		cmds[name] = c
+	}
+	if cfgID == "" {
+		cfgID = p.CfgID
+	}
+	return merged, cmds, cfgID
+}
+
+// overrideRegister 用 o 中填写了的字段覆盖 base。数值字段按配置文件中是否填写判断，可以覆盖为 0；
+// 不是从配置文件读取的寄存器没有这些信息，按是否为 0 判断
+func overrideRegister(base, o Register) Register {
+	has := func(field string, nonZero bool) bool {
+		if o.set != nil {
+			return o.set[field]
+		}
+		return nonZero
+	}
+	if o.Name != "" {
+		base.Name = o.Name
+	}
+	if has("function", o.Function != 0) {
+		base.Function = o.Function
+	}
+	if has("address", o.Address != 0) {
+		base.Address = o.Address
+	}
+	if o.Type != "" {
+		base.Type = o.Type
+		// 修改了数据类型而没有指定长度时按新的类型推算
+		base.Length = o.Length
+	}
+	if has("length", o.Length != 0) {
+		base.Length = o.Length
+	}
+	if o.WordOrder != "" {
+		base.WordOrder = o.WordOrder
+	}
+	if has("scale", o.Scale != 0) {
+		base.Scale = o.Scale
+	}
+	if o.Unit != "" {
+		base.Unit = o.Unit
+	}
+	return base
+}
+
+// markRegisterFields 按原始配置记录 modbus.registers 和 modbus.devices[].registers 中每个寄存器填写了的字段
+func markRegisterFields(settings map[string]interface{}, c *Config) {
+	mark := func(regs []Register, raw interface{}) {
+		items, _ := raw.([]interface{})
+		for i, item := range items {
+			fields, ok := item.(map[string]interface{})
+			if !ok || i >= len(regs) {
+				continue
+			}
+			regs[i].set = make(map[string]bool, len(fields))
+			for k := range fields {
+				regs[i].set[strings.ToLower(k)] = true
+			}
+		}
+	}
+	modbus, _ := settings["modbus"].(map[string]interface{})
+	mark(c.Modbus.Registers, modbus["registers"])
+	devices, _ := modbus["devices"].([]interface{})
+	for i, d := range devices {
+		if fields, ok := d.(map[string]interface{}); ok && i < len(c.Modbus.Devices) {
+			mark(c.Modbus.Devices[i].Registers, fields["registers"])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func load(t *testing.T, yml string) (*Config, []Issue) {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yml")
+	if err := v.ReadConfig(strings.NewReader(yml)); err != nil {
+		t.Fatal(err)
+	}
+	return Load(v)
+}
+
+func register(regs []Register, key string) Register {
+	for _, r := range regs {
+		if r.Key == key {
+			return r
+		}
+	}
+	return Register{}
+}
+
+func TestOverrideRegister(t *testing.T) {
+	cfg, _ := load(t, `
+modbus:
+  profile: compact_8in1
+  registers:
+    # 填写为 0 时同样覆盖型号中的值
+    - { key: humidity, address: 0 }
+    - { key: wind_speed, address: 20, scale: 0.1, unit: "km/h" }
+    - { key: temperature, type: float32 }
+  devices:
+    - slave_id: 2
+      profile: compact_8in1
+      registers:
+        - { key: pressure, address: 0, function: 4 }
+`)
+	tests := []struct {
+		name      string
+		got, want Register
+	}{
+		{"address 0", register(cfg.Modbus.Registers, "humidity"), Register{Name: "湿度", Key: "humidity", Function: 3, Address: 0, Length: 1, Type: "uint16", Scale: 0.1, WordOrder: "ABCD", Unit: "%"}},
+		{"fields", register(cfg.Modbus.Registers, "wind_speed"), Register{Name: "风速", Key: "wind_speed", Function: 3, Address: 20, Length: 1, Type: "uint16", Scale: 0.1, WordOrder: "ABCD", Unit: "km/h"}},
+		// 修改类型而没有指定长度时按新类型推算
+		{"type", register(cfg.Modbus.Registers, "temperature"), Register{Name: "温度", Key: "temperature", Function: 3, Address: 3, Length: 2, Type: "float32", Scale: 0.1, WordOrder: "ABCD", Unit: "°C"}},
+		{"untouched", register(cfg.Modbus.Registers, "rainfall"), Register{Name: "雨量", Key: "rainfall", Function: 3, Address: 5, Length: 1, Type: "uint16", Scale: 0.1, WordOrder: "ABCD", Unit: "mm"}},
+		{"device", register(cfg.Modbus.Devices[0].Registers, "pressure"), Register{Name: "气压", Key: "pressure", Function: 4, Address: 0, Length: 1, Type: "uint16", Scale: 0.1, WordOrder: "ABCD", Unit: "hPa"}},
+	}
+	for _, tt := range tests {
+		tt.got.set = nil
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+	if n := len(cfg.Modbus.Registers); n != 8 {
+		t.Errorf("合并后 %d 个寄存器", n)
+	}
+}
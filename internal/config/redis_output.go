@@ -0,0 +1,36 @@
+package config
+
+import "fmt"
+
+// RedisOutput 把每次采集的数据写回 redis，供路由器上的 LuCI 页面、告警脚本等读取
+type RedisOutput struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 最新数据写入的 hash，默认 weather_data，{device} 替换为设备 MAC
+	Hash string `mapstructure:"hash"`
+	// 不为空时同时把每次采集的数据追加到该 stream，{device} 同上
+	Stream string `mapstructure:"stream"`
+	MaxLen int64  `mapstructure:"maxlen"` // stream 保留的大约条数，默认 10000
+	// 写入 redis 的单位，不配置时与设备上报 MQTT 的单位相同
+	Units Units `mapstructure:"units"`
+}
+
+func (r *RedisOutput) applyDefaults() {
+	if r.Hash == "" {
+		r.Hash = "weather_data"
+	}
+	if r.MaxLen == 0 {
+		r.MaxLen = 10000
+	}
+}
+
+func (r *RedisOutput) validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	issues = append(issues, validateUnits("redis_output.units", &r.Units)...)
+	if r.MaxLen < 0 {
+		add("redis_output.maxlen", "不能小于 0")
+	}
+	return issues
+}
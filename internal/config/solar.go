@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Solar 对太阳辐照度(W/m²)按时间积分，统计当天的辐射量、日照时数和峰值，本地时间零点清零
+type Solar struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Key     string `mapstructure:"key"`  // 辐照度字段，默认 solarRadiation
+	Unit    string `mapstructure:"unit"` // 辐射量单位 MJ(MJ/m²，默认) 或 kWh(kWh/m²)
+	// 辐照度不低于 threshold(默认 120W/m²，WMO 标准) 的时间计为日照时数
+	Threshold float64 `mapstructure:"threshold"`
+	// 两次采集间隔超过 max_gap(默认 5m) 时这段时间不积分，按缺测处理
+	MaxGap time.Duration `mapstructure:"max_gap"`
+	// 当天的累计值保存位置，重启后继续累计
+	StateFile string `mapstructure:"state_file"`
+}
+
+func (s *Solar) applyDefaults() {
+	if s.Key == "" {
+		s.Key = "solarRadiation"
+	}
+	if s.Unit == "" {
+		s.Unit = "MJ"
+	}
+	if s.Threshold == 0 {
+		s.Threshold = 120
+	}
+	if s.MaxGap == 0 {
+		s.MaxGap = 5 * time.Minute
+	}
+	if s.StateFile == "" {
+		s.StateFile = "/mnt/data_collect/solar_state.json"
+	}
+}
+
+func (s *Solar) validate() []Issue {
+	if !s.Enabled {
+		return nil
+	}
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	if s.Unit != "MJ" && s.Unit != "kWh" {
+		add("solar.unit", "只能是 MJ 或 kWh，当前为 %q", s.Unit)
+	}
+	if s.Threshold < 0 {
+		add("solar.threshold", "不能小于 0")
+	}
+	if s.MaxGap < 0 {
+		add("solar.max_gap", "不能小于 0")
+	}
+	return issues
+}
@@ -0,0 +1,73 @@
+package config
+
+import "fmt"
+
+// Issue 配置检查发现的问题，Warning 为 true 时不影响程序启动
+type Issue struct {
+	Key     string
+	Msg     string
+	Warning bool
+}
+
+func (i Issue) String() string {
+	level := "ERROR"
+	if i.Warning {
+		level = "WARN "
+	}
+	if i.Key == "" {
+		return fmt.Sprintf("%s %s", level, i.Msg)
+	}
+	return fmt.Sprintf("%s %s: %s", level, i.Key, i.Msg)
+}
+
+// HasError 判断是否存在非 Warning 级别的问题
+func HasError(issues []Issue) bool {
+	for _, i := range issues {
+		if !i.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查取值范围以及配置项之间的约束，需在补全默认值之后调用
+func (c *Config) Validate() []Issue {
+	var issues []Issue
+	add := func(key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+	issues = append(issues, c.Log.validate()...)
+	issues = append(issues, c.Mqtt.validate()...)
+	issues = append(issues, c.DB.validate()...)
+	if c.ShutdownTimeout <= 0 {
+		add("shutdown_timeout", "必须大于 0")
+	}
+	issues = append(issues, c.Modbus.validate()...)
+	issues = append(issues, c.Gateway.validate()...)
+	if !c.Gateway.Enabled && len(c.Modbus.Devices) > 1 {
+		add("modbus.devices", "多个设备需要开启网关模式(gateway.enabled)")
+	}
+	issues = append(issues, c.Attributes.validate()...)
+	issues = append(issues, c.History.validate()...)
+	issues = append(issues, c.ET0.validate()...)
+	if c.ET0.Enabled {
+		if len(c.Modbus.Devices) == 0 {
+			issues = append(issues, c.ET0.validateInputs("modbus.registers", c.Modbus.Registers)...)
+		}
+		for i, d := range c.Modbus.Devices {
+			issues = append(issues, c.ET0.validateInputs(fmt.Sprintf("modbus.devices[%d].registers", i), d.Registers)...)
+		}
+	}
+	issues = append(issues, c.Solar.validate()...)
+	issues = append(issues, c.RedisOutput.validate()...)
+	issues = append(issues, c.Alarms.validate()...)
+	// 直连模式下设备没有子设备编号，限定设备的规则永远不会匹配
+	if !c.Gateway.Enabled {
+		for i, r := range c.Alarms.Rules {
+			if len(r.Devices) > 0 {
+				add(fmt.Sprintf("alarms.rules[%d].devices", i), "只在网关模式(gateway.enabled)下有效")
+			}
+		}
+	}
+	return issues
+}
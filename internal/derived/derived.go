@@ -0,0 +1,132 @@
+// Package derived 由温度、湿度、风速计算露点、体感温度等衍生气象量
+package derived
+
+import (
+	"dataCollect/internal/config"
+	"dataCollect/internal/numeric"
+	"dataCollect/internal/units"
+	"math"
+)
+
+// 各衍生量的计算函数，输入缺失或不在适用范围内时返回 false
+var metrics = map[string]func(in *inputs) (float64, bool){
+	"dew_point":            dewPoint,
+	"absolute_humidity":    absoluteHumidity,
+	"vpd":                  vpd,
+	"heat_index":           heatIndex,
+	"wind_chill":           windChill,
+	"apparent_temperature": apparentTemperature,
+}
+
+// Units 各衍生量的单位
+var Units = map[string]string{
+	"dew_point":            "°C",
+	"absolute_humidity":    "g/m³",
+	"vpd":                  "kPa",
+	"heat_index":           "°C",
+	"wind_chill":           "°C",
+	"apparent_temperature": "°C",
+}
+
+// 计算用到的输入：温度 ℃、相对湿度 %、风速 m/s
+type inputs struct {
+	t, rh, ws          float64
+	hasT, hasRH, hasWS bool
+}
+
+// Apply 按配置计算衍生量并加入 values，读取失败缺少输入时跳过对应的衍生量。
+// src 为各字段的单位，温度和风速按单位换算为 ℃ 和 m/s，没有单位时视为已经是 ℃ 和 m/s
+func Apply(conf *config.Derived, values map[string]interface{}, src map[string]string) {
+	if len(conf.Metrics) == 0 {
+		return
+	}
+	in := &inputs{}
+	in.t, in.hasT = units.Field(values, src, conf.Temperature, "°C")
+	in.rh, in.hasRH = numeric.ToFloat(values[conf.Humidity])
+	in.ws, in.hasWS = units.Field(values, src, conf.WindSpeed, "m/s")
+	for _, name := range conf.Metrics {
+		if v, ok := metrics[name](in); ok && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			values[name] = numeric.Round(v, 2)
+		}
+	}
+}
+
+// 饱和水汽压 kPa，FAO-56 公式
+func saturationVapourPressure(t float64) float64 {
+	return 0.6108 * math.Exp(17.27*t/(t+237.3))
+}
+
+// 实际水汽压 kPa
+func vapourPressure(in *inputs) float64 {
+	return saturationVapourPressure(in.t) * in.rh / 100
+}
+
+// 露点 ℃，Magnus 公式，湿度为 0 时无意义
+func dewPoint(in *inputs) (float64, bool) {
+	if !in.hasT || !in.hasRH || in.rh <= 0 {
+		return 0, false
+	}
+	const a, b = 17.62, 243.12
+	g := math.Log(in.rh/100) + a*in.t/(b+in.t)
+	return b * g / (a - g), true
+}
+
+// 绝对湿度 g/m³
+func absoluteHumidity(in *inputs) (float64, bool) {
+	if !in.hasT || !in.hasRH {
+		return 0, false
+	}
+	return 216.7 * vapourPressure(in) * 10 / (in.t + 273.15), true
+}
+
+// 饱和水汽压差 kPa
+func vpd(in *inputs) (float64, bool) {
+	if !in.hasT || !in.hasRH {
+		return 0, false
+	}
+	return saturationVapourPressure(in.t) - vapourPressure(in), true
+}
+
+// 酷热指数 ℃，美国国家气象局的算法(Rothfusz 回归及修正)，在华氏度下计算，气温低于 26.7℃(80℉) 时等于气温
+func heatIndex(in *inputs) (float64, bool) {
+	if !in.hasT || !in.hasRH {
+		return 0, false
+	}
+	t, rh := in.t*9/5+32, in.rh
+	if t < 80 {
+		return in.t, true
+	}
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t -
+			0.05481717*rh*rh + 0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		switch {
+		case rh < 13 && t >= 80 && t <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case rh > 85 && t >= 80 && t <= 87:
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9, true
+}
+
+// 风寒温度 ℃，加拿大/美国通用公式，只适用于气温 10℃ 以下、风速 4.8km/h 以上，其余情况等于气温
+func windChill(in *inputs) (float64, bool) {
+	if !in.hasT || !in.hasWS {
+		return 0, false
+	}
+	v := in.ws * 3.6
+	if in.t > 10 || v <= 4.8 {
+		return in.t, true
+	}
+	p := math.Pow(v, 0.16)
+	return 13.12 + 0.6215*in.t - 11.37*p + 0.3965*in.t*p, true
+}
+
+// 体感温度 ℃，澳大利亚气象局的 Steadman 公式(不含辐射)
+func apparentTemperature(in *inputs) (float64, bool) {
+	if !in.hasT || !in.hasRH || !in.hasWS {
+		return 0, false
+	}
+	return in.t + 0.33*vapourPressure(in)*10 - 0.70*in.ws - 4.00, true
+}
@@ -0,0 +1,83 @@
+package derived
+
+import (
+	"dataCollect/internal/config"
+	"math"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	conf := &config.Derived{
+		Temperature: "temperature",
+		Humidity:    "humidity",
+		WindSpeed:   "wind_speed",
+		Metrics:     config.DerivedMetrics,
+	}
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		src    map[string]string
+		metric string
+		want   float64
+		tol    float64
+	}{
+		// Magnus 公式(Alduchov & Eskridge)
+		{"dew point", map[string]interface{}{"temperature": 25.0, "humidity": 60.0}, nil, "dew_point", 16.69, 0.01},
+		{"absolute humidity", map[string]interface{}{"temperature": 20.0, "humidity": 50.0}, nil, "absolute_humidity", 8.64, 0.01},
+		// FAO-56 饱和水汽压 3.168kPa
+		{"vpd", map[string]interface{}{"temperature": 25.0, "humidity": 50.0}, nil, "vpd", 1.58, 0.01},
+		// 美国国家气象局酷热指数表 90℉ 70% 为 106℉
+		{"heat index", map[string]interface{}{"temperature": 32.22, "humidity": 70.0}, nil, "heat_index", 41.1, 0.3},
+		{"heat index below 80F", map[string]interface{}{"temperature": 20.0, "humidity": 70.0}, nil, "heat_index", 20, 0},
+		// 加拿大环境部风寒表 -10℃ 20km/h 为 -18
+		{"wind chill", map[string]interface{}{"temperature": -10.0, "wind_speed": 20 / 3.6}, nil, "wind_chill", -17.86, 0.01},
+		{"wind chill calm", map[string]interface{}{"temperature": -10.0, "wind_speed": 1.0}, nil, "wind_chill", -10, 0},
+		{"apparent temperature", map[string]interface{}{"temperature": 25.0, "humidity": 50.0, "wind_speed": 2.0}, nil, "apparent_temperature", 24.83, 0.01},
+		// 输入按寄存器的单位换算为 ℃ 和 m/s
+		{"fahrenheit", map[string]interface{}{"temperature": 77.0, "humidity": 60.0}, map[string]string{"temperature": "°F", "humidity": "%"}, "dew_point", 16.69, 0.01},
+		{"km/h", map[string]interface{}{"temperature": 14.0, "wind_speed": 20.0}, map[string]string{"temperature": "°F", "wind_speed": "km/h"}, "wind_chill", -17.86, 0.01},
+		{"kelvin", map[string]interface{}{"temperature": 298.15, "humidity": 50.0}, map[string]string{"temperature": "K"}, "vpd", 1.58, 0.01},
+		// 整数等其他数值类型
+		{"int input", map[string]interface{}{"temperature": 25, "humidity": int64(60)}, nil, "dew_point", 16.69, 0.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Apply(conf, tt.values, tt.src)
+			got, ok := tt.values[tt.metric].(float64)
+			if !ok || math.Abs(got-tt.want) > tt.tol {
+				t.Errorf("%s = %v, want %v ±%v", tt.metric, tt.values[tt.metric], tt.want, tt.tol)
+			}
+		})
+	}
+}
+
+func TestApplySkip(t *testing.T) {
+	conf := &config.Derived{Temperature: "temperature", Humidity: "humidity", WindSpeed: "wind_speed", Metrics: config.DerivedMetrics}
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		src    map[string]string
+		skip   []string
+	}{
+		// 读取失败缺少输入
+		{"missing humidity", map[string]interface{}{"temperature": 20.0, "wind_speed": 5.0}, nil,
+			[]string{"dew_point", "absolute_humidity", "vpd", "heat_index", "apparent_temperature"}},
+		{"missing wind", map[string]interface{}{"temperature": 20.0, "humidity": 50.0}, nil, []string{"wind_chill", "apparent_temperature"}},
+		{"zero humidity", map[string]interface{}{"temperature": 20.0, "humidity": 0.0}, nil, []string{"dew_point"}},
+		// 不能换算的单位不参与计算，而不是当作 ℃
+		{"unconvertible unit", map[string]interface{}{"temperature": 1013.0, "humidity": 50.0, "wind_speed": 2.0},
+			map[string]string{"temperature": "hPa"}, config.DerivedMetrics},
+		{"unknown unit", map[string]interface{}{"temperature": 20.0, "humidity": 50.0, "wind_speed": 2.0},
+			map[string]string{"wind_speed": "furlong/fortnight"}, []string{"wind_chill", "apparent_temperature"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Apply(conf, tt.values, tt.src)
+			for _, m := range tt.skip {
+				if v, ok := tt.values[m]; ok {
+					t.Errorf("%s = %v，应当跳过", m, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package et0 累计温度、湿度、风速和太阳辐射，按 FAO-56 Penman-Monteith 方法计算每小时和每天的参考作物蒸散量
+package et0
+
+import (
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"dataCollect/internal/fileutil"
+	"dataCollect/internal/numeric"
+	"dataCollect/internal/units"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// 一次采集的数据最多代表的时长，采集中断超过该时长的部分不累计
+	maxSampleGap = 5 * time.Minute
+	// 一个小时或一天中有数据的时间不足该比例时不计算
+	minCoverage = 0.75
+	// 未结束的累计值保存到文件的间隔
+	saveInterval = 5 * time.Minute
+	// 还没有白天的 Rs/Rso 时夜间使用的值
+	defaultRatio = 0.8
+	dayLayout    = "20060102"
+)
+
+// Units 上报字段的单位
+var Units = map[string]string{"et0_hour": "mm", "et0_today": "mm", "et0_day": "mm"}
+
+// 时间加权的累计值，T RH U Rs 为 值×秒 之和
+type acc struct {
+	Seconds float64 `json:"seconds"`
+	T       float64 `json:"t"`
+	RH      float64 `json:"rh"`
+	U       float64 `json:"u"`
+	Rs      float64 `json:"rs"`
+	Tmax    float64 `json:"tmax"`
+	Tmin    float64 `json:"tmin"`
+	RHmax   float64 `json:"rhmax"`
+	RHmin   float64 `json:"rhmin"`
+}
+
+func (a *acc) add(dt float64, t, rh, u, rs float64) {
+	if a.Seconds == 0 {
+		a.Tmax, a.Tmin, a.RHmax, a.RHmin = t, t, rh, rh
+	}
+	a.Seconds += dt
+	a.T += t * dt
+	a.RH += rh * dt
+	a.U += u * dt
+	a.Rs += rs * dt
+	a.Tmax, a.Tmin = math.Max(a.Tmax, t), math.Min(a.Tmin, t)
+	a.RHmax, a.RHmin = math.Max(a.RHmax, rh), math.Min(a.RHmin, rh)
+}
+
+// 一个设备的累计状态
+type deviceState struct {
+	Last  int64   `json:"last"` // 上一次采集的毫秒时间戳
+	Hour  int64   `json:"hour"` // 正在累计的小时开始的毫秒时间戳
+	Day   string  `json:"day"`  // 正在累计的日期
+	H     acc     `json:"h"`
+	D     acc     `json:"d"`
+	Today float64 `json:"today"` // 当天已结束的各小时 ET0 之和
+	Ratio float64 `json:"ratio"` // 最近一次白天的 Rs/Rso，夜间计算净长波辐射时使用
+}
+
+// 保存到 state_file 的内容
+type state struct {
+	Devices map[string]*deviceState `json:"devices"`
+	// 最近一次读取到的 GPS 位置，redis 不可用时使用
+	GPS *location `json:"gps,omitempty"`
+}
+
+type location struct {
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Alt    float64 `json:"alt"`
+	HasLon bool    `json:"has_lon"`
+}
+
+var (
+	log      = initialize.Logger("et0")
+	mu       sync.Mutex
+	st       *state
+	lastSave time.Time
+	lastErr  string
+)
+
+// Update 累计一个设备的一次采集数据。小时或日期变化时计算结束的时段，
+// 把 et0_hour(上一小时)、et0_today(当天已结束各小时之和)、et0_day(前一天) 加入 values 随遥测上报。
+// src 为各字段的单位，温度和风速按单位换算为 ℃ 和 m/s，没有单位时视为已经是 ℃ 和 m/s
+func Update(ctx context.Context, id string, ts time.Time, values map[string]interface{}, src map[string]string) {
+	conf := config.Get().ET0
+	if !conf.Enabled {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if st == nil {
+		st = load(conf.StateFile)
+	}
+	ds, ok := st.Devices[id]
+	if !ok {
+		ds = &deviceState{}
+		st.Devices[id] = ds
+	}
+
+	hour := time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), 0, 0, 0, ts.Location()).UnixMilli()
+	day := ts.Format(dayLayout)
+	finished := false
+	if ds.Hour != 0 && ds.Hour != hour {
+		finishHour(ctx, &conf, id, ds, values)
+		finished = true
+	}
+	if ds.Day != "" && ds.Day != day {
+		finishDay(ctx, &conf, id, ds, values)
+		finished = true
+	}
+	ds.Hour, ds.Day = hour, day
+
+	t, ok1 := units.Field(values, src, conf.Temperature, "°C")
+	rh, ok2 := numeric.ToFloat(values[conf.Humidity])
+	u, ok3 := units.Field(values, src, conf.WindSpeed, "m/s")
+	rs, ok4 := numeric.ToFloat(values[conf.SolarRadiation])
+	if ok1 && ok2 && ok3 && ok4 {
+		if ds.Last > 0 && ts.UnixMilli() > ds.Last {
+			dt := min(time.Duration(ts.UnixMilli()-ds.Last)*time.Millisecond, maxSampleGap).Seconds()
+			u2 := windAt2m(u, conf.WindHeight)
+			// 夜间辐射传感器可能有少量负的零点偏移
+			rs = max(rs, 0)
+			ds.H.add(dt, t, rh, u2, rs)
+			ds.D.add(dt, t, rh, u2, rs)
+		}
+		ds.Last = ts.UnixMilli()
+	}
+
+	if finished || time.Since(lastSave) >= saveInterval {
+		save(conf.StateFile)
+	}
+}
+
+// Close 程序退出时保存未结束的累计值
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if st != nil {
+		save(config.Get().ET0.StateFile)
+	}
+}
+
+func finishHour(ctx context.Context, conf *config.ET0, id string, ds *deviceState, values map[string]interface{}) {
+	h := ds.H
+	ds.H = acc{}
+	start := time.UnixMilli(ds.Hour)
+	if h.Seconds < 3600*minCoverage {
+		log.WithField("device", id).Debugf("%s 的数据不足 %.0f%%，不计算小时 ET0", start.Format("2006-01-02 15:04"), minCoverage*100)
+		return
+	}
+	loc, err := resolveLocation(ctx, conf)
+	if err != nil {
+		logError(err)
+		return
+	}
+	lat := loc.Lat * math.Pi / 180
+	lon := loc.Lon
+	if !loc.HasLon {
+		// 没有经度时按时区的中央经线计算，太阳时最多相差半小时
+		_, offset := start.Zone()
+		lon = float64(offset) / 3600 * 15
+	}
+	// 太阳辐射 W/m² 的平均值换算为 MJ/m²/h
+	rs := h.Rs / h.Seconds * 0.0036
+	rso := clearSky(hourlyRa(lat, lon, start, 1), loc.Alt)
+	ratio := ds.Ratio
+	if ratio == 0 {
+		ratio = defaultRatio
+	}
+	// 太阳高度较低时 Rs/Rso 误差很大，使用之前的值
+	if rso > 0.3 {
+		ratio = rs / rso
+		ds.Ratio = ratio
+	}
+	v := hourlyET0(h.T/h.Seconds, h.RH/h.Seconds, h.U/h.Seconds, rs, ratio, rso > 0, loc.Alt)
+	ds.Today += v
+	values["et0_hour"] = numeric.Round(v, 3)
+	values["et0_today"] = numeric.Round(ds.Today, 3)
+	log.WithField("device", id).Debugf("%s 小时 ET0 %.3fmm", start.Format("2006-01-02 15:04"), v)
+}
+
+func finishDay(ctx context.Context, conf *config.ET0, id string, ds *deviceState, values map[string]interface{}) {
+	d := ds.D
+	ds.D = acc{}
+	ds.Today = 0
+	values["et0_today"] = 0.0
+	if d.Seconds < 86400*minCoverage {
+		log.WithField("device", id).Warnf("%s 的数据不足 %.0f%%，不计算日 ET0", ds.Day, minCoverage*100)
+		return
+	}
+	loc, err := resolveLocation(ctx, conf)
+	if err != nil {
+		logError(err)
+		return
+	}
+	date, err := time.ParseInLocation(dayLayout, ds.Day, time.Local)
+	if err != nil {
+		return
+	}
+	// 太阳辐射 W/m² 的平均值换算为 MJ/m²/day
+	rs := d.Rs / d.Seconds * 0.0864
+	v := dailyET0(d.Tmax, d.Tmin, d.RHmax, d.RHmin, d.U/d.Seconds, rs, loc.Lat*math.Pi/180, loc.Alt, date.YearDay())
+	values["et0_day"] = numeric.Round(v, 3)
+	log.WithField("device", id).Infof("%s 日 ET0 %.2fmm", ds.Day, v)
+}
+
+// resolveLocation 配置中的位置优先，没有配置的项从 redis 的 GPS 数据读取，
+// 读取失败时使用上一次读取到的位置
+func resolveLocation(ctx context.Context, conf *config.ET0) (*location, error) {
+	var gps *location
+	var err error
+	if conf.Latitude == nil || conf.Longitude == nil || conf.Altitude == nil {
+		gps, err = readGPS(ctx, conf.GPSKey)
+		if err == nil {
+			st.GPS = gps
+		} else if st.GPS != nil {
+			gps = st.GPS
+		}
+	}
+	loc := &location{}
+	switch {
+	case conf.Latitude != nil:
+		loc.Lat = *conf.Latitude
+	case gps != nil:
+		loc.Lat = gps.Lat
+	default:
+		return nil, fmt.Errorf("纬度未知，请配置 et0.latitude 或等待 GPS 定位: %v", err)
+	}
+	switch {
+	case conf.Longitude != nil:
+		loc.Lon, loc.HasLon = *conf.Longitude, true
+	case gps != nil:
+		loc.Lon, loc.HasLon = gps.Lon, true
+	}
+	switch {
+	case conf.Altitude != nil:
+		loc.Alt = *conf.Altitude
+	case gps != nil:
+		loc.Alt = gps.Alt
+	}
+	return loc, nil
+}
+
+func readGPS(ctx context.Context, key string) (*location, error) {
+	client, ok := initialize.RedisClient()
+	if !ok {
+		return nil, errors.New("redis 不可用")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	res, err := client.HMGet(ctx, key, "latitude", "longitude", "altitude").Result()
+	if err != nil {
+		return nil, err
+	}
+	var f [3]float64
+	for i, v := range res {
+		s, _ := v.(string)
+		f[i], _ = strconv.ParseFloat(s, 64)
+	}
+	// 未定位时 GPS 模块输出 0
+	if f[0] == 0 && f[1] == 0 {
+		return nil, fmt.Errorf("%s 中没有有效的经纬度", key)
+	}
+	return &location{Lat: f[0], Lon: f[1], Alt: f[2], HasLon: true}, nil
+}
+
+func load(path string) *state {
+	s := &state{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, s)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("读取 %s 失败，重新开始累计: %v", path, err)
+	}
+	if s.Devices == nil {
+		s.Devices = make(map[string]*deviceState)
+	}
+	return s
+}
+
+func save(path string) {
+	lastSave = time.Now()
+	data, err := json.Marshal(st)
+	if err == nil {
+		err = fileutil.AtomicWrite(path, data)
+	}
+	if err != nil {
+		logError(fmt.Errorf("保存 %s 失败: %v", path, err))
+	}
+}
+
+// 同样的错误每小时都会出现，只在错误变化时记录
+func logError(err error) {
+	if err.Error() != lastErr {
+		lastErr = err.Error()
+		log.Warn(err)
+	}
+}
@@ -0,0 +1,54 @@
+package et0
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 输入按寄存器的单位换算为 ℃ 和 m/s 后累计
+func TestUpdateUnits(t *testing.T) {
+	config.Set(&config.Config{ET0: config.ET0{
+		Enabled:        true,
+		WindHeight:     2,
+		Temperature:    "temperature",
+		Humidity:       "humidity",
+		WindSpeed:      "wind_speed",
+		SolarRadiation: "solarRadiation",
+		StateFile:      filepath.Join(t.TempDir(), "et0_state.json"),
+	}})
+	st = nil
+	ts := time.Date(2026, 6, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		id     string
+		values map[string]interface{}
+		src    map[string]string
+	}{
+		{"metric", map[string]interface{}{"temperature": 25.0, "humidity": 60.0, "wind_speed": 3.6, "solarRadiation": 800.0}, nil},
+		{"imperial", map[string]interface{}{"temperature": 77.0, "humidity": 60.0, "wind_speed": 12.96, "solarRadiation": 800.0},
+			map[string]string{"temperature": "°F", "humidity": "%", "wind_speed": "km/h", "solarRadiation": "W/m²"}},
+	}
+	for _, tt := range tests {
+		Update(context.Background(), tt.id, ts, tt.values, tt.src)
+		Update(context.Background(), tt.id, ts.Add(time.Minute), tt.values, tt.src)
+	}
+	for _, id := range []string{"metric", "imperial"} {
+		h := st.Devices[id].H
+		if h.Seconds != 60 {
+			t.Fatalf("%s 累计时间 %v", id, h.Seconds)
+		}
+		near(t, id+" T", h.T/h.Seconds, 25, 1e-9)
+		near(t, id+" RH", h.RH/h.Seconds, 60, 1e-9)
+		near(t, id+" U", h.U/h.Seconds, 3.6, 1e-9)
+		near(t, id+" Rs", h.Rs/h.Seconds, 800, 1e-9)
+	}
+
+	// 不能换算的单位不累计
+	Update(context.Background(), "bad", ts, tests[0].values, map[string]string{"temperature": "hPa"})
+	Update(context.Background(), "bad", ts.Add(time.Minute), tests[0].values, map[string]string{"temperature": "hPa"})
+	if h := st.Devices["bad"].H; h.Seconds != 0 {
+		t.Errorf("不能换算的单位参与了累计 %+v", h)
+	}
+}
@@ -0,0 +1,120 @@
+package et0
+
+import (
+	"math"
+	"time"
+)
+
+// FAO Irrigation and Drainage Paper No. 56 中的公式，编号为原文的公式编号。
+// 辐射单位 MJ/m²，温度 ℃，水汽压 kPa，风速为 2m 高度的 m/s
+const (
+	solarConstant = 0.0820   // MJ/m²/min
+	stefanBoltz   = 4.903e-9 // MJ/K⁴/m²/day
+)
+
+// 饱和水汽压 (11)
+func satVP(t float64) float64 {
+	return 0.6108 * math.Exp(17.27*t/(t+237.3))
+}
+
+// 饱和水汽压曲线斜率 (13)
+func slope(t float64) float64 {
+	return 4098 * satVP(t) / math.Pow(t+237.3, 2)
+}
+
+// 干湿表常数 (7)(8)，由海拔估算气压
+func psychrometric(altitude float64) float64 {
+	p := 101.3 * math.Pow((293-0.0065*altitude)/293, 5.26)
+	return 0.665e-3 * p
+}
+
+// 换算为 2m 高度的风速 (47)
+func windAt2m(u, height float64) float64 {
+	if height == 2 {
+		return u
+	}
+	return u * 4.87 / math.Log(67.8*height-5.42)
+}
+
+// 日地距离修正和太阳赤纬 (23)(24)
+func solarGeometry(j int) (dr, decl float64) {
+	x := 2 * math.Pi * float64(j) / 365
+	return 1 + 0.033*math.Cos(x), 0.409 * math.Sin(x-1.39)
+}
+
+// 日落时角 (25)，极昼极夜时取 π 或 0
+func sunsetAngle(lat, decl float64) float64 {
+	return math.Acos(math.Max(-1, math.Min(1, -math.Tan(lat)*math.Tan(decl))))
+}
+
+// 日天文辐射 (21)，lat 为弧度
+func dailyRa(lat float64, j int) float64 {
+	dr, decl := solarGeometry(j)
+	ws := sunsetAngle(lat, decl)
+	return 24 * 60 / math.Pi * solarConstant * dr *
+		(ws*math.Sin(lat)*math.Sin(decl) + math.Cos(lat)*math.Cos(decl)*math.Sin(ws))
+}
+
+// 时段天文辐射 (28)，start 为时段开始的本地时间，lon 为经度(度，东经为正)
+func hourlyRa(lat, lon float64, start time.Time, hours float64) float64 {
+	j := start.YearDay()
+	dr, decl := solarGeometry(j)
+	// 时段中点的太阳时角 (31)(32)(33)，FAO 中的经度以西经为正
+	b := 2 * math.Pi * float64(j-81) / 364
+	sc := 0.1645*math.Sin(2*b) - 0.1255*math.Cos(b) - 0.025*math.Sin(b)
+	_, offset := start.Zone()
+	lz := -float64(offset) / 3600 * 15
+	lm := -lon
+	mid := float64(start.Hour()) + float64(start.Minute())/60 + hours/2
+	w := math.Pi / 12 * (mid + 0.06667*(lz-lm) + sc - 12)
+	ws := sunsetAngle(lat, decl)
+	w1 := math.Max(w-math.Pi*hours/24, -ws)
+	w2 := math.Min(w+math.Pi*hours/24, ws)
+	if w1 >= w2 {
+		return 0
+	}
+	return 12 * 60 / math.Pi * solarConstant * dr *
+		((w2-w1)*math.Sin(lat)*math.Sin(decl) + math.Cos(lat)*math.Cos(decl)*(math.Sin(w2)-math.Sin(w1)))
+}
+
+// 晴空辐射 (37)
+func clearSky(ra, altitude float64) float64 {
+	return (0.75 + 2e-5*altitude) * ra
+}
+
+// 净长波辐射 (39)，tk4 为绝对温度四次方(日数据为最高、最低温度的平均)，sigma 按时段换算
+func netLongwave(sigma, tk4, ea, ratio float64) float64 {
+	return sigma * tk4 * (0.34 - 0.14*math.Sqrt(ea)) * (1.35*math.Min(ratio, 1) - 0.35)
+}
+
+// dailyET0 日参考作物蒸散量 (6)，rs 为当天太阳辐射总量
+func dailyET0(tmax, tmin, rhmax, rhmin, u2, rs, lat, altitude float64, j int) float64 {
+	t := (tmax + tmin) / 2
+	es := (satVP(tmax) + satVP(tmin)) / 2
+	ea := (satVP(tmin)*rhmax/100 + satVP(tmax)*rhmin/100) / 2
+	rso := clearSky(dailyRa(lat, j), altitude)
+	ratio := 1.0
+	if rso > 0 {
+		ratio = rs / rso
+	}
+	tk4 := (math.Pow(tmax+273.16, 4) + math.Pow(tmin+273.16, 4)) / 2
+	rn := (1-0.23)*rs - netLongwave(stefanBoltz, tk4, ea, ratio)
+	d, g := slope(t), psychrometric(altitude)
+	return (0.408*d*rn + g*900/(t+273)*u2*(es-ea)) / (d + g*(1+0.34*u2))
+}
+
+// hourlyET0 小时参考作物蒸散量 (53)，rs 为该小时太阳辐射总量，ratio 为 Rs/Rso，
+// 夜间 Rso 接近 0 时由调用方传入日落前的值
+func hourlyET0(t, rh, u2, rs, ratio float64, day bool, altitude float64) float64 {
+	es := satVP(t)
+	ea := es * rh / 100
+	tk4 := math.Pow(t+273.16, 4)
+	rn := (1-0.23)*rs - netLongwave(stefanBoltz/24, tk4, ea, ratio)
+	// 土壤热通量 (45)(46)
+	soil := 0.5 * rn
+	if day {
+		soil = 0.1 * rn
+	}
+	d, g := slope(t), psychrometric(altitude)
+	return (0.408*d*(rn-soil) + g*37/(t+273)*u2*(es-ea)) / (d + g*(1+0.34*u2))
+}
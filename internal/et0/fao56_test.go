@@ -0,0 +1,100 @@
+package et0
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// 期望值来自 FAO-56 第 3、4 章的算例，原文的中间结果保留 2-3 位小数，按相应的精度比较
+func near(t *testing.T, name string, got, want, tol float64) {
+	t.Helper()
+	if math.Abs(got-want) > tol {
+		t.Errorf("%s = %.4f, want %.4f ± %v", name, got, want, tol)
+	}
+}
+
+func deg(d, m float64) float64 {
+	return (d + m/60) * math.Pi / 180
+}
+
+func TestComponents(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want float64
+		tol       float64
+	}{
+		// Example 2: 海拔 1800m 的干湿表常数
+		{"psychrometric(1800)", psychrometric(1800), 0.054, 0.0005},
+		// Example 3: 饱和水汽压
+		{"satVP(24.5)", satVP(24.5), 3.075, 0.001},
+		{"satVP(15)", satVP(15), 1.705, 0.001},
+		// Example 14: 10m 高度 3.2m/s
+		{"windAt2m(3.2, 10)", windAt2m(3.2, 10), 2.4, 0.01},
+		// Example 8: 南纬 20°，9 月 3 日
+		{"dailyRa(-20°, 246)", dailyRa(-deg(20, 0), 246), 32.2, 0.05},
+		// Example 17: 布鲁塞尔 北纬 50°48'，7 月 6 日，海拔 100m
+		{"dailyRa(50°48', 187)", dailyRa(deg(50, 48), 187), 41.09, 0.02},
+		{"clearSky(41.09, 100)", clearSky(41.09, 100), 30.90, 0.01},
+		// Example 18: 曼谷 北纬 13°44'，4 月 15 日
+		{"dailyRa(13°44', 105)", dailyRa(deg(13, 44), 105), 38.06, 0.02},
+		// Example 10: Tmax 25.1 Tmin 19.1 ea 2.1 Rs 14.5 Rso 18.8
+		{"netLongwave", netLongwave(stefanBoltz, (math.Pow(25.1+273.16, 4)+math.Pow(19.1+273.16, 4))/2, 2.1, 14.5/18.8), 3.5, 0.05},
+	}
+	for _, tt := range tests {
+		near(t, tt.name, tt.got, tt.want, tt.tol)
+	}
+}
+
+// Example 19: 塞内加尔 N'Diaye 北纬 16°13'、西经 16°15'，海拔 8m，10 月 1 日。
+// 当地时区的中央经线为西经 15°(UTC-1)
+func TestHourly(t *testing.T) {
+	lat := deg(16, 13)
+	lon := -(16 + 15.0/60)
+	zone := time.FixedZone("UTC-1", -3600)
+	start := time.Date(2001, 10, 1, 14, 0, 0, 0, zone)
+
+	ra := hourlyRa(lat, lon, start, 1)
+	near(t, "Ra 14-15h", ra, 3.543, 0.005)
+	rso := clearSky(ra, 8)
+	near(t, "Rso 14-15h", rso, 2.658, 0.005)
+	near(t, "Ra 02-03h", hourlyRa(lat, lon, time.Date(2001, 10, 1, 2, 0, 0, 0, zone), 1), 0, 0)
+
+	tests := []struct {
+		name                 string
+		t, rh, u2, rs, ratio float64
+		day                  bool
+		want                 float64
+	}{
+		// 白天 G = 0.1Rn
+		{"14-15h", 38, 52, 3.3, 2.450, 2.450 / 2.658, true, 0.63},
+		// 夜间 G = 0.5Rn，Rs/Rso 使用日落前的 0.8
+		{"02-03h", 28, 90, 1.9, 0, 0.8, false, 0.0},
+	}
+	for _, tt := range tests {
+		near(t, tt.name, hourlyET0(tt.t, tt.rh, tt.u2, tt.rs, tt.ratio, tt.day, 8), tt.want, 0.01)
+	}
+}
+
+func TestDaily(t *testing.T) {
+	// Example 18 中的 ea = 2.85kPa 由露点得到，这里换算为相同 ea 的相对湿度
+	rh18 := 2.85 / ((satVP(34.8) + satVP(25.6)) / 2) * 100
+	tests := []struct {
+		name                     string
+		tmax, tmin, rhmax, rhmin float64
+		u2, rs                   float64
+		lat, alt                 float64
+		j                        int
+		want                     float64
+	}{
+		// Example 17: 10m 高度风速 10km/h，Rs 22.07MJ/m²
+		{"Example 17", 21.5, 12.3, 84, 63, windAt2m(10/3.6, 10), 22.07, deg(50, 48), 100, 187, 3.9},
+		// Example 18: 原文按月数据计算 G = 0.14 得到 5.72，日步长按公式 (42) 取 G = 0，
+		// 用原文的中间结果重新计算为 5.75
+		{"Example 18", 34.8, 25.6, rh18, rh18, 2, 22.65, deg(13, 44), 2, 105, 5.75},
+	}
+	for _, tt := range tests {
+		got := dailyET0(tt.tmax, tt.tmin, tt.rhmax, tt.rhmin, tt.u2, tt.rs, tt.lat, tt.alt, tt.j)
+		near(t, tt.name, got, tt.want, 0.05)
+	}
+}
@@ -0,0 +1,41 @@
+// Package fileutil 状态文件的读写
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicWrite 先写入同目录下的临时文件并刷到存储，再改名为 path，最后同步目录，
+// 断电时 path 要么是旧内容要么是新内容，不会留下空文件或不完整的文件
+func AtomicWrite(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// 同步目录才能保证改名本身落盘，部分文件系统不支持对目录 fsync，忽略该错误
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
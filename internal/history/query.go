@@ -0,0 +1,199 @@
+package history
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"dataCollect/mqtt/command"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// 一次查询最多返回的点数，超过时需要缩小时间范围或增大 step
+	maxQueryPoints = 5000
+	// 没有指定 from 时默认查询最近 24 小时
+	defaultQueryRange = 24 * time.Hour
+)
+
+// Query 查询条件，from/to 为毫秒时间戳，包含 from 不包含 to
+type Query struct {
+	Field string `json:"field"`
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+	// raw 返回原始数据，avg/min/max/sum/count/last 按 step 分段统计
+	Agg  string `json:"agg"`
+	Step string `json:"step"`
+}
+
+// Point 查询结果中的一个点，格式为 [毫秒时间戳, 值]
+type Point [2]float64
+
+func registerCommands() {
+	command.Register("query_history", queryHistory)
+}
+
+// query_history: {"field":"temperature","from":1700000000000,"to":1700086400000,"agg":"avg","step":"1h"}
+func queryHistory(_ context.Context, req *command.Request) (interface{}, error) {
+	var q Query
+	if err := command.ParseParams(req.Params, &q); err != nil {
+		return nil, err
+	}
+	points, err := store.Query(&q)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"field":  q.Field,
+		"from":   q.From,
+		"to":     q.To,
+		"agg":    q.Agg,
+		"step":   q.Step,
+		"points": points,
+	}, nil
+}
+
+// Query 查询一个字段在时间范围内的数据。已经聚合的日期没有原始数据，
+// agg 为 raw 时按每段的平均值返回，时间为时间段起始。q 中未填写的条件会被设置为默认值
+func (s *Store) Query(q *Query) ([]Point, error) {
+	if q.Field == "" {
+		return nil, errors.New("field 不能为空")
+	}
+	if q.To <= 0 {
+		q.To = time.Now().UnixMilli()
+	}
+	if q.From <= 0 {
+		q.From = q.To - defaultQueryRange.Milliseconds()
+	}
+	if q.From >= q.To {
+		return nil, errors.New("from 必须早于 to")
+	}
+	if q.Agg == "" {
+		q.Agg = "raw"
+	}
+	var step int64
+	switch q.Agg {
+	case "raw":
+	case "avg", "min", "max", "sum", "count", "last":
+		if q.Step != "" {
+			d, err := time.ParseDuration(q.Step)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("step 格式错误: %q", q.Step)
+			}
+			step = d.Milliseconds()
+		}
+	default:
+		return nil, fmt.Errorf("不支持的 agg %q", q.Agg)
+	}
+
+	var points []Point
+	buckets := make(map[int64]*bucket)
+	// step 为 0 时整个时间范围统计为一个点
+	bucketOf := func(t int64) *bucket {
+		start := q.From
+		if step > 0 {
+			start += (t - q.From) / step * step
+		}
+		b, ok := buckets[start]
+		if !ok {
+			b = &bucket{min: math.Inf(1), max: math.Inf(-1)}
+			buckets[start] = b
+		}
+		return b
+	}
+	tooMany := func() bool { return len(points) > maxQueryPoints || len(buckets) > maxQueryPoints }
+
+	// 超过 retention 的数据已经删除，不用再逐天查找
+	earliest := time.Now().Add(-config.Get().History.Retention - 24*time.Hour).UnixMilli()
+	for _, day := range queryDays(max(q.From, earliest), q.To) {
+		raw := filepath.Join(s.dir, rawPrefix+day+fileExt)
+		err := readRaw(raw, func(rec rawRecord) {
+			v, ok := rec.V[q.Field]
+			if !ok || rec.T < q.From || rec.T >= q.To || tooMany() {
+				return
+			}
+			if q.Agg == "raw" {
+				points = append(points, Point{float64(rec.T), v})
+				return
+			}
+			bucketOf(rec.T).add(1, v, v, v, v)
+		})
+		if errors.Is(err, os.ErrNotExist) {
+			err = readAgg(filepath.Join(s.dir, aggPrefix+day+fileExt), func(rec aggRecord) {
+				n := rec.N[q.Field]
+				if n == 0 || rec.T < q.From || rec.T >= q.To || tooMany() {
+					return
+				}
+				if q.Agg == "raw" {
+					points = append(points, Point{float64(rec.T), rec.Sum[q.Field] / float64(n)})
+					return
+				}
+				bucketOf(rec.T).add(n, rec.Sum[q.Field], rec.Min[q.Field], rec.Max[q.Field], rec.Last[q.Field])
+			})
+		}
+		// 整理任务可能刚好删除或聚合了这一天的文件
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("读取 %s 的历史数据失败: %v", day, err)
+		}
+		if tooMany() {
+			return nil, fmt.Errorf("结果超过 %d 个点，请缩小时间范围或增大 step", maxQueryPoints)
+		}
+	}
+
+	if q.Agg == "raw" {
+		return points, nil
+	}
+	points = make([]Point, 0, len(buckets))
+	for t, b := range buckets {
+		points = append(points, Point{float64(t), b.value(q.Agg)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i][0] < points[j][0] })
+	return points, nil
+}
+
+// 查询范围覆盖的日期，按本地日期从早到晚
+func queryDays(from, to int64) []string {
+	var days []string
+	end := time.UnixMilli(to - 1).Format(dayLayout)
+	for t := time.UnixMilli(from); ; t = t.AddDate(0, 0, 1) {
+		day := t.Format(dayLayout)
+		days = append(days, day)
+		if day >= end {
+			return days
+		}
+	}
+}
+
+type bucket struct {
+	n             int64
+	sum, min, max float64
+	last          float64
+}
+
+func (b *bucket) add(n int64, sum, min, max, last float64) {
+	b.n += n
+	b.sum += sum
+	b.min = math.Min(b.min, min)
+	b.max = math.Max(b.max, max)
+	b.last = last
+}
+
+func (b *bucket) value(agg string) float64 {
+	switch agg {
+	case "min":
+		return b.min
+	case "max":
+		return b.max
+	case "sum":
+		return b.sum
+	case "count":
+		return float64(b.n)
+	case "last":
+		return b.last
+	}
+	return b.sum / float64(b.n)
+}
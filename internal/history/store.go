@@ -0,0 +1,429 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"dataCollect/internal/numeric"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 数据按天保存为 JSON Lines 文件，按本地日期命名：
+// raw-20060102.jsonl 每行一次采集的原始数据，超过 downsample_after 后聚合为 agg-20060102.jsonl，
+// 每行一个 downsample_step 时间段内各字段的统计值。文件只追加，断电最多丢失最后一行
+const (
+	rawPrefix = "raw-"
+	aggPrefix = "agg-"
+	fileExt   = ".jsonl"
+	dayLayout = "20060102"
+)
+
+// 一次采集的原始数据
+type rawRecord struct {
+	T int64              `json:"t"` // 毫秒时间戳
+	V map[string]float64 `json:"v"`
+}
+
+// 一个时间段内各字段的统计值
+type aggRecord struct {
+	T    int64              `json:"t"` // 时间段起始，毫秒时间戳
+	N    map[string]int64   `json:"n"`
+	Sum  map[string]float64 `json:"sum"`
+	Min  map[string]float64 `json:"min"`
+	Max  map[string]float64 `json:"max"`
+	Last map[string]float64 `json:"last"`
+}
+
+// Store 本地时序数据存储
+type Store struct {
+	mu      sync.Mutex
+	dir     string
+	day     string
+	file    *os.File
+	lastErr string
+}
+
+var (
+	store *Store
+	log   = initialize.Logger("history")
+)
+
+// 定期整理数据：聚合旧数据、按时间和大小清理
+const maintainInterval = time.Hour
+
+// Init 打开历史数据目录并启动整理任务，history.enabled 为 false 时不做任何事
+func Init(ctx context.Context) error {
+	conf := config.Get().History
+	if !conf.Enabled {
+		return nil
+	}
+	if err := os.MkdirAll(conf.Path, 0755); err != nil {
+		return fmt.Errorf("创建历史数据目录失败: %v", err)
+	}
+	store = &Store{dir: conf.Path}
+	registerCommands()
+	go func() {
+		store.Maintain()
+		ticker := time.NewTicker(maintainInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				store.Maintain()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	log.Infof("历史数据保存在 %s", conf.Path)
+	return nil
+}
+
+// Append 保存一次采集的数据，只保存数值类型的字段
+func Append(ts time.Time, values map[string]interface{}) {
+	if store == nil {
+		return
+	}
+	if err := store.Append(ts, values); err != nil {
+		// 存储写满等错误会在每个采集周期重复出现，只在错误变化时记录
+		store.mu.Lock()
+		if err.Error() != store.lastErr {
+			store.lastErr = err.Error()
+			log.Errorf("保存历史数据失败: %v", err)
+		}
+		store.mu.Unlock()
+	}
+}
+
+// Close 程序退出时关闭数据文件
+func Close() {
+	if store != nil {
+		store.Close()
+	}
+}
+
+func (s *Store) Append(ts time.Time, values map[string]interface{}) error {
+	rec := rawRecord{T: ts.UnixMilli(), V: make(map[string]float64, len(values))}
+	for k, v := range values {
+		// 开关量按 1/0 保存
+		if b, ok := v.(bool); ok {
+			rec.V[k] = 0
+			if b {
+				rec.V[k] = 1
+			}
+		} else if f, ok := numeric.ToFloat(v); ok {
+			rec.V[k] = f
+		}
+	}
+	if len(rec.V) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := ts.Format(dayLayout)
+	if s.file == nil || day != s.day {
+		if err := s.openDay(day); err != nil {
+			return err
+		}
+	}
+	// 采集间隔较长，不做缓存直接写入文件，避免断电丢失数据
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.lastErr = ""
+	return nil
+}
+
+func (s *Store) openDay(day string) error {
+	s.closeFile()
+	f, err := os.OpenFile(filepath.Join(s.dir, rawPrefix+day+fileExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file, s.day = f, day
+	return nil
+}
+
+func (s *Store) closeFile() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeFile()
+}
+
+// Maintain 把超过 downsample_after 的原始数据聚合，删除超过 retention 的数据，
+// 目录超过 max_size_mb 时从最早的文件开始删除。聚合在锁外进行，只在替换文件时加锁，不阻塞 Append
+func (s *Store) Maintain() {
+	conf := config.Get().History
+	now := time.Now()
+
+	files, err := s.listFiles()
+	if err != nil {
+		log.Errorf("读取历史数据目录失败: %v", err)
+		return
+	}
+	current := s.currentDay()
+	downsampleBefore := now.Add(-conf.DownsampleAfter).Format(dayLayout)
+	retainFrom := now.Add(-conf.Retention).Format(dayLayout)
+	for _, f := range files {
+		switch {
+		case f.day < retainFrom:
+			s.remove(f.path)
+		case f.raw && f.day < downsampleBefore && f.day != current:
+			dst := filepath.Join(s.dir, aggPrefix+f.day+fileExt)
+			tmp, err := downsample(f.path, dst, conf.DownsampleStep)
+			if err != nil {
+				log.Errorf("聚合 %s 失败: %v", f.path, err)
+				continue
+			}
+			s.mu.Lock()
+			// 聚合期间开始写这一天的文件时放弃本次聚合，下次整理时再处理
+			if f.day == s.day {
+				s.mu.Unlock()
+				os.Remove(tmp)
+				continue
+			}
+			if err := os.Rename(tmp, dst); err != nil {
+				s.mu.Unlock()
+				log.Errorf("聚合 %s 失败: %v", f.path, err)
+				os.Remove(tmp)
+				continue
+			}
+			s.remove(f.path)
+			s.mu.Unlock()
+		}
+	}
+
+	files, err = s.listFiles()
+	if err != nil {
+		return
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	limit := conf.MaxSizeMB * 1024 * 1024
+	current = s.currentDay()
+	for _, f := range files {
+		if total <= limit {
+			break
+		}
+		// 当前正在写的文件不删除
+		if f.raw && f.day == current {
+			continue
+		}
+		log.Warnf("历史数据超过 %d MB，删除 %s", conf.MaxSizeMB, f.path)
+		s.remove(f.path)
+		total -= f.size
+	}
+}
+
+// currentDay 正在写入的原始数据文件的日期
+func (s *Store) currentDay() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.day
+}
+
+func (s *Store) remove(path string) {
+	if err := os.Remove(path); err != nil {
+		log.Errorf("删除 %s 失败: %v", path, err)
+		return
+	}
+	log.Debugf("删除历史数据 %s", path)
+}
+
+type dataFile struct {
+	path string
+	day  string
+	raw  bool
+	size int64
+}
+
+// listFiles 按日期从早到晚返回数据文件
+func (s *Store) listFiles() ([]dataFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []dataFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		f := dataFile{path: filepath.Join(s.dir, name)}
+		switch {
+		case strings.HasPrefix(name, rawPrefix):
+			f.raw, f.day = true, strings.TrimSuffix(strings.TrimPrefix(name, rawPrefix), fileExt)
+		case strings.HasPrefix(name, aggPrefix):
+			f.day = strings.TrimSuffix(strings.TrimPrefix(name, aggPrefix), fileExt)
+		default:
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			f.size = info.Size()
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].day < files[j].day })
+	return files, nil
+}
+
+// downsample 把原始数据文件按 step 聚合，与 dst 中已有的聚合数据合并后写入临时文件，返回临时文件路径，
+// 由调用者改名为 dst。中途断电不会留下不完整的文件，同一天多次聚合也不会丢失之前的数据
+func downsample(src, dst string, step time.Duration) (string, error) {
+	buckets := make(map[int64]*aggRecord)
+	bucketOf := func(start int64) *aggRecord {
+		b, ok := buckets[start]
+		if !ok {
+			b = newAggRecord(start)
+			buckets[start] = b
+		}
+		return b
+	}
+	err := readAgg(dst, func(rec aggRecord) {
+		bucketOf(rec.T).merge(&rec)
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	err = readRaw(src, func(rec rawRecord) {
+		b := bucketOf(time.UnixMilli(rec.T).Truncate(step).UnixMilli())
+		for k, v := range rec.V {
+			b.add(k, v)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	starts := make([]int64, 0, len(buckets))
+	for t := range buckets {
+		starts = append(starts, t)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, t := range starts {
+		if err := enc.Encode(buckets[t]); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return "", err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	// 改名前刷到存储，断电时不会把原文件替换成空文件
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+func newAggRecord(t int64) *aggRecord {
+	return &aggRecord{
+		T:    t,
+		N:    make(map[string]int64),
+		Sum:  make(map[string]float64),
+		Min:  make(map[string]float64),
+		Max:  make(map[string]float64),
+		Last: make(map[string]float64),
+	}
+}
+
+func (a *aggRecord) add(k string, v float64) {
+	if a.N[k] == 0 {
+		a.Min[k], a.Max[k] = v, v
+	}
+	a.N[k]++
+	a.Sum[k] += v
+	a.Min[k] = math.Min(a.Min[k], v)
+	a.Max[k] = math.Max(a.Max[k], v)
+	a.Last[k] = v
+}
+
+// merge 合并同一时间段的另一份统计值，last 取 o 中的值
+func (a *aggRecord) merge(o *aggRecord) {
+	for k, n := range o.N {
+		if n == 0 {
+			continue
+		}
+		if a.N[k] == 0 {
+			a.Min[k], a.Max[k] = o.Min[k], o.Max[k]
+		}
+		a.N[k] += n
+		a.Sum[k] += o.Sum[k]
+		a.Min[k] = math.Min(a.Min[k], o.Min[k])
+		a.Max[k] = math.Max(a.Max[k], o.Max[k])
+		a.Last[k] = o.Last[k]
+	}
+}
+
+// readRaw 逐行读取原始数据，跳过断电等原因写坏的行
+func readRaw(path string, fn func(rawRecord)) error {
+	return readLines(path, func(line []byte) {
+		var rec rawRecord
+		if json.Unmarshal(line, &rec) == nil {
+			fn(rec)
+		}
+	})
+}
+
+func readAgg(path string, fn func(aggRecord)) error {
+	return readLines(path, func(line []byte) {
+		var rec aggRecord
+		if json.Unmarshal(line, &rec) == nil {
+			fn(rec)
+		}
+	})
+}
+
+func readLines(path string, fn func([]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+	return scanner.Err()
+}
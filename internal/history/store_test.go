@@ -0,0 +1,177 @@
+package history
+
+import (
+	"dataCollect/internal/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, maxSizeMB int64) *Store {
+	dir := t.TempDir()
+	config.Set(&config.Config{History: config.History{
+		Enabled:         true,
+		Path:            dir,
+		Retention:       30 * 24 * time.Hour,
+		MaxSizeMB:       maxSizeMB,
+		DownsampleAfter: 7 * 24 * time.Hour,
+		DownsampleStep:  5 * time.Minute,
+	}})
+	return &Store{dir: dir}
+}
+
+// 本地时间 daysAgo 天前的 12:00
+func noon(daysAgo int) time.Time {
+	y, m, d := time.Now().AddDate(0, 0, -daysAgo).Date()
+	return time.Date(y, m, d, 12, 0, 0, 0, time.Local)
+}
+
+func appendAll(t *testing.T, s *Store, start time.Time, minutes []int, values []float64) {
+	t.Helper()
+	for i, m := range minutes {
+		if err := s.Append(start.Add(time.Duration(m)*time.Minute), map[string]interface{}{"temperature": values[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func query(t *testing.T, s *Store, q Query) []Point {
+	t.Helper()
+	points, err := s.Query(&q)
+	if err != nil {
+		t.Fatalf("Query %+v: %v", q, err)
+	}
+	return points
+}
+
+func TestAppendQuery(t *testing.T) {
+	s := testStore(t, 50)
+	defer s.Close()
+	start := noon(1)
+	for i := 0; i < 10; i++ {
+		values := map[string]interface{}{"temperature": float64(i), "rain": i%2 == 0, "status": "ok"}
+		if err := s.Append(start.Add(time.Duration(i)*time.Minute), values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有数值字段时不写入
+	if err := s.Append(start.Add(time.Hour), map[string]interface{}{"status": "ok"}); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := start.UnixMilli(), start.Add(10*time.Minute).UnixMilli()
+	if points := query(t, s, Query{Field: "temperature", From: from, To: to}); len(points) != 10 || points[3] != (Point{float64(start.Add(3 * time.Minute).UnixMilli()), 3}) {
+		t.Errorf("raw %v", points)
+	}
+	// 包含 from 不包含 to
+	if points := query(t, s, Query{Field: "temperature", From: from + 1, To: to - 60000}); len(points) != 8 {
+		t.Errorf("范围内的点 %v", points)
+	}
+	if points := query(t, s, Query{Field: "rain", From: from, To: to, Agg: "sum"}); len(points) != 1 || points[0][1] != 5 {
+		t.Errorf("开关量 %v", points)
+	}
+	if points := query(t, s, Query{Field: "status", From: from, To: to}); len(points) != 0 {
+		t.Errorf("非数值字段 %v", points)
+	}
+
+	tests := []struct {
+		agg, step string
+		want      []float64
+	}{
+		{"avg", "5m", []float64{2, 7}},
+		{"min", "5m", []float64{0, 5}},
+		{"max", "", []float64{9}},
+		{"count", "", []float64{10}},
+		{"last", "5m", []float64{4, 9}},
+	}
+	for _, tt := range tests {
+		points := query(t, s, Query{Field: "temperature", From: from, To: to, Agg: tt.agg, Step: tt.step})
+		var got []float64
+		for _, p := range points {
+			got = append(got, p[1])
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s %s = %v, want %v", tt.agg, tt.step, got, tt.want)
+		}
+	}
+
+	for _, q := range []Query{
+		{From: from, To: to},
+		{Field: "temperature", From: to, To: from},
+		{Field: "temperature", From: from, To: to, Agg: "median"},
+		{Field: "temperature", From: from, To: to, Agg: "avg", Step: "0s"},
+	} {
+		if _, err := s.Query(&q); err == nil {
+			t.Errorf("Query %+v 应当返回错误", q)
+		}
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	s := testStore(t, 50)
+	old, mid, recent := noon(40), noon(10), noon(1)
+	appendAll(t, s, old, []int{0}, []float64{1})
+	appendAll(t, s, mid, []int{0, 1, 6}, []float64{10, 20, 40})
+	appendAll(t, s, recent, []int{0}, []float64{5})
+	s.Close()
+
+	// 正在写的文件不聚合
+	s.day = mid.Format(dayLayout)
+	s.Maintain()
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(s.dir, name))
+		return err == nil
+	}
+	day := func(t time.Time) string { return t.Format(dayLayout) + fileExt }
+	if exists(rawPrefix+day(old)) || !exists(rawPrefix+day(mid)) || exists(aggPrefix+day(mid)) {
+		t.Fatalf("正在写 %s 时整理结果错误", day(mid))
+	}
+
+	s.day = ""
+	s.Maintain()
+	if exists(rawPrefix+day(mid)) || !exists(aggPrefix+day(mid)) || !exists(rawPrefix+day(recent)) {
+		t.Fatal("聚合后的文件不正确")
+	}
+	from, to := mid.UnixMilli(), mid.Add(time.Hour).UnixMilli()
+	// 已聚合的数据按每段的平均值返回
+	want := []Point{{float64(from), 15}, {float64(mid.Add(5 * time.Minute).UnixMilli()), 40}}
+	if points := query(t, s, Query{Field: "temperature", From: from, To: to}); !slices.Equal(points, want) {
+		t.Errorf("聚合后 raw = %v, want %v", points, want)
+	}
+
+	// 同一天再次聚合时与之前的结果合并
+	appendAll(t, s, mid, []int{2}, []float64{60})
+	s.Close()
+	s.day = ""
+	s.Maintain()
+	for agg, want := range map[string]float64{"count": 4, "min": 10, "max": 60, "sum": 130} {
+		if points := query(t, s, Query{Field: "temperature", From: from, To: to, Agg: agg}); len(points) != 1 || points[0][1] != want {
+			t.Errorf("再次聚合后 %s = %v, want %v", agg, points, want)
+		}
+	}
+	if entries, _ := os.ReadDir(s.dir); len(entries) != 2 {
+		t.Errorf("目录中的文件 %v", entries)
+	}
+}
+
+func TestMaintainSizeLimit(t *testing.T) {
+	s := testStore(t, 1)
+	older, old, recent := noon(3), noon(2), noon(0)
+	appendAll(t, s, older, []int{0}, []float64{1})
+	appendAll(t, s, old, []int{0}, []float64{2})
+	appendAll(t, s, recent, []int{0}, []float64{3})
+	defer s.Close()
+	// 正在写的文件超过上限时也不删除
+	current := filepath.Join(s.dir, rawPrefix+recent.Format(dayLayout)+fileExt)
+	if err := os.WriteFile(current, make([]byte, 1024*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Maintain()
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(current) {
+		t.Errorf("超过大小后剩余 %v", entries)
+	}
+}
@@ -0,0 +1,25 @@
+// Package numeric 采集数据的数值转换
+package numeric
+
+import "math"
+
+// ToFloat 把采集到的数值转换为 float64，不是数值或为 NaN、Inf 时返回 false
+func ToFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, !math.IsNaN(n) && !math.IsInf(n, 0)
+	case float32:
+		return float64(n), !math.IsNaN(float64(n)) && !math.IsInf(float64(n), 0)
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// Round 保留 places 位小数
+func Round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
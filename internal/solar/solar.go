@@ -0,0 +1,202 @@
+// Package solar 对太阳辐照度按时间积分，统计每天的辐射量、日照时数和峰值辐照度
+package solar
+
+import (
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"dataCollect/internal/fileutil"
+	"dataCollect/internal/numeric"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// 当天的累计值保存到文件的间隔
+	saveInterval = 5 * time.Minute
+	dayLayout    = "20060102"
+)
+
+// 一个设备当天的累计值
+type dayState struct {
+	Day      string  `json:"day"`
+	Energy   float64 `json:"energy"`    // 辐射量 J/m²
+	Sunshine float64 `json:"sunshine"`  // 日照时长，秒
+	Covered  float64 `json:"covered"`   // 参与积分的时长，秒
+	Peak     float64 `json:"peak"`      // 峰值辐照度 W/m²
+	PeakTime int64   `json:"peak_time"` // 峰值出现的毫秒时间戳
+	// 上一次采集，与本次采集之间按梯形积分
+	LastT int64   `json:"last_t"`
+	LastV float64 `json:"last_v"`
+}
+
+var (
+	log      = initialize.Logger("solar")
+	mu       sync.Mutex
+	states   map[string]*dayState
+	lastSave time.Time
+	lastErr  string
+)
+
+// Update 累计一个设备的一次采集数据，并把当天的累计值加入 values：
+// solar_energy_today(辐射量) sunshine_today(日照时数 h) solar_peak_today(峰值 W/m²) solar_peak_time_today(峰值时间，毫秒时间戳)。
+// 日期变化时同时加入前一天的最终值 solar_energy_day sunshine_day solar_peak_day solar_peak_time_day solar_coverage_day(有数据的时间比例)
+func Update(id string, ts time.Time, values map[string]interface{}) {
+	conf := config.Get().Solar
+	if !conf.Enabled {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if states == nil {
+		states = load(conf.StateFile)
+	}
+	ds, ok := states[id]
+	if !ok {
+		ds = &dayState{}
+		states[id] = ds
+	}
+
+	t := ts.UnixMilli()
+	day := ts.Format(dayLayout)
+	v, ok := numeric.ToFloat(values[conf.Key])
+	// 夜间辐射传感器可能有少量负的零点偏移
+	v = max(v, 0)
+	finished := false
+	if ok && ds.LastT > 0 && t > ds.LastT && t-ds.LastT <= conf.MaxGap.Milliseconds() {
+		t0, v0 := ds.LastT, ds.LastV
+		// 跨过零点时按零点的插值拆分为两段，分别计入前一天和当天
+		if mid := nextMidnight(t0); t > mid {
+			vm := v0 + (v-v0)*float64(mid-t0)/float64(t-t0)
+			ds.integrate(&conf, t0, v0, mid, vm)
+			t0, v0 = mid, vm
+		}
+		finished = rollover(&conf, id, ds, day, values)
+		ds.integrate(&conf, t0, v0, t, v)
+	} else {
+		finished = rollover(&conf, id, ds, day, values)
+	}
+
+	if ok {
+		if v > ds.Peak || ds.PeakTime == 0 {
+			ds.Peak, ds.PeakTime = v, t
+		}
+		ds.LastT, ds.LastV = t, v
+	}
+	values["solar_energy_today"] = energy(&conf, ds.Energy)
+	values["sunshine_today"] = numeric.Round(ds.Sunshine/3600, 2)
+	if ds.PeakTime > 0 {
+		values["solar_peak_today"] = ds.Peak
+		values["solar_peak_time_today"] = ds.PeakTime
+	}
+
+	if finished || time.Since(lastSave) >= saveInterval {
+		save(conf.StateFile)
+	}
+}
+
+// Units 上报字段的单位，辐射量的单位由 solar.unit 决定
+func Units() map[string]string {
+	energy := config.Get().Solar.Unit + "/m²"
+	u := map[string]string{"sunshine_today": "h", "solar_peak_today": "W/m²", "solar_peak_time_today": "ms"}
+	u["solar_energy_today"], u["solar_energy_day"] = energy, energy
+	u["sunshine_day"], u["solar_peak_day"], u["solar_peak_time_day"] = "h", "W/m²", "ms"
+	return u
+}
+
+// Close 程序退出时保存当天的累计值
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if states != nil {
+		save(config.Get().Solar.StateFile)
+	}
+}
+
+// rollover 日期变化时把前一天的最终值加入 values 并清零
+func rollover(conf *config.Solar, id string, ds *dayState, day string, values map[string]interface{}) bool {
+	if ds.Day == day {
+		return false
+	}
+	prev := *ds
+	*ds = dayState{Day: day, LastT: prev.LastT, LastV: prev.LastV}
+	if prev.Day == "" {
+		return false
+	}
+	start, err := time.ParseInLocation(dayLayout, prev.Day, time.Local)
+	if err != nil {
+		return true
+	}
+	// 夏令时切换的日期不是 24 小时
+	length := start.AddDate(0, 0, 1).Sub(start).Seconds()
+	values["solar_energy_day"] = energy(conf, prev.Energy)
+	values["sunshine_day"] = numeric.Round(prev.Sunshine/3600, 2)
+	values["solar_coverage_day"] = numeric.Round(prev.Covered/length, 2)
+	if prev.PeakTime > 0 {
+		values["solar_peak_day"] = prev.Peak
+		values["solar_peak_time_day"] = prev.PeakTime
+	}
+	log.WithField("device", id).Infof("%s 辐射量 %v%s/m² 日照 %.2fh 峰值 %vW/m² 数据覆盖 %.0f%%",
+		prev.Day, energy(conf, prev.Energy), conf.Unit, prev.Sunshine/3600, prev.Peak, prev.Covered/length*100)
+	return true
+}
+
+// integrate 对 (t0,v0) 到 (t1,v1) 之间按梯形积分，日照时长按线性插值计算超过阈值的部分
+func (ds *dayState) integrate(conf *config.Solar, t0 int64, v0 float64, t1 int64, v1 float64) {
+	dt := float64(t1-t0) / 1000
+	ds.Energy += (v0 + v1) / 2 * dt
+	ds.Covered += dt
+	th := conf.Threshold
+	switch {
+	case v0 >= th && v1 >= th:
+		ds.Sunshine += dt
+	case v0 >= th:
+		ds.Sunshine += dt * (v0 - th) / (v0 - v1)
+	case v1 >= th:
+		ds.Sunshine += dt * (v1 - th) / (v1 - v0)
+	}
+}
+
+// 毫秒时间戳之后的下一个本地零点
+func nextMidnight(t int64) int64 {
+	tm := time.UnixMilli(t)
+	return time.Date(tm.Year(), tm.Month(), tm.Day()+1, 0, 0, 0, 0, tm.Location()).UnixMilli()
+}
+
+// 辐射量 J/m² 按配置的单位换算
+func energy(conf *config.Solar, j float64) float64 {
+	if conf.Unit == "kWh" {
+		return numeric.Round(j/3.6e6, 3)
+	}
+	return numeric.Round(j/1e6, 3)
+}
+
+func load(path string) map[string]*dayState {
+	s := make(map[string]*dayState)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("读取 %s 失败，重新开始累计: %v", path, err)
+	}
+	if s == nil {
+		s = make(map[string]*dayState)
+	}
+	return s
+}
+
+func save(path string) {
+	lastSave = time.Now()
+	data, err := json.Marshal(states)
+	if err == nil {
+		err = fileutil.AtomicWrite(path, data)
+	}
+	// 存储写满等错误会反复出现，只在错误变化时记录
+	if err != nil && err.Error() != lastErr {
+		lastErr = err.Error()
+		log.Warnf("保存 %s 失败: %v", path, err)
+	}
+}
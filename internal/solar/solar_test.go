@@ -0,0 +1,104 @@
+package solar
+
+import (
+	"dataCollect/internal/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+func TestUpdate(t *testing.T) {
+	day := func(d, h, m int) time.Time { return time.Date(2026, 6, d, h, m, 0, 0, time.Local) }
+	tests := []struct {
+		name    string
+		unit    string
+		samples []sample
+		// 最后一次 Update 之后 values 中应有的字段
+		want map[string]interface{}
+		// 最后一次 Update 之后 values 中不应有的字段
+		absent []string
+	}{
+		{
+			// (0+600)/2*60s = 18000J，超过 120W/m² 的时间按插值为 60*(600-120)/600 = 48s
+			name:    "trapezoid",
+			unit:    "MJ",
+			samples: []sample{{day(1, 10, 0), 0}, {day(1, 10, 1), 600}},
+			want:    map[string]interface{}{"solar_energy_today": 0.018, "sunshine_today": 0.01, "solar_peak_today": 600.0},
+			absent:  []string{"solar_energy_day"},
+		},
+		{
+			// 1000W/m² * 300s = 0.3MJ = 0.0833kWh
+			name:    "kWh",
+			unit:    "kWh",
+			samples: []sample{{day(1, 12, 0), 1000}, {day(1, 12, 5), 1000}},
+			want:    map[string]interface{}{"solar_energy_today": 0.083, "sunshine_today": 0.08},
+		},
+		{
+			// 间隔 10 分钟超过 max_gap，这段时间不积分
+			name:    "max gap",
+			unit:    "MJ",
+			samples: []sample{{day(1, 10, 0), 500}, {day(1, 10, 10), 500}, {day(1, 10, 11), 500}},
+			want:    map[string]interface{}{"solar_energy_today": 0.03, "sunshine_today": 0.02},
+		},
+		{
+			name:    "negative offset",
+			unit:    "MJ",
+			samples: []sample{{day(1, 2, 0), -5}, {day(1, 2, 1), -5}},
+			want:    map[string]interface{}{"solar_energy_today": 0.0, "sunshine_today": 0.0},
+		},
+		{
+			// 零点的插值为 200，前一天 (100+200)/2*60s = 9000J，当天 (200+300)/2*60s = 15000J
+			name:    "midnight split",
+			unit:    "MJ",
+			samples: []sample{{day(1, 23, 59), 100}, {day(2, 0, 1), 300}},
+			want: map[string]interface{}{
+				"solar_energy_day":   0.009,
+				"sunshine_day":       0.01,
+				"solar_peak_day":     100.0,
+				"solar_energy_today": 0.015,
+				"sunshine_today":     0.02,
+				"solar_peak_today":   300.0,
+			},
+		},
+		{
+			// 前一天最后一次采集与当天第一次间隔超过 max_gap，只结算前一天
+			name:    "midnight gap",
+			unit:    "MJ",
+			samples: []sample{{day(1, 23, 0), 100}, {day(1, 23, 1), 100}, {day(2, 0, 30), 300}},
+			want:    map[string]interface{}{"solar_energy_day": 0.006, "solar_energy_today": 0.0, "solar_peak_today": 300.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{Solar: config.Solar{
+				Enabled:   true,
+				Key:       "solarRadiation",
+				Unit:      tt.unit,
+				Threshold: 120,
+				MaxGap:    5 * time.Minute,
+				StateFile: filepath.Join(t.TempDir(), "solar.json"),
+			}})
+			states = nil
+			var values map[string]interface{}
+			for _, s := range tt.samples {
+				values = map[string]interface{}{"solarRadiation": s.v}
+				Update("1", s.t, values)
+			}
+			for key, want := range tt.want {
+				if values[key] != want {
+					t.Errorf("%s = %v, want %v", key, values[key], want)
+				}
+			}
+			for _, key := range tt.absent {
+				if v, ok := values[key]; ok {
+					t.Errorf("%s = %v, want absent", key, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package units 气象量的单位换算，换算系数均为定义值
+package units
+
+import (
+	"dataCollect/internal/numeric"
+	"fmt"
+	"strings"
+)
+
+// 可以换算的物理量
+const (
+	Speed         = "speed"
+	Temperature   = "temperature"
+	Precipitation = "precipitation"
+	Pressure      = "pressure"
+)
+
+// 每个单位所属的物理量以及换算到该物理量基准单位(m/s ℃ mm Pa)的方法
+type unit struct {
+	quantity string
+	toBase   func(float64) float64
+	fromBase func(float64) float64
+}
+
+func linear(factor float64) (func(float64) float64, func(float64) float64) {
+	return func(v float64) float64 { return v * factor }, func(v float64) float64 { return v / factor }
+}
+
+func newUnit(quantity string, factor float64) unit {
+	to, from := linear(factor)
+	return unit{quantity, to, from}
+}
+
+var table = map[string]unit{
+	"m/s":  newUnit(Speed, 1),
+	"km/h": newUnit(Speed, 1/3.6),
+	"kn":   newUnit(Speed, 1852.0/3600),
+	"mph":  newUnit(Speed, 1609.344/3600),
+	// 蒲福风级只能作为输出单位
+	"bft": {Speed, nil, beaufort},
+
+	"°C": newUnit(Temperature, 1),
+	"°F": {Temperature, func(v float64) float64 { return (v - 32) * 5 / 9 }, func(v float64) float64 { return v*9/5 + 32 }},
+	"K":  {Temperature, func(v float64) float64 { return v - 273.15 }, func(v float64) float64 { return v + 273.15 }},
+
+	"mm": newUnit(Precipitation, 1),
+	"in": newUnit(Precipitation, 25.4),
+
+	"Pa":   newUnit(Pressure, 1),
+	"hPa":  newUnit(Pressure, 100),
+	"kPa":  newUnit(Pressure, 1000),
+	"inHg": newUnit(Pressure, 3386.389),
+	"mmHg": newUnit(Pressure, 133.322387415),
+}
+
+// 单位的其他写法
+var aliases = map[string]string{
+	"kmh": "km/h", "kph": "km/h", "kt": "kn", "kts": "kn", "knot": "kn", "knots": "kn",
+	"beaufort": "bft", "c": "°C", "℃": "°C", "celsius": "°C", "f": "°F", "℉": "°F", "fahrenheit": "°F", "kelvin": "K",
+	"inch": "in", "inches": "in", "mbar": "hPa", "hpa": "hPa", "kpa": "kPa", "pa": "Pa", "inhg": "inHg", "mmhg": "mmHg",
+	"w/m2": "W/m²",
+}
+
+// Presets 预设的单位制，metric 不做换算
+var Presets = map[string]map[string]string{
+	"metric":   {},
+	"imperial": {Speed: "mph", Temperature: "°F", Precipitation: "in", Pressure: "inHg"},
+}
+
+// Normalize 返回单位的标准写法，不认识的单位原样返回
+func Normalize(u string) string {
+	if _, ok := table[u]; ok {
+		return u
+	}
+	if n, ok := aliases[strings.ToLower(u)]; ok {
+		return n
+	}
+	return u
+}
+
+// Quantity 返回单位所属的物理量，不能换算的单位(%、°、W/m² 等)返回空
+func Quantity(u string) string {
+	return table[Normalize(u)].quantity
+}
+
+// Valid 检查 u 能否作为 quantity 的输出单位
+func Valid(quantity, u string) bool {
+	return Quantity(u) == quantity
+}
+
+// Convert 把 from 单位的值换算为 to 单位
+func Convert(v float64, from, to string) (float64, error) {
+	f, t := table[Normalize(from)], table[Normalize(to)]
+	if f.quantity == "" || f.quantity != t.quantity {
+		return 0, fmt.Errorf("不能从 %s 换算为 %s", from, to)
+	}
+	if f.toBase == nil {
+		return 0, fmt.Errorf("%s 不能作为源单位", from)
+	}
+	return t.fromBase(f.toBase(v)), nil
+}
+
+// Field 读取 values 中 key 字段的数值，并从 src 中该字段的单位换算为 to，没有单位时视为已经是 to。
+// 字段缺失、不是数值或不能换算时返回 false
+func Field(values map[string]interface{}, src map[string]string, key, to string) (float64, bool) {
+	v, ok := numeric.ToFloat(values[key])
+	if !ok || src[key] == "" {
+		return v, ok
+	}
+	v, err := Convert(v, src[key], to)
+	return v, err == nil
+}
+
+// Target 按物理量返回输出单位，targets 中没有该物理量时保持原单位
+func Target(from string, targets map[string]string) string {
+	if to, ok := targets[Quantity(from)]; ok {
+		return Normalize(to)
+	}
+	return Normalize(from)
+}
+
+// 蒲福风级各级风速的上限(m/s)
+var beaufortLimits = []float64{0.3, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+
+func beaufort(v float64) float64 {
+	for i, limit := range beaufortLimits {
+		if v < limit {
+			return float64(i)
+		}
+	}
+	return 12
+}
+
+// Round 换算后保留 3 位小数，去掉浮点误差
+func Round(v float64) float64 {
+	return numeric.Round(v, 3)
+}
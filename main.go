@@ -1,24 +1,41 @@
 package main
 
 import (
+	"context"
 	"dataCollect/initialize"
 	"dataCollect/initialize/croninit"
 	modbus "dataCollect/internal/Modbus"
+	"dataCollect/internal/config"
+	"dataCollect/internal/et0"
+	"dataCollect/internal/history"
+	"dataCollect/internal/solar"
 	mqttapp "dataCollect/mqtt"
 	"dataCollect/mqtt/publish"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	// 第一个参数不是 - 开头时按子命令处理
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// 1. 定义命令行参数
 	var configPath string
-	flag.StringVar(&configPath, "config", "./configs/conf.yml", "Path to config file")
+	flag.StringVar(&configPath, "config", defaultConfigPath, "Path to config file")
+	flag.Usage = printUsage
 	flag.Parse()
 
+	// 根 context，收到 SIGINT 或 SIGTERM(OpenWrt procd 停止服务时发送) 时取消
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	initialize.ViperInit(configPath)
 	initialize.LogInIt()
 	croninit.CronInit()
@@ -26,19 +43,47 @@ func main() {
 	if err != nil {
 		logrus.Fatal(err)
 	}
-	publish.CreateMqttClient()
+	// 连接 broker 期间收到退出信号时直接退出
+	err = publish.CreateMqttClient(ctx)
 	if err != nil {
-		logrus.Fatal(err)
+		logrus.Println("dataCollect exiting: ", err)
+		return
+	}
+	initialize.RedisInit(ctx)
+	if err := history.Init(ctx); err != nil {
+		logrus.Errorf("历史数据不可用: %v", err)
 	}
-	initialize.RedisInit()
-	modbus.ModbusInit()
+	modbus.ModbusInit(ctx)
+	// 配置文件变化或收到 SIGHUP 时热加载配置
+	initialize.WatchConfig(configPath)
 
+	<-ctx.Done()
 	gracefulShutdown()
 }
 
+// gracefulShutdown 按固定顺序退出：停止采集、清空发布队列、上报离线、断开 mqtt、关闭串口和 redis。
+// 所有步骤共用 shutdown_timeout，超时后剩余步骤仍会执行，但不再等待
 func gracefulShutdown() {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	logrus.Println("dataCollect shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), config.Get().ShutdownTimeout)
+	defer cancel()
+
+	croninit.CronStop()
+	if err := modbus.Wait(ctx); err != nil {
+		logrus.Warnf("等待采集循环退出超时: %v", err)
+	}
+	if err := publish.Drain(ctx); err != nil {
+		logrus.Warnf("清空发布队列失败: %v", err)
+	}
+	if err := modbus.PublishOffline(ctx); err != nil {
+		logrus.Warnf("上报离线状态失败: %v", err)
+	}
+	publish.Disconnect()
+	modbus.Close()
+	history.Close()
+	et0.Close()
+	solar.Close()
+	initialize.RedisClose()
 	logrus.Println("dataCollect exiting")
+	initialize.CloseLog()
 }
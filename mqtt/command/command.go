@@ -0,0 +1,130 @@
+package command
+
+import (
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/mqtt/publish"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// 平台下发的命令：主题 devices/command/{cfgID}/{mac}/{message_id}，
+// 处理结果发到 devices/command/response/{cfgID}/{mac}/{message_id}
+type request struct {
+	Method    string          `json:"method"`
+	Params    json.RawMessage `json:"params"`
+	SubDevice string          `json:"sub_device"` // 网关模式下命令发给的子设备
+}
+
+type response struct {
+	Method    string      `json:"method"`
+	SubDevice string      `json:"sub_device,omitempty"`
+	Result    int         `json:"result"` // 0 成功 1 失败
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	Ts        int64       `json:"ts"`
+}
+
+// Request 传给命令处理函数的上下文，Publish 用于在最终结果之前向响应主题发送分片等中间数据
+type Request struct {
+	MessageID string
+	Params    json.RawMessage
+	// 网关模式下命令指定的子设备编号，为空表示网关本身，由处理函数自行查找对应的设备
+	SubDevice string
+	Publish   func(ctx context.Context, payload []byte) error
+}
+
+// Handler 处理一条命令，返回值作为响应的 data 字段
+type Handler func(ctx context.Context, req *Request) (interface{}, error)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]Handler)
+
+	log = initialize.Logger("mqtt")
+)
+
+// Register 注册命令处理函数，method 重复时后注册的覆盖先注册的
+func Register(method string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[method] = h
+}
+
+// Start 订阅命令主题，topic 为不含 message_id 的命令主题前缀
+func Start(ctx context.Context, topic, responseTopic string) error {
+	registerLogCommands()
+	return publish.Subscribe(topic+"/+", func(_ mqtt.Client, msg mqtt.Message) {
+		messageID := msg.Topic()[strings.LastIndex(msg.Topic(), "/")+1:]
+		payload := msg.Payload()
+		// 不能阻塞 paho 的消息回调，耗时的命令(如上传日志)放到单独的协程
+		go handle(ctx, messageID, responseTopic+"/"+messageID, payload)
+	})
+}
+
+func handle(ctx context.Context, messageID, responseTopic string, payload []byte) {
+	var req request
+	resp := response{Result: 1}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		resp.Message = fmt.Sprintf("解析命令失败: %v", err)
+		reply(ctx, responseTopic, &resp)
+		return
+	}
+	resp.Method = req.Method
+	resp.SubDevice = req.SubDevice
+	handlersMu.RLock()
+	h, ok := handlers[req.Method]
+	handlersMu.RUnlock()
+	if !ok {
+		resp.Message = fmt.Sprintf("不支持的命令 %q", req.Method)
+		reply(ctx, responseTopic, &resp)
+		return
+	}
+
+	log.WithField("topic", responseTopic).Infof("收到命令 %s: %s", req.Method, req.Params)
+	data, err := h(ctx, &Request{
+		MessageID: messageID,
+		Params:    req.Params,
+		SubDevice: req.SubDevice,
+		Publish: func(ctx context.Context, payload []byte) error {
+			return publish.PublishSync(ctx, responseTopic, payload)
+		},
+	})
+	if err != nil {
+		resp.Message = err.Error()
+		log.WithField("topic", responseTopic).WithError(err).Errorf("执行命令 %s 失败", req.Method)
+	} else {
+		resp.Result = 0
+		resp.Message = "success"
+		resp.Data = data
+	}
+	reply(ctx, responseTopic, &resp)
+}
+
+func reply(ctx context.Context, topic string, resp *response) {
+	resp.Ts = time.Now().UnixMilli()
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.WithField("topic", topic).WithError(err).Error("序列化命令响应失败")
+		return
+	}
+	if err := publish.PublishSync(ctx, topic, payload); err != nil {
+		log.WithField("topic", topic).WithError(err).Error("发送命令响应失败")
+	}
+}
+
+// ParseParams 把命令参数解析到 v，参数为空时保持 v 的默认值
+func ParseParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("命令参数错误: %v", err)
+	}
+	return nil
+}
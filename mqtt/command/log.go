@@ -0,0 +1,282 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	// 默认上传最近的日志行数
+	defaultLogLines = 200
+
+	defaultChunkSize = 32 * 1024
+	maxChunkSize     = 128 * 1024
+	defaultMaxBytes  = 512 * 1024
+	// 一次最多上传的日志大小(压缩前)，4G 流量和 broker 都有限制
+	maxUploadBytes = 4 * 1024 * 1024
+)
+
+func registerLogCommands() {
+	Register("set_log_level", setLogLevel)
+	Register("reset_log_level", resetLogLevel)
+	Register("get_log_level", func(context.Context, *Request) (interface{}, error) {
+		return initialize.LogLevelStatus(), nil
+	})
+	Register("upload_log", uploadLog)
+}
+
+// set_log_level: {"level":"debug","module":"mqtt","minutes":30}，module 为空表示全局，
+// minutes 为 0 或不填时不自动恢复
+func setLogLevel(_ context.Context, req *Request) (interface{}, error) {
+	var params struct {
+		Level   string `json:"level"`
+		Module  string `json:"module"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := ParseParams(req.Params, &params); err != nil {
+		return nil, err
+	}
+	d := time.Duration(params.Minutes) * time.Minute
+	if err := initialize.OverrideLogLevel(params.Module, params.Level, d); err != nil {
+		return nil, err
+	}
+	return initialize.LogLevelStatus(), nil
+}
+
+// reset_log_level: {"module":"mqtt"}，立即恢复配置文件中的级别
+func resetLogLevel(_ context.Context, req *Request) (interface{}, error) {
+	var params struct {
+		Module string `json:"module"`
+	}
+	if err := ParseParams(req.Params, &params); err != nil {
+		return nil, err
+	}
+	initialize.ResetLogLevel(params.Module)
+	return initialize.LogLevelStatus(), nil
+}
+
+type uploadParams struct {
+	Lines     int    `json:"lines"`
+	Since     string `json:"since"` // 2006-01-02 15:04:05，本地时间
+	Until     string `json:"until"`
+	ChunkSize int    `json:"chunk_size"`
+	MaxBytes  int    `json:"max_bytes"`
+}
+
+// 日志分片，data 为 gzip 压缩后再 base64 编码的一段数据，按 chunk 顺序拼接后解压
+type logChunk struct {
+	Method    string `json:"method"`
+	MessageID string `json:"message_id"`
+	Chunk     int    `json:"chunk"`
+	Total     int    `json:"total"`
+	Encoding  string `json:"encoding"`
+	Data      string `json:"data"`
+}
+
+// upload_log: 按行数或时间范围读取日志，压缩后分片发送到响应主题，最后发送汇总结果
+func uploadLog(ctx context.Context, req *Request) (interface{}, error) {
+	var params uploadParams
+	if err := ParseParams(req.Params, &params); err != nil {
+		return nil, err
+	}
+	var since, until time.Time
+	var err error
+	if params.Since != "" {
+		if since, err = time.ParseInLocation(time.DateTime, params.Since, time.Local); err != nil {
+			return nil, fmt.Errorf("since 格式错误: %v", err)
+		}
+	}
+	if params.Until != "" {
+		if until, err = time.ParseInLocation(time.DateTime, params.Until, time.Local); err != nil {
+			return nil, fmt.Errorf("until 格式错误: %v", err)
+		}
+	}
+	if params.Lines <= 0 && since.IsZero() && until.IsZero() {
+		params.Lines = defaultLogLines
+	}
+	if params.ChunkSize <= 0 {
+		params.ChunkSize = defaultChunkSize
+	}
+	params.ChunkSize = min(params.ChunkSize, maxChunkSize)
+	if params.MaxBytes <= 0 {
+		params.MaxBytes = defaultMaxBytes
+	}
+	params.MaxBytes = min(params.MaxBytes, maxUploadBytes)
+
+	conf := config.Get().Log
+	if conf.AdapterType == 0 {
+		return nil, errors.New("未开启文件日志(log.adapter_type 为 0)，没有可上传的日志")
+	}
+	lines, files, size, truncated, err := readLogLines(conf.Path, since, until, params.Lines, params.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, line := range lines {
+		zw.Write(line)
+		zw.Write([]byte{'\n'})
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	total := (len(data) + params.ChunkSize - 1) / params.ChunkSize
+	for i := 0; i < total; i++ {
+		end := min((i+1)*params.ChunkSize, len(data))
+		payload, _ := json.Marshal(logChunk{
+			Method:    "upload_log",
+			MessageID: req.MessageID,
+			Chunk:     i + 1,
+			Total:     total,
+			Encoding:  "gzip+base64",
+			Data:      base64.StdEncoding.EncodeToString(data[i*params.ChunkSize : end]),
+		})
+		if err := req.Publish(ctx, payload); err != nil {
+			return nil, fmt.Errorf("发送第 %d/%d 个分片失败: %v", i+1, total, err)
+		}
+	}
+	return map[string]interface{}{
+		"files":      files,
+		"lines":      len(lines),
+		"bytes":      size,
+		"compressed": len(data),
+		"chunks":     total,
+		"truncated":  truncated,
+	}, nil
+}
+
+// 日志时间格式，见 initialize 中的 customFormatter 和 newJSONFormatter
+const logTimeLayout = "2006-01-02 15:04:05.9999"
+
+// 文本格式的时间在级别之后的方括号中，只匹配行首，避免匹配到消息中的时间
+var logTimeRe = regexp.MustCompile(`^[A-Z]+ *\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?)\]`)
+
+// lineTime 返回日志行的时间，json 格式按 time 字段解析(字段按名称排序，msg 在 time 之前)
+func lineTime(line []byte) (time.Time, bool) {
+	var ts string
+	if len(line) > 0 && line[0] == '{' {
+		var entry struct {
+			Time string `json:"time"`
+		}
+		if json.Unmarshal(line, &entry) != nil {
+			return time.Time{}, false
+		}
+		ts = entry.Time
+	} else if m := logTimeRe.FindSubmatch(line); m != nil {
+		ts = string(m[1])
+	} else {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(logTimeLayout, ts, time.Local)
+	return t, err == nil
+}
+
+// tailBuffer 保留最后 limit 行(0 不限制)且总大小不超过 maxBytes 的日志行，超过大小时丢弃最早的
+type tailBuffer struct {
+	lines     [][]byte
+	size      int
+	limit     int
+	maxBytes  int
+	truncated bool
+}
+
+func (b *tailBuffer) add(line []byte) {
+	b.lines = append(b.lines, bytes.Clone(line))
+	b.size += len(line) + 1
+	for len(b.lines) > 0 && (b.size > b.maxBytes || b.limit > 0 && len(b.lines) > b.limit) {
+		if b.size > b.maxBytes {
+			b.truncated = true
+		}
+		b.size -= len(b.lines[0]) + 1
+		b.lines[0] = nil
+		b.lines = b.lines[1:]
+	}
+}
+
+// readLogLines 按时间顺序返回日志目录中 [since, until] 范围内的日志行，
+// limit 大于 0 时只保留最后 limit 行，总大小(每行加换行符)不超过 maxBytes，超过时丢弃最早的日志并返回 truncated。
+// 从最新的文件往前逐行读取，够 limit 行或达到大小限制后不再读更早的文件。没有时间戳的行(如 panic 堆栈)跟随上一行
+func readLogLines(dir string, since, until time.Time, limit, maxBytes int) (lines [][]byte, used, size int, truncated bool, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, 0, false, fmt.Errorf("读取日志目录失败: %v", err)
+	}
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || filepath.Ext(entry.Name()) != ".log" {
+			continue
+		}
+		// 最后修改时间早于 since 的文件里不会有需要的日志
+		if !since.IsZero() && info.ModTime().Before(since) {
+			continue
+		}
+		files = append(files, logFile{filepath.Join(dir, entry.Name()), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].path < files[j].path
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for i := len(files) - 1; i >= 0; i-- {
+		if truncated || limit > 0 && len(lines) >= limit {
+			break
+		}
+		buf := &tailBuffer{maxBytes: maxBytes - size}
+		if limit > 0 {
+			buf.limit = limit - len(lines)
+		}
+		if err := filterLogFile(files[i].path, since, until, buf); err != nil {
+			return nil, 0, 0, false, err
+		}
+		if len(buf.lines) > 0 {
+			used++
+		}
+		lines = append(buf.lines, lines...)
+		size += buf.size
+		truncated = buf.truncated
+	}
+	return lines, used, size, truncated, nil
+}
+
+func filterLogFile(path string, since, until time.Time, buf *tailBuffer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	keep := true
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if t, ok := lineTime(line); ok {
+			keep = (since.IsZero() || !t.Before(since)) && (until.IsZero() || !t.After(until))
+		}
+		if keep {
+			buf.add(line)
+		}
+	}
+	return scanner.Err()
+}
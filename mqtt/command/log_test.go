@@ -0,0 +1,41 @@
+package command
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineTime(t *testing.T) {
+	want := time.Date(2026, 10, 19, 14, 42, 36, 600200000, time.Local)
+	tests := []struct {
+		name string
+		line string
+		ok   bool
+	}{
+		{"text", `INFO  [2026-10-19 14:42:36.6002] [initialize/redis_init.go:80] 连接redis成功 addr=127.0.0.1:6379`, true},
+		{"text message time", `ERROR [2026-10-19 14:42:36.6002] [command/log.go:1] since 2020-01-01 00:00:00 之后没有日志`, true},
+		// json 的字段按名称排序，msg 中的时间在 time 字段之前
+		{"json", `{"file":"command/log.go:1","level":"info","msg":"since 2020-01-01 00:00:00","time":"2026-10-19 14:42:36.6002"}`, true},
+		{"stack", `goroutine 1 [running]: 2020-01-01 00:00:00`, false},
+		{"continuation", `	/root/module/main.go:42 +0x1d`, false},
+		{"bad json", `{"msg":"2026-10-19 14:42:36.6002"`, false},
+	}
+	for _, tt := range tests {
+		got, ok := lineTime([]byte(tt.line))
+		if ok != tt.ok || ok && !got.Equal(want) {
+			t.Errorf("%s: lineTime = %v %v, want %v %v", tt.name, got, ok, want, tt.ok)
+		}
+	}
+}
+
+// 只输出到控制台时没有日志文件
+func TestUploadLogConsoleOnly(t *testing.T) {
+	config.Set(&config.Config{Log: config.Log{AdapterType: 0, Path: t.TempDir()}})
+	_, err := uploadLog(context.Background(), &Request{MessageID: "1"})
+	if err == nil || !strings.Contains(err.Error(), "未开启文件日志") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -1,71 +1,185 @@
 package publish
 
 import (
-	config "dataCollect/mqtt"
+	"context"
+	"dataCollect/initialize"
+	"dataCollect/internal/config"
 	"fmt"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/sirupsen/logrus"
 )
 
-var mqttClient mqtt.Client
+var (
+	mqttClient mqtt.Client
+	// 当前连接使用的配置，热加载时比较连接参数是否变化
+	connected config.Mqtt
+	clientMu  sync.RWMutex
+	// 程序的根 context，退出时取消，用于结束重连等待
+	appCtx = context.Background()
 
-func CreateMqttClient() {
-	// 初始化配置
+	log = initialize.Logger("mqtt")
+
+	// 已订阅的主题，连接或重连成功后重新订阅
+	subsMu sync.Mutex
+	subs   = make(map[string]mqtt.MessageHandler)
+)
+
+const (
+	// 发布消息等待 broker 确认的超时时间
+	publishTimeout = 10 * time.Second
+	// 热加载时连接新 broker 的超时时间，超时后继续使用旧连接
+	connectTimeout = 10 * time.Second
+)
+
+func CreateMqttClient(ctx context.Context) error {
+	appCtx = ctx
+	if err := connectMqtt(ctx); err != nil {
+		return err
+	}
+	startWorkers()
+	initialize.RegisterReloader(initialize.Reloader{
+		Name:  "mqtt",
+		Keys:  []string{"mqtt"},
+		Apply: reloadMqtt,
+	})
+	return nil
+}
+
+// connectMqtt 连接 broker，失败时每 5 秒重试一次，直到连接成功或 ctx 取消
+func connectMqtt(ctx context.Context) error {
+	conf := config.Get().Mqtt
+	client := newClient(conf)
+	for {
+		if token := client.Connect(); token.Wait() && token.Error() != nil {
+			log.WithField("broker", conf.Broker).WithError(token.Error()).Error("MQTT Broker 1 连接失败")
+			select {
+			case <-time.After(5 * time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		break
+	}
+	clientMu.Lock()
+	mqttClient, connected = client, conf
+	clientMu.Unlock()
+	return nil
+}
+
+func newClient(conf config.Mqtt) mqtt.Client {
+	// 连接和回调都使用这一份配置，热加载不会修改它
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(config.MqttConfig.Broker)
-	opts.SetUsername(config.MqttConfig.User)
-	opts.SetPassword(config.MqttConfig.Pass)
+	opts.AddBroker(conf.Broker)
+	opts.SetUsername(conf.User)
+	opts.SetPassword(conf.Pass)
 	opts.SetClientID("weather-Station")
 	// 干净会话
 	opts.SetCleanSession(true)
 	// 恢复客户端订阅，需要broker支持
 	opts.SetResumeSubs(true)
-	// 自动重连
+	// 自动重连，断开后由客户端自己重连，Disconnect 之后不再重连
 	opts.SetAutoReconnect(true)
+	opts.SetConnectTimeout(connectTimeout)
 	opts.SetConnectRetryInterval(5 * time.Second)
 	opts.SetMaxReconnectInterval(20 * time.Second)
 	// 消息顺序
 	opts.SetOrderMatters(false)
-	opts.SetOnConnectHandler(func(_ mqtt.Client) {
-		logrus.Debug("mqtt connect success")
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.WithField("broker", conf.Broker).Debug("mqtt connect success")
+		resubscribe(client)
 	})
-	// 断线重连
-	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
-		logrus.Error("mqtt connect  lost: ", err)
-		mqttClient.Disconnect(250)
-		// 等待连接成功，失败重新连接
-		for {
-			token := mqttClient.Connect()
-			if token.Wait() && token.Error() == nil {
-				fmt.Println("Reconnected to MQTT broker")
-				break
-			}
-			fmt.Printf("Reconnect failed: %v\n", token.Error())
-			time.Sleep(5 * time.Second)
-		}
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.WithField("broker", conf.Broker).WithError(err).Error("mqtt connect lost")
 	})
+	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
+		log.WithField("broker", conf.Broker).Debug("mqtt reconnecting")
+	})
+	return mqtt.NewClient(opts)
+}
 
-	mqttClient = mqtt.NewClient(opts)
-	for {
-		if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-			logrus.Error("MQTT Broker 1 连接失败:", token.Error())
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		break
+// 配置热加载：只有连接参数发生变化时才重新连接 broker。
+// 新连接成功后才替换旧连接，连接失败时返回错误并继续使用旧连接
+func reloadMqtt(changed []string) error {
+	cur := config.Get().Mqtt
+	clientMu.RLock()
+	old, oldClient := connected, mqttClient
+	clientMu.RUnlock()
+	if old.Broker == cur.Broker && old.User == cur.User && old.Pass == cur.Pass {
+		return nil
 	}
+	log.Infof("mqtt 连接参数变化，重新连接 broker %s", cur.Broker)
+	client := newClient(cur)
+	token := client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		client.Disconnect(0)
+		return fmt.Errorf("连接 broker %s 超时，继续使用 %s", cur.Broker, old.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("连接 broker %s 失败，继续使用 %s: %w", cur.Broker, old.Broker, err)
+	}
+	clientMu.Lock()
+	mqttClient, connected = client, cur
+	clientMu.Unlock()
+	// 新旧连接使用相同的 ClientID，连接同一个 broker 时旧连接会被踢下线，
+	// 立即断开旧连接，避免它自动重连后再把新连接踢下线
+	oldClient.Disconnect(250)
+	return nil
 }
 
-// 上报telemetry消息
-func PublishMessage(topic string, payload []byte) error {
-	qos := byte(config.MqttConfig.Telemetry.QoS)
-	logrus.Info("topic:", topic, "value:", string(payload))
+// PublishSync 直接发布消息并等待 broker 确认，不经过发布队列
+func PublishSync(ctx context.Context, topic string, payload []byte) error {
+	qos := byte(config.Get().Mqtt.Telemetry.QoS)
+	log.WithField("topic", topic).Info("value:", string(payload))
 	// 发布消息
-	token := mqttClient.Publish(topic, qos, false, payload)
-	if token.Wait() && token.Error() != nil {
-		logrus.Error(token.Error())
+	clientMu.RLock()
+	client := mqttClient
+	clientMu.RUnlock()
+	token := client.Publish(topic, qos, false, payload)
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(publishTimeout):
+		return fmt.Errorf("发布消息超时: %s", topic)
+	}
+	return token.Error()
+}
+
+// Disconnect 断开与 broker 的连接
+func Disconnect() {
+	clientMu.RLock()
+	client := mqttClient
+	clientMu.RUnlock()
+	if client != nil {
+		client.Disconnect(250)
+	}
+}
+
+// Subscribe 订阅主题，使用干净会话，断线重连或更换 broker 后会自动重新订阅
+func Subscribe(topic string, handler mqtt.MessageHandler) error {
+	subsMu.Lock()
+	subs[topic] = handler
+	subsMu.Unlock()
+
+	clientMu.RLock()
+	client := mqttClient
+	clientMu.RUnlock()
+	token := client.Subscribe(topic, 1, handler)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("订阅主题超时: %s", topic)
 	}
 	return token.Error()
 }
+
+// 在连接回调中执行，不能等待 token 完成
+func resubscribe(client mqtt.Client) {
+	subsMu.Lock()
+	defer subsMu.Unlock()
+	for topic, handler := range subs {
+		client.Subscribe(topic, 1, handler)
+		log.WithField("topic", topic).Debug("重新订阅主题")
+	}
+}
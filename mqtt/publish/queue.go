@@ -0,0 +1,87 @@
+package publish
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"errors"
+	"sync"
+)
+
+// 待发布的消息先进入队列，由 write_workers 个协程发送，队列长度为 channel_buffer_size
+type message struct {
+	topic   string
+	payload []byte
+}
+
+var (
+	queue     chan message
+	queueMu   sync.RWMutex
+	closed    bool
+	workersWg sync.WaitGroup
+	// Drain 开始时关闭，唤醒因队列已满而阻塞的发布，让 Drain 能拿到写锁
+	stop     chan struct{}
+	stopOnce sync.Once
+)
+
+// ErrQueueClosed 程序退出时发布队列已关闭
+var ErrQueueClosed = errors.New("发布队列已关闭")
+
+func startWorkers() {
+	conf := config.Get().Mqtt
+	queue = make(chan message, conf.ChannelBufferSize)
+	stop = make(chan struct{})
+	for i := 0; i < conf.WriteWorkers; i++ {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			for msg := range queue {
+				if err := PublishSync(context.Background(), msg.topic, msg.payload); err != nil {
+					log.WithField("topic", msg.topic).WithError(err).Error("发布消息失败")
+				}
+			}
+		}()
+	}
+}
+
+// 上报telemetry消息，队列满时阻塞直到 ctx 取消或开始退出
+func PublishMessage(ctx context.Context, topic string, payload []byte) error {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if closed || queue == nil {
+		return ErrQueueClosed
+	}
+	select {
+	case queue <- message{topic: topic, payload: payload}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stop:
+		return ErrQueueClosed
+	}
+}
+
+// Drain 关闭发布队列并等待已入队的消息发送完成，ctx 超时后放弃剩余消息
+func Drain(ctx context.Context) error {
+	if stop != nil {
+		stopOnce.Do(func() { close(stop) })
+	}
+	queueMu.Lock()
+	if !closed && queue != nil {
+		close(queue)
+	}
+	closed = true
+	queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workersWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		log.Warnf("发布队列未能在超时前清空，放弃剩余 %d 条消息", len(queue))
+		return ctx.Err()
+	}
+}
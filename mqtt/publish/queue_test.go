@@ -0,0 +1,39 @@
+package publish
+
+import (
+	"context"
+	"dataCollect/internal/config"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 队列已满时阻塞的发布不能妨碍 Drain 关闭队列
+func TestDrainWithBlockedPublish(t *testing.T) {
+	config.Set(&config.Config{Mqtt: config.Mqtt{ChannelBufferSize: 1}})
+	startWorkers()
+	ctx := context.Background()
+	if err := PublishMessage(ctx, "t", nil); err != nil {
+		t.Fatal(err)
+	}
+	blocked := make(chan error)
+	go func() { blocked <- PublishMessage(ctx, "t", nil) }()
+	time.Sleep(50 * time.Millisecond)
+
+	drainCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := Drain(drainCtx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, ErrQueueClosed) {
+			t.Errorf("阻塞的发布返回 %v, want ErrQueueClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Drain 之后发布仍然阻塞")
+	}
+	if err := PublishMessage(ctx, "t", nil); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Drain 之后发布返回 %v", err)
+	}
+}
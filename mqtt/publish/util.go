@@ -3,8 +3,6 @@ package publish
 import (
 	"encoding/json"
 	"errors"
-
-	"github.com/sirupsen/logrus"
 )
 
 // 设备上报属性消息的有效负载。
@@ -19,7 +17,7 @@ func verifyPayload(body []byte) (*publicPayload, error) {
 		Values: make([]byte, 0),
 	}
 	if err := json.Unmarshal(body, payload); err != nil {
-		logrus.Error("解析消息失败:", err)
+		log.Error("解析消息失败:", err)
 		return payload, err
 	}
 	if len(payload.DeviceId) == 0 {